@@ -0,0 +1,558 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"code.justin.tv/safety/go2proto/internal"
+	"code.justin.tv/safety/go2proto/internal/ast"
+	"code.justin.tv/safety/go2proto/internal/compat"
+	"code.justin.tv/safety/go2proto/internal/diag"
+	"code.justin.tv/safety/go2proto/internal/lock"
+	"code.justin.tv/safety/go2proto/internal/writers"
+)
+
+const usage = `dumptruck converts go interfaces, structs and typedefs into the equivalent protobuf types
+
+usage:
+    dumptruck gen <target> [flags]
+    dumptruck check [-against <dir or git ref>] [flags]
+
+targets:
+    proto        write a .proto file for every package reachable from the input
+    server       write a .proto file with the service of every interface
+    converters   write the go converters between the go and protobuf types
+    adapters     write the go adapters that pump channels, iterators and callbacks to and from streams
+    all          write every target
+
+check generates the .proto files in memory and fails when they break clients generated
+from the ones in the output directory, or in it at a git ref
+
+run "dumptruck gen <target> -h" or "dumptruck check -h" to list the flags
+
+settings are read from the first dumptruck.yaml, dumptruck.yml or dumptruck.json
+found in the working directory or one of its parents, flags override the file
+`
+
+var ErrUnknownCommand = errors.New("unknown command")
+
+// genTarget writes a single kind of output for a resolved and parsed input
+type genTarget func(g *generation) error
+
+var genTargets = map[string][]genTarget{
+	"proto":      {writeProtos},
+	"server":     {writeServer},
+	"converters": {writeConverters},
+	"adapters":   {writeAdapters},
+	"all":        {writeProtos, writeServer, writeConverters, writeAdapters},
+}
+
+// generation is the resolved go tree and parse result that every target is written from
+type generation struct {
+	cfg      internal.TranspilerConfig
+	goNode   *ast.GoNode
+	result   ast.ParseResult
+	services []internal.Service
+	lock     *lock.File
+}
+
+// run executes the command line given in args (without the program name)
+func run(args []string, stderr io.Writer) error {
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		fmt.Fprint(stderr, usage)
+		return flag.ErrHelp
+	}
+
+	switch args[0] {
+	case "gen":
+		return runGen(args[1:], stderr)
+	case "check":
+		return runCheck(args[1:], stderr)
+	default:
+		fmt.Fprint(stderr, usage)
+		return fmt.Errorf("%w: %s", ErrUnknownCommand, args[0])
+	}
+}
+
+func runGen(args []string, stderr io.Writer) error {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		fmt.Fprint(stderr, usage)
+		return fmt.Errorf("%w: gen requires a target", ErrUnknownCommand)
+	}
+
+	targets, ok := genTargets[args[0]]
+	if !ok {
+		fmt.Fprint(stderr, usage)
+		return fmt.Errorf("%w: gen %s", ErrUnknownCommand, args[0])
+	}
+
+	cfg, err := loadConfig("gen "+args[0], args[1:], stderr, nil)
+	if err != nil {
+		return err
+	}
+
+	g, err := loadReported(cfg, stderr)
+	if err != nil {
+		return err
+	}
+
+	for _, target := range targets {
+		if err := target(g); err != nil {
+			return err
+		}
+	}
+
+	// the numbers are only locked once everything using them was generated
+	if cfg.LockFile != "" {
+		return g.lock.Save(cfg.LockFile)
+	}
+	return nil
+}
+
+// runCheck compares the .proto files the current go code generates with a baseline and fails on breaking changes
+func runCheck(args []string, stderr io.Writer) error {
+	against := ""
+	cfg, err := loadConfig("check", args, stderr, func(fs *flag.FlagSet) {
+		fs.StringVar(&against, "against", against, "`dir or git ref` of the baseline .proto files, defaults to the output directory")
+	})
+	if err != nil {
+		return err
+	}
+
+	g, err := loadReported(cfg, stderr)
+	if err != nil {
+		return err
+	}
+	sources, err := protoSources(g)
+	if err != nil {
+		return err
+	}
+	for _, svc := range g.services {
+		if sources[svc.File], err = writers.ServiceProto(g.goNode, svc, cfg); err != nil {
+			return err
+		}
+	}
+	current, err := compat.ParseAll(sources, cfg.OutDir)
+	if err != nil {
+		return err
+	}
+
+	// a directory wins over a git ref with the same name
+	var baseline []*compat.File
+	if info, statErr := os.Stat(against); against == "" || (statErr == nil && info.IsDir()) {
+		if against == "" {
+			against = cfg.OutDir
+		}
+		baseline, err = compat.LoadDir(against)
+	} else {
+		baseline, err = compat.LoadGitRef(against, cfg.OutDir)
+	}
+	if err != nil {
+		return err
+	}
+
+	breaking := compat.Compare(baseline, current)
+	breaking.Print(stderr)
+	if len(breaking) > 0 {
+		return fmt.Errorf("%w: %d change(s) against %s", compat.ErrBreaking, len(breaking), against)
+	}
+	return nil
+}
+
+// loadReported loads the input and reports every diagnostic at once before deciding whether the run fails
+func loadReported(cfg internal.TranspilerConfig, stderr io.Writer) (*generation, error) {
+	g, err := load(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	g.result.Diagnostics.Print(stderr)
+	failOn, err := diag.ParseSeverity(cfg.FailOn)
+	if err != nil {
+		return nil, err
+	}
+	if err := g.result.Diagnostics.Err(failOn); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// stringList is a flag that can be given multiple times
+type stringList struct {
+	values *[]string
+	set    bool
+}
+
+func (s *stringList) String() string {
+	if s.values == nil {
+		return ""
+	}
+	return strings.Join(*s.values, ",")
+}
+
+func (s *stringList) Set(value string) error {
+	// the first flag replaces the values from the config file instead of adding to them
+	if !s.set {
+		*s.values = nil
+		s.set = true
+	}
+	*s.values = append(*s.values, value)
+	return nil
+}
+
+// stringMap is a key=value flag that can be given multiple times, every pair adds to the pairs from the config file
+// or replaces the one of the same key
+type stringMap map[string]string
+
+func (m stringMap) String() string {
+	pairs := []string{}
+	for key, value := range m {
+		pairs = append(pairs, key+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (m stringMap) Set(value string) error {
+	key, mapped, ok := strings.Cut(value, "=")
+	if !ok || key == "" || mapped == "" {
+		return fmt.Errorf("expected key=value, got %q", value)
+	}
+	m[key] = mapped
+	return nil
+}
+
+// serviceFlag is an interface[,key=value...] flag that can be given multiple times, the keys are the ones of a
+// service in the config file and change the service of the interface from the config file or add one
+type serviceFlag struct {
+	services *[]internal.ServiceConfig
+}
+
+func (s serviceFlag) String() string {
+	if s.services == nil {
+		return ""
+	}
+	names := []string{}
+	for _, svc := range *s.services {
+		names = append(names, svc.Interface)
+	}
+	return strings.Join(names, ",")
+}
+
+func (s serviceFlag) Set(value string) error {
+	parts := strings.Split(value, ",")
+	svc := s.service(parts[0])
+	for _, part := range parts[1:] {
+		key, setting, _ := strings.Cut(part, "=")
+		switch key {
+		case "name":
+			svc.Name = setting
+		case "package":
+			svc.Package = setting
+		case "go_package":
+			svc.GoPackage = setting
+		case "file":
+			svc.File = setting
+		default:
+			return fmt.Errorf("unknown service setting %q, expected name, package, go_package or file", key)
+		}
+	}
+	return nil
+}
+
+// service returns the service of the interface, it is added when there is none yet
+func (s serviceFlag) service(iface string) *internal.ServiceConfig {
+	for idx := range *s.services {
+		if (*s.services)[idx].Interface == iface {
+			return &(*s.services)[idx]
+		}
+	}
+	*s.services = append(*s.services, internal.ServiceConfig{Interface: iface})
+	return &(*s.services)[len(*s.services)-1]
+}
+
+// methodFlag is an interface.method=result,... flag that names the response fields of a method like the results of
+// a method in the config file, an empty result keeps its name
+type methodFlag struct {
+	serviceFlag
+}
+
+func (m methodFlag) String() string {
+	return ""
+}
+
+func (m methodFlag) Set(value string) error {
+	method, results, ok := strings.Cut(value, "=")
+	dot := strings.LastIndex(method, ".")
+	if !ok || dot <= 0 || dot == len(method)-1 {
+		return fmt.Errorf("expected interface.method=result,..., got %q", value)
+	}
+	svc := m.service(method[:dot])
+	if svc.Methods == nil {
+		svc.Methods = map[string]internal.MethodConfig{}
+	}
+	svc.Methods[method[dot+1:]] = internal.MethodConfig{Results: strings.Split(results, ",")}
+	return nil
+}
+
+// packageFlag is a path[,key=value...] flag that can be given multiple times, the keys are the ones of a package in
+// the config file with the entries of its maps as type_mappings.<type>, errors.<error> and embedded.<struct>
+type packageFlag struct {
+	packages map[string]internal.PackageConfig
+}
+
+func (p packageFlag) String() string {
+	paths := []string{}
+	for path := range p.packages {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return strings.Join(paths, ",")
+}
+
+func (p packageFlag) Set(value string) error {
+	parts := strings.Split(value, ",")
+	pkg, ok := p.packages[parts[0]]
+	if !ok {
+		pkg = internal.PackageConfig{TypeMappings: map[string]string{}, Embedded: map[string]string{}, Errors: map[string]string{}}
+	}
+	for _, part := range parts[1:] {
+		key, setting, _ := strings.Cut(part, "=")
+		mapKey, entry, _ := strings.Cut(key, ".")
+		switch {
+		case key == "proto_package":
+			pkg.ProtoPackage = setting
+		case key == "go_package":
+			pkg.GoPackage = setting
+		case key == "skip":
+			pkg.Skip = true
+			if setting != "" {
+				skip, err := strconv.ParseBool(setting)
+				if err != nil {
+					return fmt.Errorf("skip must be a boolean, got %q", setting)
+				}
+				pkg.Skip = skip
+			}
+		case mapKey == "type_mappings" && entry != "":
+			pkg.TypeMappings[entry] = setting
+		case mapKey == "errors" && entry != "":
+			pkg.Errors[entry] = setting
+		case mapKey == "embedded" && entry != "":
+			pkg.Embedded[entry] = setting
+		default:
+			return fmt.Errorf("unknown package setting %q, expected proto_package, go_package, skip, type_mappings.<type>, errors.<error> or embedded.<struct>", key)
+		}
+	}
+	p.packages[parts[0]] = pkg
+	return nil
+}
+
+// loadConfig builds the config from the defaults, the config file and then the flags in args
+// extra adds the flags of the command that aren't settings
+func loadConfig(name string, args []string, stderr io.Writer, extra func(fs *flag.FlagSet)) (internal.TranspilerConfig, error) {
+	// Parse the flags once to find out where the config file is
+	configPath := ""
+	cfg := internal.DefaultTranspilerConfig()
+	fs := newConfigFlagSet(name, &cfg, &configPath, stderr, extra)
+	if err := fs.Parse(args); err != nil {
+		return cfg, err
+	}
+	if fs.NArg() > 0 {
+		return cfg, fmt.Errorf("unexpected arguments: %s", strings.Join(fs.Args(), " "))
+	}
+
+	if configPath == "" {
+		path, err := internal.FindConfig(".")
+		if err != nil && !errors.Is(err, internal.ErrConfigNotFound) {
+			return cfg, err
+		}
+		configPath = path
+	}
+
+	// Then apply the flags again on top of the config file so flags always win
+	if configPath != "" {
+		fileCfg, err := internal.LoadConfig(configPath)
+		if err != nil {
+			return cfg, err
+		}
+		cfg = fileCfg
+		fs = newConfigFlagSet(name, &cfg, &configPath, stderr, extra)
+		if err := fs.Parse(args); err != nil {
+			return cfg, err
+		}
+	}
+
+	return cfg, cfg.Validate()
+}
+
+// newConfigFlagSet returns a flag set that writes every setting straight into cfg
+func newConfigFlagSet(name string, cfg *internal.TranspilerConfig, configPath *string, output io.Writer, extra func(fs *flag.FlagSet)) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(output)
+	fs.StringVar(configPath, "config", *configPath, "config `file` to use instead of discovering one from the working directory")
+	fs.StringVar(&cfg.Input, "input", cfg.Input, "import path of the input interface `file or package`")
+	fs.StringVar(&cfg.ModuleDir, "module", cfg.ModuleDir, "`dir` of the go module to resolve imports from, defaults to the module of the working directory")
+	fs.StringVar(&cfg.Frontend, "frontend", cfg.Frontend, "`frontend` that parses the go source, ast or types (type checked)")
+	fs.StringVar(&cfg.FailOn, "fail-on", cfg.FailOn, "`severity` of the diagnostics that fail the run, warning or error")
+	fs.StringVar(&cfg.Embedded, "embedded", cfg.Embedded, "`strategy` for embedded structs, message (a field named after the type) or flatten (promote their fields)")
+	fs.StringVar(&cfg.Naming, "naming", cfg.Naming, "`policy` naming fields and enum values, style (snake_case and prefixed SCREAMING_SNAKE_CASE) or go (the go names)")
+	fs.StringVar(&cfg.LockFile, "lock", cfg.LockFile, "lock `file` of the assigned field numbers, empty to not lock them")
+	fs.Var(&stringList{values: &cfg.Interfaces}, "interface", "only export the methods of the interface with this `name`, can be repeated")
+	fs.Var(serviceFlag{services: &cfg.Services}, "service", "transpile the interface to a proto service, `interface[,name=,package=,go_package=,file=]`, can be repeated")
+	fs.Var(methodFlag{serviceFlag{services: &cfg.Services}}, "method", "name the response fields of a service method, `interface.method=result,...`, can be repeated")
+	fs.Var(&stringList{values: &cfg.Streams.Iterators}, "stream-iterator", "generic `type` of the iterators that stream e.g. iter.Seq, can be repeated")
+	fs.BoolVar(&cfg.Streams.Callbacks, "stream-callbacks", cfg.Streams.Callbacks, "func(T) error parameters are server streams")
+	fs.StringVar(&cfg.GoProjectPath, "project", cfg.GoProjectPath, "import `path` of the project, only packages under it are transpiled")
+	fs.StringVar(&cfg.OutDir, "out", cfg.OutDir, "`dir` to write the .proto files to")
+	fs.StringVar(&cfg.ConvertersDir, "converters-out", cfg.ConvertersDir, "`dir` to write the go converters to")
+	fs.StringVar(&cfg.ConvertersPkg, "converters-pkg", cfg.ConvertersPkg, "go import `path` of the converters directory, the go package prefix with /converters appended by default")
+	fs.StringVar(&cfg.ErrorCodes, "error-codes", cfg.ErrorCodes, "`codes` the errors are mapped to, grpc or twirp")
+	fs.StringVar(&cfg.AdaptersDir, "adapters-out", cfg.AdaptersDir, "`dir` to write the go adapters of the services to")
+	fs.StringVar(&cfg.TemplatesDir, "templates", cfg.TemplatesDir, "`dir` of .tmpl files that replace the default templates of the same name")
+	fs.StringVar(&cfg.PkgPrefix, "proto-pkg-prefix", cfg.PkgPrefix, "`prefix` prepended to every generated proto package")
+	fs.StringVar(&cfg.PkgPrefixSlash, "go-pkg-prefix", cfg.PkgPrefixSlash, "go_package `prefix` of the generated protobuf go code")
+	fs.StringVar(&cfg.RootPkgName, "root-pkg", cfg.RootPkgName, "proto `package` of the generated server")
+	fs.Var(stringMap(cfg.TypeMappings), "type-mapping", "transpile a go field type as another type, `type=mapped`, can be repeated")
+	fs.Var(stringMap(cfg.Errors), "error", "map a sentinel error or error type to the code its rpcs fail with, `error=code`, can be repeated")
+	fs.Var(packageFlag{packages: cfg.Packages}, "package", "override how a package is transpiled, `path[,proto_package=,go_package=,skip,type_mappings.T=,errors.E=,embedded.S=]`, can be repeated")
+	if extra != nil {
+		extra(fs)
+	}
+	return fs
+}
+
+// load resolves the go tree of the configured input and parses every package in it
+func load(cfg internal.TranspilerConfig) (*generation, error) {
+	resolver, err := newResolver(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	var goNode *ast.GoNode
+	if strings.HasSuffix(cfg.Input, ".go") {
+		goNode, err = ast.ResolveGoTreeWith(resolver, cfg.Input, cfg.GoProjectPath)
+	} else {
+		goNode, err = ast.ResolveGoPackageWith(resolver, strings.TrimSuffix(cfg.Input, "/"), cfg.GoProjectPath)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var result ast.ParseResult
+	if cfg.Frontend == internal.FrontendTypes {
+		result = ast.ParseTyped(cfg.ModuleDir, goNode.UniquePackages())
+	} else {
+		result = ast.ParsePackages(goNode.UniquePackages())
+	}
+	result.DropPackages(cfg.SkippedPackages())
+	result.ApplyOverrides(cfg.FieldTypeOverrides())
+	result.FlattenEmbedded(cfg.EmbedStrategy)
+	result.ApplyNaming(cfg.Naming)
+	result.CheckStreams(cfg.Streams)
+	if len(cfg.Interfaces) > 0 {
+		result.FilterInterfaces(cfg.Interfaces)
+	}
+
+	lockFile := lock.New()
+	if cfg.LockFile != "" {
+		lockFile, err = lock.Load(cfg.LockFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+	services, err := internal.BuildServices(result.Funcs, cfg, &result.Diagnostics)
+	if err != nil {
+		return nil, err
+	}
+	writers.ApplyLock(lockFile, result.Structs, result.Enums, services, cfg, &result.Diagnostics)
+	result.CheckMessages()
+
+	return &generation{
+		cfg:      cfg,
+		goNode:   goNode,
+		result:   result,
+		services: services,
+		lock:     lockFile,
+	}, nil
+}
+
+// newResolver resolves imports from the configured module and falls back to $GOPATH
+func newResolver(cfg internal.TranspilerConfig) (ast.Resolver, error) {
+	if cfg.ModuleDir == "" {
+		return ast.DefaultResolver()
+	}
+
+	resolver, err := ast.NewModuleResolver(cfg.ModuleDir)
+	if err != nil {
+		return nil, err
+	}
+	chain := ast.ChainResolver{resolver}
+	if gopath := os.Getenv("GOPATH"); gopath != "" {
+		chain = append(chain, &ast.GoPathResolver{GoPath: gopath})
+	}
+	return chain, nil
+}
+
+// protoSources returns the content of the .proto file of every package keyed by its path in the output directory
+func protoSources(g *generation) (map[string]string, error) {
+	// After parsing we want to map the selectors to the separate protobuf types
+	// and actually rename our headers tbh to update the . separated pkg path
+	// But then how does a proto file import another file that is in another directory not relative to it? I think it
+	// requires a flat directory structure -> no it just requires go_package to be specified
+	// https://jbrandhorst.com/post/go-protobuf-tips/
+	pkgToProtoFiles, err := writers.ToProtoFiles(g.goNode, g.result.Structs, g.result.Enums, g.cfg)
+	if err != nil {
+		return nil, err
+	}
+	sources := map[string]string{}
+	for _, protoFile := range pkgToProtoFiles {
+		rel, err := filepath.Rel(g.cfg.GoProjectPath, protoFile.GetPackagePath())
+		if err != nil {
+			return nil, err
+		}
+		sources[filepath.Join(rel, protoFile.GetFileNameWithoutExtension()+".proto")] = protoFile.GetSb().String()
+	}
+	return sources, nil
+}
+
+func writeProtos(g *generation) error {
+	sources, err := protoSources(g)
+	if err != nil {
+		return err
+	}
+	for name, src := range sources {
+		if err := WriteFile(filepath.Join(g.cfg.OutDir, name), []byte(src)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeServer(g *generation) error {
+	return writers.WriteServices(g.goNode, g.services, g.cfg)
+}
+
+func writeAdapters(g *generation) error {
+	if err := writers.WriteServerAdapters(g.goNode, g.services, g.result.Structs, g.result.Enums, g.result.Errors, g.cfg); err != nil {
+		return err
+	}
+	if err := writers.WriteClientAdapters(g.goNode, g.services, g.result.Structs, g.result.Enums, g.cfg); err != nil {
+		return err
+	}
+	return writers.WriteStreamAdapters(g.goNode, g.services, g.cfg)
+}
+
+func writeConverters(g *generation) error {
+	// the structs are converted field by field, the converters of other packages are found in the go tree
+	if err := writers.WriteStructConverters(g.goNode, g.result.Structs, g.result.Enums, g.cfg); err != nil {
+		return err
+	}
+	return writers.WriteEnumConverters(g.result.Enums, g.cfg)
+}
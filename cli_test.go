@@ -0,0 +1,92 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"code.justin.tv/safety/go2proto/internal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadConfigFlags(t *testing.T) {
+	root, err := ioutil.TempDir("", "dumptruck")
+	assert.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	path := filepath.Join(root, "dumptruck.yaml")
+	assert.NoError(t, ioutil.WriteFile(path, []byte(`version: 1
+project: a/b
+input: a/b/c
+naming: go
+services:
+  - interface: Users
+    name: UserService
+    file: users.proto
+    methods:
+      Get:
+        results: [user]
+streams:
+  iterators: [iter.Seq]
+type_mappings:
+  WizardPath: StringArray
+  Tags: StringArray
+errors:
+  ErrNotFound: NotFound
+packages:
+  a/b/meta:
+    proto_package: meta.v1
+    type_mappings:
+      ContentTags: StringArray
+`), 0644))
+
+	cfg, err := loadConfig("gen", []string{
+		"-config", path,
+		"-naming", "style",
+		"-service", "Users,name=Accounts",
+		"-service", "Admin,package=admin.v1,file=admin.proto",
+		"-method", "Users.List=users,",
+		"-stream-iterator", "seq.Of",
+		"-stream-iterator", "iter.Seq2",
+		"-stream-callbacks",
+		"-type-mapping", "Tags=Labels",
+		"-error", "ErrExists=AlreadyExists",
+		"-package", "a/b/meta,go_package=a/b/gen/meta,errors.ErrNotFound=FailedPrecondition,embedded.Meta=flatten",
+		"-package", "a/b/internal,skip",
+	}, ioutil.Discard, nil)
+	assert.NoError(t, err)
+
+	// flags win over the file, settings only in the file are kept
+	assert.Equal(t, internal.NamingStyle, cfg.Naming)
+	assert.Equal(t, []internal.ServiceConfig{
+		{Interface: "Users", Name: "Accounts", File: "users.proto", Methods: map[string]internal.MethodConfig{
+			"Get":  {Results: []string{"user"}},
+			"List": {Results: []string{"users", ""}},
+		}},
+		{Interface: "Admin", Package: "admin.v1", File: "admin.proto"},
+	}, cfg.Services)
+	assert.Equal(t, internal.StreamConfig{Iterators: []string{"seq.Of", "iter.Seq2"}, Callbacks: true}, cfg.Streams)
+	assert.Equal(t, map[string]string{"WizardPath": "StringArray", "Tags": "Labels"}, cfg.TypeMappings)
+	assert.Equal(t, map[string]string{"ErrNotFound": "NotFound", "ErrExists": "AlreadyExists"}, cfg.Errors)
+	assert.Equal(t, map[string]internal.PackageConfig{
+		"a/b/meta": {
+			ProtoPackage: "meta.v1",
+			GoPackage:    "a/b/gen/meta",
+			TypeMappings: map[string]string{"ContentTags": "StringArray"},
+			Errors:       map[string]string{"ErrNotFound": "FailedPrecondition"},
+			Embedded:     map[string]string{"Meta": internal.EmbedFlatten},
+		},
+		"a/b/internal": {Skip: true, TypeMappings: map[string]string{}, Errors: map[string]string{}, Embedded: map[string]string{}},
+	}, cfg.Packages)
+
+	// and the values of the flags are validated like the ones of the file
+	_, err = loadConfig("gen", []string{"-config", path, "-error", "ErrExists=Exists"}, ioutil.Discard, nil)
+	assert.Error(t, err)
+	_, err = loadConfig("gen", []string{"-config", path, "-package", "a/b/meta,embedded.Meta=sideways"}, ioutil.Discard, nil)
+	assert.Error(t, err)
+	_, err = loadConfig("gen", []string{"-config", path, "-service", "Users,port=80"}, ioutil.Discard, nil)
+	assert.EqualError(t, err, `invalid value "Users,port=80" for flag -service: unknown service setting "port", expected name, package, go_package or file`)
+	_, err = loadConfig("gen", []string{"-config", path, "-type-mapping", "Tags"}, ioutil.Discard, nil)
+	assert.EqualError(t, err, `invalid value "Tags" for flag -type-mapping: expected key=value, got "Tags"`)
+}
@@ -0,0 +1,19 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrNotFound is returned for an A or D that doesn't exist
+var ErrNotFound = errors.New("not found")
+
+// ErrExists isn't mapped in dumptruck.yaml, rpcs fail with an unknown code but clients still get it back
+var ErrExists = errors.New("already exists")
+
+// LimitError is returned for a limit that is too high
+type LimitError uint64
+
+func (e LimitError) Error() string {
+	return fmt.Sprintf("limit %d is too high", uint64(e))
+}
@@ -8,12 +8,20 @@ import (
 	"code.justin.tv/safety/go2proto/dummy/pkg4"
 )
 
+// TestInterface is transpiled to the Leviathan service
 type TestInterface interface {
+	// GreatFunction returns every great thing
 	GreatFunction() ([]string, error)
 	GreatFunction2(ctx context.Context, arg *pkg1.A) ([]string, error)
 	Function3(ctx context.Context) ([]string, []*string, error)
-	Function4(ctx context.Context, limit uint64) ([]string, []*string, error)
+	Function4(ctx context.Context, limit uint64) (names []string, nicknames []*string, err error)
 	Function5(ctx context.Context, j int64) ([]string, []*string, error)
 	Function6(ctx context.Context, c nestpkg.Country) ([]string, []*string, error)
 	Function7(ctx context.Context, d pkg4.D) error
+	// Watch streams the As of a country until ctx is done
+	Watch(ctx context.Context, c nestpkg.Country) (<-chan *pkg1.A, error)
+	// Upload stores every D it receives and returns how many there were
+	Upload(ctx context.Context, country nestpkg.Country, ds <-chan pkg4.D) (int64, error)
+	Chat(ctx context.Context, in <-chan string) (<-chan string, error)
+	Each(ctx context.Context, limit uint64, fn func(pkg1.A) error) error
 }
@@ -1,8 +1,8 @@
 package nest
 
-type Country = string
+type Country string
 
-type Food = string
+type Food string
 
 const (
 	Canada = Country("Canada")
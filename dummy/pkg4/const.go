@@ -7,8 +7,47 @@ import (
 	"code.justin.tv/safety/go2proto/dummy/pkg2/nest"
 )
 
+// D is the argument of TestInterface.Function7
 type D struct {
 	Country   nest.Country
 	A         pkg1.A
-	CreatedAt time.Time
+	CreatedAt time.Time // when D was created
+	Labels    map[string]string
+	// ByCountry lists the As of every country
+	ByCountry map[nest.Country][]*pkg1.A
+}
+
+type Audit struct {
+	CreatedBy string    `json:"created_by"`
+	UpdatedAt time.Time `proto:"updated_at,5"`
+	Secret    string    `json:"-"`
+}
+
+// E is flattened in dumptruck.yaml, its message has the fields of Audit and pkg1.A
+type E struct {
+	Audit
+	*pkg1.A
+	Note string
+}
+
+// Subject is what a Review is about, only the types of pkg4 with isSubject can be one
+type Subject interface {
+	isSubject()
+	Created() time.Time
+}
+
+func (*D) isSubject() {}
+
+// Created returns when D was created
+func (d *D) Created() time.Time { return d.CreatedAt }
+
+func (Audit) isSubject() {}
+
+// Created returns when the audit was last updated
+func (a Audit) Created() time.Time { return a.UpdatedAt }
+
+// Review is about every Subject it lists
+type Review struct {
+	Main     Subject
+	Subjects []Subject
 }
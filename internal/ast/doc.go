@@ -0,0 +1,50 @@
+package ast
+
+import (
+	"go/ast"
+	"strings"
+
+	"code.justin.tv/safety/go2proto/internal"
+)
+
+// serviceDirective marks an interface as a proto service, optionally followed by the name of the service
+const serviceDirective = "//dumptruck:service"
+
+// typeDoc returns the doc comment of a type spec, the doc of its declaration when it's the only spec in it
+func typeDoc(genDecl *ast.GenDecl, spec *ast.TypeSpec) *ast.CommentGroup {
+	if spec.Doc != nil {
+		return spec.Doc
+	}
+	if genDecl != nil && len(genDecl.Specs) == 1 {
+		return genDecl.Doc
+	}
+	return nil
+}
+
+// valueDoc returns the doc comment of a const or var, the doc of its declaration when it's the only spec in it
+// and its line comment when it has neither
+func valueDoc(genDecl *ast.GenDecl, spec *ast.ValueSpec) string {
+	doc := spec.Doc
+	if doc == nil && len(genDecl.Specs) == 1 {
+		doc = genDecl.Doc
+	}
+	return internal.DocText(doc, spec.Comment)
+}
+
+// serviceAnnotation returns the name of the service an interface is annotated as, iface when the annotation doesn't
+// name one and empty without an annotation
+func serviceAnnotation(doc *ast.CommentGroup, iface string) string {
+	if doc == nil {
+		return ""
+	}
+	for _, comment := range doc.List {
+		if comment.Text != serviceDirective && !strings.HasPrefix(comment.Text, serviceDirective+" ") {
+			continue
+		}
+		if name := strings.TrimSpace(strings.TrimPrefix(comment.Text, serviceDirective)); name != "" {
+			return name
+		}
+		return iface
+	}
+	return ""
+}
@@ -0,0 +1,111 @@
+package ast
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServiceAnnotation(t *testing.T) {
+	root, err := ioutil.TempDir("", "dumptruck")
+	assert.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	writeTestFiles(t, root, map[string]string{
+		"svc/go.mod": "module example.com/svc\n\ngo 1.23\n",
+		"svc/api/api.go": `package api
+
+// Users manages users
+//dumptruck:service UserService
+type Users interface {
+	Get(id string) error
+}
+
+type (
+	//dumptruck:service
+	Orders interface {
+		List() error
+	}
+
+	// Plain is not a service
+	Plain interface {
+		Ping() error
+	}
+)
+`,
+	})
+
+	packages := []Package{{ImportPath: "example.com/svc/api", Dir: filepath.Join(root, "svc/api")}}
+	for name, result := range map[string]ParseResult{
+		"ast":   ParsePackages(packages),
+		"types": parseTypedModule(t, filepath.Join(root, "svc"), packages),
+	} {
+		services := map[string]string{}
+		for _, f := range result.Funcs {
+			services[f.Interface] = f.Service
+		}
+		assert.Equal(t, map[string]string{"Users": "UserService", "Orders": "Orders", "Plain": ""}, services, name)
+	}
+}
+
+func TestDocComments(t *testing.T) {
+	root, err := ioutil.TempDir("", "dumptruck")
+	assert.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	writeTestFiles(t, root, map[string]string{
+		"svc/go.mod": "module example.com/svc\n\ngo 1.23\n",
+		"svc/api/api.go": `package api
+
+// Users manages users
+//dumptruck:service
+type Users interface {
+	// Get returns a user
+	Get(id string) (User, error)
+}
+
+// User is a user
+type User struct {
+	// ID is unique
+	ID   string
+	Name string // display name
+}
+
+// Role of a user
+type Role int
+
+const (
+	// Admin can do anything
+	Admin Role = iota
+	Guest      // can only look
+)
+`,
+	})
+
+	packages := []Package{{ImportPath: "example.com/svc/api", Dir: filepath.Join(root, "svc/api")}}
+	for name, result := range map[string]ParseResult{
+		"ast":   ParsePackages(packages),
+		"types": parseTypedModule(t, filepath.Join(root, "svc"), packages),
+	} {
+		assert.Equal(t, 1, len(result.Funcs), name)
+		assert.Equal(t, "Users manages users", result.Funcs[0].InterfaceDoc, name)
+		assert.Equal(t, "Get returns a user", result.Funcs[0].Doc, name)
+
+		assert.Equal(t, 1, len(result.Structs), name)
+		assert.Equal(t, "User is a user", result.Structs[0].Doc, name)
+		assert.Equal(t, "ID is unique", result.Structs[0].Fields[0].Doc, name)
+		assert.Equal(t, "display name", result.Structs[0].Fields[1].Doc, name)
+
+		docs := map[string][2]string{}
+		for _, e := range result.Enums {
+			docs[e.Name] = [2]string{e.Doc, e.TypeDoc}
+		}
+		assert.Equal(t, map[string][2]string{
+			"Admin": {"Admin can do anything", "Role of a user"},
+			"Guest": {"can only look", "Role of a user"},
+		}, docs, name)
+	}
+}
@@ -0,0 +1,213 @@
+package ast
+
+import (
+	"go/types"
+
+	"code.justin.tv/safety/go2proto/internal"
+	"code.justin.tv/safety/go2proto/internal/diag"
+)
+
+// EmbedFieldRange is the block of field numbers every flattened embedded struct gets, the fields promoted
+// from the nth embedded struct are numbered n*EmbedFieldRange+their number in the embedded message so adding
+// or removing a field of an embedded struct never renumbers the fields of the parent
+const EmbedFieldRange = 1000
+
+// 19000 to 19999 are reserved by protobuf so that block is never handed out
+const reservedEmbedBlock = 19
+
+// FlattenEmbedded replaces the embedded struct fields of every struct whose strategy is internal.EmbedFlatten
+// with the fields the embedded struct promotes, following go's rules:
+// fields of the parent shadow promoted fields and promoted fields with the same name at the same depth are dropped
+func (r *ParseResult) FlattenEmbedded(strategy func(s internal.Struct) string) {
+	f := &embedFlattener{
+		result:   r,
+		strategy: strategy,
+		byName:   map[string]int{},
+		resolved: map[int][]*internal.Field{},
+		visiting: map[int]bool{},
+	}
+	for idx, s := range r.Structs {
+		f.byName[*s.Path.Path+"."+s.Name] = idx
+		f.byName[s.Package+"."+s.Name] = idx
+	}
+
+	flattened := make([][]*internal.Field, len(r.Structs))
+	for idx := range r.Structs {
+		flattened[idx] = f.resolve(idx)
+	}
+	for idx := range r.Structs {
+		r.Structs[idx].Fields = flattened[idx]
+	}
+}
+
+type embedFlattener struct {
+	result   *ParseResult
+	strategy func(s internal.Struct) string
+	byName   map[string]int            // import path.Name and package name.Name -> index of the struct
+	resolved map[int][]*internal.Field // fields of every struct that was already flattened
+	visiting map[int]bool              // structs that are being flattened, embedding one of them again is a cycle
+}
+
+// lookup returns the index of the parsed struct an embedded field refers to
+func (f *embedFlattener) lookup(field *internal.Field) (int, bool) {
+	if !field.Embedded || field.Repeated || field.IsMap() {
+		return 0, false
+	}
+
+	name := ""
+	if selector := field.ComputeSelector(); selector != nil {
+		name = selector.Package + "." + selector.Name
+		if selector.ImportPath != "" {
+			name = selector.ImportPath + "." + selector.Name
+		}
+	} else if field.Path.Path != nil {
+		name = *field.Path.Path + "." + field.Type
+	}
+	idx, ok := f.byName[name]
+	return idx, ok
+}
+
+// resolve returns the fields of the message of a struct with its embedded structs flattened
+func (f *embedFlattener) resolve(idx int) []*internal.Field {
+	if fields, ok := f.resolved[idx]; ok {
+		return fields
+	}
+
+	s := f.result.Structs[idx]
+	if f.strategy(s) != internal.EmbedFlatten {
+		f.resolved[idx] = s.Fields
+		return s.Fields
+	}
+
+	f.visiting[idx] = true
+	defer delete(f.visiting, idx)
+
+	decl := s.Package + "." + s.Name
+	nextBlock := 0
+	allocate := func() int {
+		nextBlock++
+		if nextBlock == reservedEmbedBlock {
+			nextBlock++
+		}
+		return nextBlock
+	}
+
+	fields := []*internal.Field{}
+	direct := 0
+	for _, field := range s.Fields {
+		embeddedIdx, ok := f.lookup(field)
+		if ok && f.visiting[embeddedIdx] {
+			f.result.Diagnostics.Add(diag.Warning, field.Pos, decl, "can't flatten embedded %s, it embeds %s, transpiled as a message field", field.Type, s.Name)
+			ok = false
+		}
+		if !ok {
+			direct++
+			fields = append(fields, field.Copy())
+			continue
+		}
+
+		embedded := f.result.Structs[embeddedIdx]
+		block := allocate()
+		blocks := map[int]int{} // block in the embedded message -> block in this message
+		// fields without a number are numbered by their position among the other fields without one
+		position := 0
+		for _, promoted := range f.resolve(embeddedIdx) {
+			number := promoted.Number
+			if number == 0 {
+				position++
+				number = position
+			}
+			if number/EmbedFieldRange == 0 {
+				number += block * EmbedFieldRange
+			} else {
+				if _, ok := blocks[number/EmbedFieldRange]; !ok {
+					blocks[number/EmbedFieldRange] = allocate()
+				}
+				number = blocks[number/EmbedFieldRange]*EmbedFieldRange + number%EmbedFieldRange
+			}
+
+			c := promoted.Copy()
+			c.Number = number
+			c.FixedNumber = false
+			c.Promoted = append([]*internal.Field{field}, c.Promoted...)
+			for step := range c.Promoted[1:] {
+				c.Promoted[step+1] = c.Promoted[step+1].Copy()
+				requalify(c.Promoted[step+1], embedded, s)
+			}
+			requalify(c, embedded, s)
+			fields = append(fields, c)
+		}
+	}
+	if direct >= EmbedFieldRange {
+		f.result.Diagnostics.Add(diag.Warning, s.Fields[0].Pos, decl, "%s has %d fields, the numbers of its flattened fields collide with them", s.Name, direct)
+	}
+
+	fields = f.shadow(decl, fields)
+	f.resolved[idx] = fields
+	return fields
+}
+
+// shadow drops the promoted fields that go doesn't promote, fields of the parent and promoted fields that are
+// closer to the parent win and two promoted fields with the same name at the same depth hide each other
+func (f *embedFlattener) shadow(decl string, fields []*internal.Field) []*internal.Field {
+	depth := map[string]int{}
+	count := map[string]int{}
+	for _, field := range fields {
+		d, ok := depth[field.Name]
+		if !ok || len(field.Promoted) < d {
+			depth[field.Name] = len(field.Promoted)
+			count[field.Name] = 1
+		} else if len(field.Promoted) == d {
+			count[field.Name]++
+		}
+	}
+
+	out := []*internal.Field{}
+	reported := map[string]struct{}{}
+	for _, field := range fields {
+		if len(field.Promoted) != depth[field.Name] {
+			continue
+		}
+		if count[field.Name] > 1 {
+			if _, ok := reported[field.Name]; !ok {
+				f.result.Diagnostics.Add(diag.Warning, field.Promoted[0].Pos, decl, "skipping promoted field %s: it is ambiguous, more than one embedded struct declares it", field.Name)
+				reported[field.Name] = struct{}{}
+			}
+			continue
+		}
+		out = append(out, field)
+	}
+	return out
+}
+
+// requalify makes the type of a field declared in from refer to the same type when it is used in to
+// e.g. a field of type B promoted from pkg1.A into pkg4.D has the type pkg1.B
+func requalify(field *internal.Field, from internal.Struct, to internal.Struct) {
+	if field.IsMap() {
+		requalify(field.MapKey, from, to)
+		requalify(field.MapValue, from, to)
+		return
+	}
+	if *from.Path.Path == *to.Path.Path {
+		return
+	}
+
+	if selector := field.ComputeSelector(); selector != nil {
+		// a type of the package the field is promoted into doesn't need a selector anymore
+		if selector.ImportPath == *to.Path.Path || (selector.ImportPath == "" && selector.Package == to.Package) {
+			field.Selector = false
+			field.Package = ""
+			field.ImportPath = ""
+			field.Type = selector.Name
+		}
+		return
+	}
+	if field.Type == "interface" || field.Type == "bytes" || types.Universe.Lookup(field.Type) != nil {
+		return
+	}
+
+	field.Selector = true
+	field.Package = from.Package
+	field.ImportPath = *from.Path.Path
+	field.Type = from.Package + "." + field.Type
+}
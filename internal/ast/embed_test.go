@@ -0,0 +1,110 @@
+package ast
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"code.justin.tv/safety/go2proto/internal"
+	"code.justin.tv/safety/go2proto/internal/diag"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFlattenEmbedded(t *testing.T) {
+	root, err := ioutil.TempDir("", "dumptruck")
+	assert.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	writeTestFiles(t, root, map[string]string{
+		"models/models.go": `package models
+
+type Base struct {
+	ID   string
+	Name string
+}
+
+type Extra struct {
+	Name string
+	Size int
+}
+
+type Kind struct {
+	Label string
+}
+
+type Item struct {
+	Base
+	*Extra
+	Kind Kind
+}
+
+type Loop struct {
+	*Loop
+	V string
+}
+`,
+		"api/api.go": `package api
+
+import "example.com/models"
+
+type Wrapper struct {
+	models.Item
+	ID string
+}
+
+type Plain struct {
+	models.Base
+}
+`,
+	})
+
+	result := ParsePackages([]Package{
+		{ImportPath: "example.com/models", Dir: filepath.Join(root, "models")},
+		{ImportPath: "example.com/api", Dir: filepath.Join(root, "api")},
+	})
+	assert.Empty(t, result.Diagnostics)
+
+	result.FlattenEmbedded(func(s internal.Struct) string {
+		if s.Name == "Plain" {
+			return internal.EmbedMessage
+		}
+		return internal.EmbedFlatten
+	})
+
+	fields := map[string][]string{}
+	numbers := map[string][]int{}
+	for _, s := range result.Structs {
+		for _, f := range s.Fields {
+			fields[s.Name] = append(fields[s.Name], f.Name+" "+f.Type)
+			numbers[s.Name] = append(numbers[s.Name], f.Number)
+		}
+	}
+
+	// Name is declared by both Base and Extra so go doesn't promote it
+	assert.Equal(t, []string{"ID string", "Size int", "Kind Kind"}, fields["Item"])
+	// direct fields are left to the lock file
+	assert.Equal(t, []int{1001, 2002, 0}, numbers["Item"])
+
+	// the ID of Wrapper shadows the one promoted from Base and Kind is qualified with the package it's declared in
+	assert.Equal(t, []string{"Size int", "Kind models.Kind", "ID string"}, fields["Wrapper"])
+	assert.Equal(t, []int{3002, 1001, 0}, numbers["Wrapper"])
+
+	// a struct embedding itself can't be flattened
+	assert.Equal(t, []string{"Loop Loop", "V string"}, fields["Loop"])
+	assert.Equal(t, []int{0, 0}, numbers["Loop"])
+
+	// embedded structs are a message field with the message strategy
+	assert.Equal(t, []string{"Base models.Base"}, fields["Plain"])
+	assert.Equal(t, []int{0}, numbers["Plain"])
+
+	msgs := []string{}
+	for _, d := range result.Diagnostics {
+		assert.Equal(t, diag.Warning, d.Severity)
+		msgs = append(msgs, d.Decl+": "+d.Msg)
+	}
+	assert.Equal(t, []string{
+		"models.Item: skipping promoted field Name: it is ambiguous, more than one embedded struct declares it",
+		"models.Loop: can't flatten embedded Loop, it embeds Loop, transpiled as a message field",
+	}, msgs)
+}
@@ -0,0 +1,144 @@
+package ast
+
+import (
+	"go/ast"
+	"go/constant"
+	"go/token"
+	"sort"
+
+	"code.justin.tv/safety/go2proto/internal"
+)
+
+// intValue evaluates the value of an integer constant at position iota of its block, false when the syntax alone
+// doesn't tell e.g. because the expression refers to another constant. Conversions like Status(2) are evaluated
+// as their argument
+func intValue(expr ast.Expr, iota int) (int, bool) {
+	value := constValue(expr, iota)
+	if value.Kind() != constant.Int {
+		return 0, false
+	}
+	v, exact := constant.Int64Val(value)
+	return int(v), exact
+}
+
+// stringValue evaluates the value of a string constant e.g. "Borgir", Food("Borgir") or "a" + "b", false when the
+// syntax alone doesn't tell
+func stringValue(expr ast.Expr, iota int) (string, bool) {
+	value := constValue(expr, iota)
+	if value.Kind() != constant.String {
+		return "", false
+	}
+	return constant.StringVal(value), true
+}
+
+func constValue(expr ast.Expr, iota int) constant.Value {
+	switch e := expr.(type) {
+	case *ast.BasicLit:
+		if e.Kind == token.INT || e.Kind == token.STRING {
+			return constant.MakeFromLiteral(e.Value, e.Kind, 0)
+		}
+	case *ast.Ident:
+		if e.Name == "iota" {
+			return constant.MakeInt64(int64(iota))
+		}
+	case *ast.ParenExpr:
+		return constValue(e.X, iota)
+	case *ast.CallExpr:
+		if len(e.Args) == 1 {
+			return constValue(e.Args[0], iota)
+		}
+	case *ast.UnaryExpr:
+		if x := constValue(e.X, iota); x.Kind() != constant.String {
+			return constant.UnaryOp(e.Op, x, 0)
+		}
+	case *ast.BinaryExpr:
+		x, y := constValue(e.X, iota), constValue(e.Y, iota)
+		if x.Kind() == constant.Unknown || y.Kind() == constant.Unknown {
+			return constant.MakeUnknown()
+		}
+		// strings can only be concatenated, constant.BinaryOp panics on anything else
+		if x.Kind() == constant.String || y.Kind() == constant.String {
+			if e.Op != token.ADD || x.Kind() != y.Kind() {
+				return constant.MakeUnknown()
+			}
+			return constant.BinaryOp(x, e.Op, y)
+		}
+		switch e.Op {
+		case token.SHL, token.SHR:
+			s, ok := constant.Uint64Val(y)
+			if !ok {
+				return constant.MakeUnknown()
+			}
+			return constant.Shift(x, e.Op, uint(s))
+		case token.QUO:
+			if constant.Sign(y) == 0 {
+				return constant.MakeUnknown()
+			}
+			return constant.BinaryOp(x, token.QUO_ASSIGN, y) // integer division
+		case token.ADD, token.SUB, token.MUL, token.REM, token.AND, token.OR, token.XOR, token.AND_NOT:
+			if e.Op == token.REM && constant.Sign(y) == 0 {
+				return constant.MakeUnknown()
+			}
+			return constant.BinaryOp(x, e.Op, y)
+		}
+	}
+	return constant.MakeUnknown()
+}
+
+// enumKinds are the underlying types of the named types whose constants are enum values
+var enumKinds = map[string]bool{
+	"string": true, "int": true, "int8": true, "int16": true, "int32": true, "int64": true,
+	"uint": true, "uint8": true, "uint16": true, "uint32": true, "uint64": true, "uintptr": true,
+	"byte": true, "rune": true,
+}
+
+// constTypeName returns the name of the type of the constant at position idx of a spec with typeExpr and values,
+// either the declared type or the type of a conversion like Country("Canada"). It's empty for untyped constants
+// and types of other packages
+func constTypeName(typeExpr ast.Expr, values []ast.Expr, idx int) string {
+	if typeExpr != nil {
+		if ident, ok := typeExpr.(*ast.Ident); ok {
+			return ident.Name
+		}
+		return ""
+	}
+	if idx < len(values) {
+		if call, ok := values[idx].(*ast.CallExpr); ok && len(call.Args) == 1 {
+			if ident, ok := call.Fun.(*ast.Ident); ok {
+				return ident.Name
+			}
+		}
+	}
+	return ""
+}
+
+// keepEnums drops the constants whose type isn't declared in their package as a defined type of a basic kind
+// e.g. type Status int but not the alias type Status = int, and gives the others the underlying type of their type
+func (r *ParseResult) keepEnums() {
+	kinds := map[string]string{} // import path.Name -> underlying type
+	for _, pod := range r.PodTypedefs {
+		if !pod.Alias && enumKinds[pod.Type] {
+			kinds[*pod.Path.Path+"."+pod.Name] = pod.Type
+		}
+	}
+	enums := []internal.EnumAssignment{}
+	for _, enum := range r.Enums {
+		if kind, ok := kinds[enum.EnumType()]; ok {
+			enum.UnderlyingType = kind
+			enums = append(enums, enum)
+		}
+	}
+	r.Enums = enums
+}
+
+// sortEnums orders the values of every enum as they are declared, values without a go value (e.g. of string enums)
+// are numbered in this order so adding a value after the others never renumbers them
+func (r *ParseResult) sortEnums() {
+	sort.SliceStable(r.Enums, func(i, j int) bool {
+		a, b := r.Enums[i].Pos, r.Enums[j].Pos
+		if a.Filename != b.Filename {
+			return a.Filename < b.Filename
+		}
+		return a.Offset < b.Offset
+	})
+}
@@ -0,0 +1,160 @@
+package ast
+
+import (
+	"go/parser"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"code.justin.tv/safety/go2proto/internal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIntValue(t *testing.T) {
+	for src, expected := range map[string]int{
+		"iota":            3,
+		"iota + 1":        4,
+		"(iota - 1) * 10": 20,
+		"1 << iota":       8,
+		"Status(7)":       7,
+		"-2":              -2,
+		"0x10":            16,
+	} {
+		expr, err := parser.ParseExpr(src)
+		assert.NoError(t, err)
+		value, ok := intValue(expr, 3)
+		assert.True(t, ok, src)
+		assert.Equal(t, expected, value, src)
+	}
+
+	// other constants, strings and divisions by zero aren't known
+	for _, src := range []string{"Other + 1", `"a"`, "iota / 0", `Country("CA")`} {
+		expr, err := parser.ParseExpr(src)
+		assert.NoError(t, err)
+		_, ok := intValue(expr, 3)
+		assert.False(t, ok, src)
+	}
+
+	for src, expected := range map[string]string{
+		`"Borgir"`:      "Borgir",
+		`Food("Pitza")`: "Pitza",
+		"`raw`":         "raw",
+		`"a" + ("b")`:   "ab",
+		`"caf\u00e9"`:   "café",
+	} {
+		expr, err := parser.ParseExpr(src)
+		assert.NoError(t, err)
+		value, ok := stringValue(expr, 3)
+		assert.True(t, ok, src)
+		assert.Equal(t, expected, value, src)
+	}
+
+	// invalid operations on strings aren't known instead of panicking
+	for _, src := range []string{"iota", `"a" - "b"`, `"a" + 1`, `-"a"`, `Other + "a"`} {
+		expr, err := parser.ParseExpr(src)
+		assert.NoError(t, err)
+		_, ok := stringValue(expr, 3)
+		assert.False(t, ok, src)
+	}
+}
+
+func TestParseEnums(t *testing.T) {
+	root, err := ioutil.TempDir("", "dumptruck")
+	assert.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	writeTestFiles(t, root, map[string]string{
+		"api/sort.go": `package api
+
+type SortType string
+
+type Level uint8
+
+const (
+	SortAscending  SortType = "asc"
+	SortDescending SortType = "desc"
+)
+
+const (
+	Low Level = iota + 1
+	High
+)
+
+// untyped constants, variables and constants of other types aren't enum values
+const MaxResults = 100
+
+const Timeout = time.Second
+
+var DefaultSort = SortAscending
+
+type Flags []string
+
+const NoFlags Flags = nil
+`,
+		"api/more.go": `package api
+
+// the values of a type are one enum wherever they are declared
+const SortRelevance = SortType("relevance")
+
+const Max, Min Level = 9, 0
+`,
+	})
+
+	result := ParsePackages([]Package{{ImportPath: "example.com/api", Dir: filepath.Join(root, "api")}})
+	assert.Empty(t, result.Diagnostics)
+	enums := map[string][]string{}
+	for _, enum := range result.Enums {
+		enums[enum.FuncName+" "+enum.UnderlyingType] = append(enums[enum.FuncName+" "+enum.UnderlyingType], enum.Name)
+	}
+	assert.Equal(t, map[string][]string{
+		"Level uint8":     {"Max", "Min", "Low", "High"},
+		"SortType string": {"SortRelevance", "SortAscending", "SortDescending"},
+	}, enums)
+	assert.Equal(t, [][]int{{0, 3, 4}, {1, 2, 5, 6}}, internal.GroupEnums(result.Enums))
+	assert.Equal(t, "relevance", *result.Enums[0].StringValue)
+	assert.Equal(t, 9, *result.Enums[1].Value)
+}
+
+func TestParseEnumAliases(t *testing.T) {
+	root, err := ioutil.TempDir("", "dumptruck")
+	assert.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	writeTestFiles(t, root, map[string]string{
+		"svc/go.mod": "module example.com/svc\n\ngo 1.23\n",
+		"svc/api/api.go": `package api
+
+type Country string
+
+// an alias isn't a type of its own, its constants are plain strings
+type Food = string
+
+const Canada = Country("Canada")
+
+const (
+	Borgir Food = "Borgir"
+	Pitza  Food = "Pitza"
+)
+`,
+	})
+
+	packages := []Package{{ImportPath: "example.com/svc/api", Dir: filepath.Join(root, "svc/api")}}
+	for name, result := range map[string]ParseResult{
+		"ast":   ParsePackages(packages),
+		"types": parseTypedModule(t, filepath.Join(root, "svc"), packages),
+	} {
+		assert.Empty(t, result.Diagnostics, name)
+		enums := []string{}
+		for _, enum := range result.Enums {
+			enums = append(enums, enum.FuncName+"."+enum.Name)
+		}
+		assert.Equal(t, []string{"Country.Canada"}, enums, name)
+
+		aliases := map[string]bool{}
+		for _, pod := range result.PodTypedefs {
+			aliases[pod.Name] = pod.Alias
+		}
+		assert.Equal(t, map[string]bool{"Country": false, "Food": true}, aliases, name)
+	}
+}
@@ -0,0 +1,114 @@
+package ast
+
+import (
+	"go/ast"
+	"go/types"
+	"sort"
+
+	"code.justin.tv/safety/go2proto/internal"
+)
+
+// sentinelErrors returns the exported variables of a var declaration that are errors, the syntax only tells
+// when they are declared as an error or created with errors.New or fmt.Errorf
+func sentinelErrors(genDecl *ast.GenDecl, pkgName string, pathObj internal.Path) []internal.GoError {
+	out := []internal.GoError{}
+	for _, spec := range genDecl.Specs {
+		value, ok := spec.(*ast.ValueSpec)
+		if !ok {
+			continue
+		}
+		for idx, name := range value.Names {
+			if !name.IsExported() {
+				continue
+			}
+			isError := false
+			if ident, ok := value.Type.(*ast.Ident); ok && ident.Name == "error" {
+				isError = true
+			} else if value.Type == nil && idx < len(value.Values) {
+				isError = isErrorCall(value.Values[idx])
+			}
+			if isError {
+				out = append(out, internal.GoError{Package: pkgName, Path: pathObj, Name: name.Name})
+			}
+		}
+	}
+	return out
+}
+
+// isErrorCall returns true for a call of errors.New or fmt.Errorf
+func isErrorCall(expr ast.Expr) bool {
+	call, ok := expr.(*ast.CallExpr)
+	if !ok {
+		return false
+	}
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok {
+		return false
+	}
+	pkg, ok := sel.X.(*ast.Ident)
+	return ok && ((pkg.Name == "errors" && sel.Sel.Name == "New") || (pkg.Name == "fmt" && sel.Sel.Name == "Errorf"))
+}
+
+// errorType returns the error type of an Error() string method declared on an exported type
+func errorType(funcDecl *ast.FuncDecl, pkgName string, pathObj internal.Path) (internal.GoError, bool) {
+	if funcDecl.Recv == nil || len(funcDecl.Recv.List) != 1 || funcDecl.Name.Name != "Error" {
+		return internal.GoError{}, false
+	}
+	fun := funcDecl.Type
+	if fun.Params.NumFields() != 0 || fun.Results.NumFields() != 1 {
+		return internal.GoError{}, false
+	}
+	if result, ok := fun.Results.List[0].Type.(*ast.Ident); !ok || result.Name != "string" {
+		return internal.GoError{}, false
+	}
+
+	recv := funcDecl.Recv.List[0].Type
+	pointer := false
+	if star, ok := recv.(*ast.StarExpr); ok {
+		recv, pointer = star.X, true
+	}
+	ident, ok := recv.(*ast.Ident)
+	if !ok || !ident.IsExported() {
+		return internal.GoError{}, false
+	}
+	return internal.GoError{Package: pkgName, Path: pathObj, Name: ident.Name, Type: true, Pointer: pointer}, true
+}
+
+// parseErrors adds the exported sentinel error variables and error types of the package
+func (p *typedParser) parseErrors(pkg *typedPackage, genDecl *ast.GenDecl, pathObj internal.Path) {
+	errorIface := types.Universe.Lookup("error").Type().Underlying().(*types.Interface)
+	for _, spec := range genDecl.Specs {
+		switch spec := spec.(type) {
+		case *ast.ValueSpec:
+			for _, name := range spec.Names {
+				obj, ok := pkg.info.Defs[name].(*types.Var)
+				if ok && obj.Exported() && types.Implements(obj.Type(), errorIface) {
+					p.result.Errors = append(p.result.Errors, internal.GoError{Package: pkg.pkg.Name(), Path: pathObj, Name: name.Name})
+				}
+			}
+		case *ast.TypeSpec:
+			obj, ok := pkg.info.Defs[spec.Name].(*types.TypeName)
+			if !ok || !obj.Exported() || types.IsInterface(obj.Type()) {
+				continue
+			}
+			goError := internal.GoError{Package: pkg.pkg.Name(), Path: pathObj, Name: obj.Name(), Type: true}
+			if !types.Implements(obj.Type(), errorIface) {
+				if !types.Implements(types.NewPointer(obj.Type()), errorIface) {
+					continue
+				}
+				goError.Pointer = true
+			}
+			p.result.Errors = append(p.result.Errors, goError)
+		}
+	}
+}
+
+// sortErrors orders the errors by package and name
+func (r *ParseResult) sortErrors() {
+	sort.Slice(r.Errors, func(i, j int) bool {
+		if *r.Errors[i].Path.Path != *r.Errors[j].Path.Path {
+			return *r.Errors[i].Path.Path < *r.Errors[j].Path.Path
+		}
+		return r.Errors[i].Name < r.Errors[j].Name
+	})
+}
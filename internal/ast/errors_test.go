@@ -0,0 +1,77 @@
+package ast
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseErrors(t *testing.T) {
+	root, err := ioutil.TempDir("", "dumptruck")
+	assert.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	writeTestFiles(t, root, map[string]string{
+		"svc/go.mod": "module example.com/svc\n\ngo 1.23\n",
+		"svc/api/errors.go": `package api
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrNotFound        = errors.New("not found")
+	ErrExists   error  = fmt.Errorf("exists")
+	errInternal        = errors.New("internal")
+	Limit              = 10
+)
+
+type ValidationError struct {
+	Field string
+}
+
+func (e *ValidationError) Error() string {
+	return e.Field + " is invalid"
+}
+
+type CodeError int
+
+func (e CodeError) Error() string {
+	return "code"
+}
+
+type notExported struct{}
+
+func (notExported) Error() string {
+	return "not exported"
+}
+`,
+	})
+
+	packages := []Package{{ImportPath: "example.com/svc/api", Dir: filepath.Join(root, "svc/api")}}
+	for name, result := range map[string]ParseResult{
+		"ast":   ParsePackages(packages),
+		"types": parseTypedModule(t, filepath.Join(root, "svc"), packages),
+	} {
+		found := map[string][2]bool{} // name -> type, pointer
+		for _, goError := range result.Errors {
+			assert.Equal(t, "api", goError.Package, name)
+			assert.Equal(t, "example.com/svc/api", *goError.Path.Path, name)
+			found[goError.Name] = [2]bool{goError.Type, goError.Pointer}
+		}
+		assert.Equal(t, map[string][2]bool{
+			"CodeError":       {true, false},
+			"ErrExists":       {false, false},
+			"ErrNotFound":     {false, false},
+			"ValidationError": {true, true},
+		}, found, name)
+		assert.Equal(t, "CodeError", result.Errors[0].Name, name)
+
+		result.DropPackages([]string{"example.com/svc/api"})
+		assert.Empty(t, result.Errors, name)
+	}
+}
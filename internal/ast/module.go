@@ -0,0 +1,363 @@
+package ast
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+var (
+	ErrMissingGoMod     = errors.New("missing go.mod")
+	ErrInvalidGoMod     = errors.New("invalid go.mod")
+	ErrUnresolvedImport = errors.New("unable to resolve import")
+)
+
+// Resolver maps a go import path to the directory its source files live in
+type Resolver interface {
+	Dir(importPath string) (string, error)
+}
+
+// GoPathResolver resolves imports the pre modules way from $GOPATH/src
+type GoPathResolver struct {
+	GoPath string
+}
+
+func (r *GoPathResolver) Dir(importPath string) (string, error) {
+	dir := filepath.Join(r.GoPath, "src", importPath)
+	if !isDir(dir) {
+		return "", fmt.Errorf("%w: %s not in GOPATH %s", ErrUnresolvedImport, importPath, r.GoPath)
+	}
+	return dir, nil
+}
+
+// ChainResolver returns the directory from the first resolver that can resolve an import
+type ChainResolver []Resolver
+
+func (r ChainResolver) Dir(importPath string) (string, error) {
+	errs := []string{}
+	for _, resolver := range r {
+		dir, err := resolver.Dir(importPath)
+		if err == nil {
+			return dir, nil
+		}
+		errs = append(errs, err.Error())
+	}
+	return "", fmt.Errorf("%w: %s (%s)", ErrUnresolvedImport, importPath, strings.Join(errs, "; "))
+}
+
+// Replace is a single replace directive of a go.mod
+type Replace struct {
+	Old        string
+	OldVersion string // optional, the replace applies to every version when empty
+	New        string // either a module path or a local directory
+	NewVersion string // empty when New is a local directory
+}
+
+// IsLocal returns true if the replacement is a directory on disk instead of another module
+func (r Replace) IsLocal() bool {
+	return r.NewVersion == "" && (filepath.IsAbs(r.New) || strings.HasPrefix(r.New, "./") || strings.HasPrefix(r.New, "../") || r.New == "." || r.New == "..")
+}
+
+// GoMod is the subset of a go.mod file needed to find the source of an import
+type GoMod struct {
+	Module   string
+	Requires map[string]string // module path -> version
+	Replaces []Replace
+}
+
+// ModuleResolver resolves imports the way the go command does in module mode:
+// the main module, then the vendor directory, then replace directives and finally the module cache
+type ModuleResolver struct {
+	Root     string // root directory of the main module (the one containing go.mod)
+	GoMod    *GoMod
+	ModCache string // module cache directory, usually $GOPATH/pkg/mod
+	Vendor   bool   // true when the main module has a vendor/modules.txt
+}
+
+// FindModule walks up from dir until it finds a go.mod and returns the directory that contains it
+func FindModule(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+
+	for {
+		if _, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil {
+			return dir, nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", ErrMissingGoMod
+		}
+		dir = parent
+	}
+}
+
+// NewModuleResolver reads the go.mod in moduleDir
+func NewModuleResolver(moduleDir string) (*ModuleResolver, error) {
+	moduleDir, err := filepath.Abs(moduleDir)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(moduleDir, "go.mod"))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%w in %s", ErrMissingGoMod, moduleDir)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	goMod, err := ParseGoMod(data)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = os.Stat(filepath.Join(moduleDir, "vendor", "modules.txt"))
+	return &ModuleResolver{
+		Root:     moduleDir,
+		GoMod:    goMod,
+		ModCache: modCacheDir(),
+		Vendor:   err == nil,
+	}, nil
+}
+
+// DefaultResolver resolves imports from the module of the working directory and falls back to $GOPATH
+func DefaultResolver() (Resolver, error) {
+	chain := ChainResolver{}
+	if moduleDir, err := FindModule("."); err == nil {
+		resolver, err := NewModuleResolver(moduleDir)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, resolver)
+	}
+	if gopath := os.Getenv("GOPATH"); gopath != "" {
+		chain = append(chain, &GoPathResolver{GoPath: gopath})
+	}
+	if len(chain) == 0 {
+		return nil, ErrMissingGoPath
+	}
+	return chain, nil
+}
+
+func (r *ModuleResolver) Dir(importPath string) (string, error) {
+	// The main module always resolves to itself
+	if rest, ok := trimModulePath(importPath, r.GoMod.Module); ok {
+		return r.existingDir(filepath.Join(r.Root, rest), importPath)
+	}
+
+	if r.Vendor {
+		dir := filepath.Join(r.Root, "vendor", importPath)
+		if isDir(dir) {
+			return dir, nil
+		}
+	}
+
+	// The longest matching replace wins just like the go command
+	var replace *Replace
+	replaceRest := ""
+	for idx := range r.GoMod.Replaces {
+		rep := r.GoMod.Replaces[idx]
+		if rep.OldVersion != "" && rep.OldVersion != r.GoMod.Requires[rep.Old] {
+			continue
+		}
+		if rest, ok := trimModulePath(importPath, rep.Old); ok && (replace == nil || len(rep.Old) > len(replace.Old)) {
+			replace = &r.GoMod.Replaces[idx]
+			replaceRest = rest
+		}
+	}
+	if replace != nil {
+		if replace.IsLocal() {
+			dir := replace.New
+			if !filepath.IsAbs(dir) {
+				dir = filepath.Join(r.Root, dir)
+			}
+			return r.existingDir(filepath.Join(dir, replaceRest), importPath)
+		}
+		return r.modCacheDir(replace.New, replace.NewVersion, replaceRest, importPath)
+	}
+
+	modulePath := ""
+	for path := range r.GoMod.Requires {
+		if _, ok := trimModulePath(importPath, path); ok && len(path) > len(modulePath) {
+			modulePath = path
+		}
+	}
+	if modulePath != "" {
+		rest, _ := trimModulePath(importPath, modulePath)
+		return r.modCacheDir(modulePath, r.GoMod.Requires[modulePath], rest, importPath)
+	}
+
+	return "", fmt.Errorf("%w: %s is not provided by any module required by %s", ErrUnresolvedImport, importPath, r.GoMod.Module)
+}
+
+func (r *ModuleResolver) modCacheDir(modulePath, version, rest, importPath string) (string, error) {
+	escapedPath, err := escapeModulePath(modulePath)
+	if err != nil {
+		return "", err
+	}
+	escapedVersion, err := escapeModulePath(version)
+	if err != nil {
+		return "", err
+	}
+	return r.existingDir(filepath.Join(r.ModCache, escapedPath+"@"+escapedVersion, rest), importPath)
+}
+
+func (r *ModuleResolver) existingDir(dir string, importPath string) (string, error) {
+	if !isDir(dir) {
+		return "", fmt.Errorf("%w: %s resolved to missing directory %s", ErrUnresolvedImport, importPath, dir)
+	}
+	return dir, nil
+}
+
+// trimModulePath returns the path of an import inside of a module
+func trimModulePath(importPath, modulePath string) (string, bool) {
+	if importPath == modulePath {
+		return "", true
+	}
+	if strings.HasPrefix(importPath, modulePath+"/") {
+		return importPath[len(modulePath)+1:], true
+	}
+	return "", false
+}
+
+// escapeModulePath escapes upper case letters the way the module cache does (e.g. Azure -> !azure)
+func escapeModulePath(path string) (string, error) {
+	var sb strings.Builder
+	for _, r := range path {
+		if r == '!' || r >= unicode.MaxASCII {
+			return "", fmt.Errorf("%w: invalid module path or version %q", ErrInvalidGoMod, path)
+		}
+		if unicode.IsUpper(r) {
+			sb.WriteRune('!')
+			sb.WriteRune(unicode.ToLower(r))
+		} else {
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String(), nil
+}
+
+func modCacheDir() string {
+	if dir := os.Getenv("GOMODCACHE"); dir != "" {
+		return dir
+	}
+	gopath := os.Getenv("GOPATH")
+	if gopath == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		gopath = filepath.Join(home, "go")
+	}
+	// GOPATH can be a list, the module cache is always in the first entry
+	return filepath.Join(filepath.SplitList(gopath)[0], "pkg", "mod")
+}
+
+func isDir(dir string) bool {
+	info, err := os.Stat(dir)
+	return err == nil && info.IsDir()
+}
+
+// ParseGoMod parses the module, require and replace directives of a go.mod, everything else is ignored
+func ParseGoMod(data []byte) (*GoMod, error) {
+	goMod := &GoMod{Requires: map[string]string{}}
+	block := ""
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := scanner.Text()
+		if idx := strings.Index(line, "//"); idx >= 0 {
+			line = line[:idx]
+		}
+		fields, err := goModFields(line)
+		if err != nil {
+			return nil, fmt.Errorf("%w: line %d: %s", ErrInvalidGoMod, lineNum, err)
+		}
+		if len(fields) == 0 {
+			continue
+		}
+
+		if block != "" {
+			if fields[0] == ")" {
+				block = ""
+				continue
+			}
+			fields = append([]string{block}, fields...)
+		} else if len(fields) == 2 && fields[1] == "(" {
+			block = fields[0]
+			continue
+		}
+
+		switch fields[0] {
+		case "module":
+			if len(fields) != 2 {
+				return nil, fmt.Errorf("%w: line %d: expected module path", ErrInvalidGoMod, lineNum)
+			}
+			goMod.Module = fields[1]
+		case "require":
+			if len(fields) != 3 {
+				return nil, fmt.Errorf("%w: line %d: expected module path and version", ErrInvalidGoMod, lineNum)
+			}
+			goMod.Requires[fields[1]] = fields[2]
+		case "replace":
+			replace, err := parseReplace(fields[1:])
+			if err != nil {
+				return nil, fmt.Errorf("%w: line %d: %s", ErrInvalidGoMod, lineNum, err)
+			}
+			goMod.Replaces = append(goMod.Replaces, replace)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if goMod.Module == "" {
+		return nil, fmt.Errorf("%w: missing module directive", ErrInvalidGoMod)
+	}
+	return goMod, nil
+}
+
+// parseReplace parses "old [version] => new [version]"
+func parseReplace(fields []string) (Replace, error) {
+	arrow := -1
+	for idx, field := range fields {
+		if field == "=>" {
+			arrow = idx
+		}
+	}
+	if arrow < 1 || arrow > 2 || len(fields)-arrow < 2 || len(fields)-arrow > 3 {
+		return Replace{}, errors.New("expected replace old [version] => new [version]")
+	}
+
+	replace := Replace{Old: fields[0], New: fields[arrow+1]}
+	if arrow == 2 {
+		replace.OldVersion = fields[1]
+	}
+	if len(fields)-arrow == 3 {
+		replace.NewVersion = fields[arrow+2]
+	}
+	return replace, nil
+}
+
+// goModFields splits a go.mod line into fields, unquoting any quoted fields
+func goModFields(line string) ([]string, error) {
+	fields := []string{}
+	for _, field := range strings.Fields(line) {
+		if strings.HasPrefix(field, "\"") || strings.HasPrefix(field, "`") {
+			unquoted, err := strconv.Unquote(field)
+			if err != nil {
+				return nil, err
+			}
+			field = unquoted
+		}
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
@@ -0,0 +1,109 @@
+package ast
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseGoMod(t *testing.T) {
+	goMod, err := ParseGoMod([]byte(`module example.com/svc // the service
+
+go 1.17
+
+require example.com/lib v1.0.0
+require (
+	example.com/other v1.2.3 // indirect
+	"example.com/quoted" v0.1.0
+)
+
+replace example.com/lib => ../lib
+replace (
+	example.com/other v1.2.3 => example.com/fork v1.2.4
+)
+`))
+	assert.NoError(t, err)
+	assert.Equal(t, "example.com/svc", goMod.Module)
+	assert.Equal(t, map[string]string{
+		"example.com/lib":    "v1.0.0",
+		"example.com/other":  "v1.2.3",
+		"example.com/quoted": "v0.1.0",
+	}, goMod.Requires)
+	assert.Equal(t, []Replace{
+		{Old: "example.com/lib", New: "../lib"},
+		{Old: "example.com/other", OldVersion: "v1.2.3", New: "example.com/fork", NewVersion: "v1.2.4"},
+	}, goMod.Replaces)
+	assert.True(t, goMod.Replaces[0].IsLocal())
+	assert.False(t, goMod.Replaces[1].IsLocal())
+
+	_, err = ParseGoMod([]byte("go 1.17\n"))
+	assert.ErrorIs(t, err, ErrInvalidGoMod)
+}
+
+func TestResolveGoTreeModule(t *testing.T) {
+	root, err := ioutil.TempDir("", "dumptruck")
+	assert.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	writeTestFiles(t, root, map[string]string{
+		"svc/go.mod": "module example.com/svc\n\nrequire (\n\texample.com/lib v1.0.0\n\texample.com/Cached v1.0.0\n)\n\nreplace example.com/lib => ../lib\n",
+		"svc/api/api.go": `package api
+
+import (
+	"example.com/Cached/cached"
+	"example.com/lib/types"
+	"example.com/svc/models"
+	"example.com/vend/thing"
+)
+
+type API interface {
+	Get(m models.M, t types.T, th thing.Thing, c cached.C) error
+}
+`,
+		"svc/api/doc.go":                                  "package api\n",
+		"svc/models/models.go":                            "package models\n\ntype M struct{}\n",
+		"svc/vendor/modules.txt":                          "# example.com/vend v1.0.0\nexample.com/vend/thing\n",
+		"svc/vendor/example.com/vend/thing/thing.go":      "package thing\n\ntype Thing struct{}\n",
+		"lib/go.mod":                                      "module example.com/lib\n",
+		"lib/types/types.go":                              "package types\n\ntype T struct{}\n",
+		"modcache/example.com/!cached@v1.0.0/cached/c.go": "package cached\n\ntype C struct{}\n",
+	})
+
+	resolver, err := NewModuleResolver(filepath.Join(root, "svc"))
+	assert.NoError(t, err)
+	assert.True(t, resolver.Vendor)
+	resolver.ModCache = filepath.Join(root, "modcache")
+
+	node, err := ResolveGoTreeWith(resolver, "example.com/svc/api/api.go", "example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, "example.com/svc/api/api.go", *node.Path.FilePath)
+	assert.Equal(t, []string{"api.go", "doc.go"}, node.GoFiles)
+	assert.Equal(t, 4, len(node.Imports))
+
+	assert.Equal(t, []Package{
+		{ImportPath: "example.com/Cached/cached", Dir: filepath.Join(root, "modcache/example.com/!cached@v1.0.0/cached")},
+		{ImportPath: "example.com/lib/types", Dir: filepath.Join(root, "lib/types")},
+		{ImportPath: "example.com/svc/api", Dir: filepath.Join(root, "svc/api")},
+		{ImportPath: "example.com/svc/models", Dir: filepath.Join(root, "svc/models")},
+		{ImportPath: "example.com/vend/thing", Dir: filepath.Join(root, "svc/vendor/example.com/vend/thing")},
+	}, node.UniquePackages())
+
+	pkgNode, err := ResolveGoPackageWith(resolver, "example.com/svc/api", "example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, 5, len(pkgNode.Imports))
+	assert.Equal(t, 5, len(pkgNode.UniquePackages()))
+
+	_, err = resolver.Dir("example.com/missing")
+	assert.ErrorIs(t, err, ErrUnresolvedImport)
+}
+
+func writeTestFiles(t *testing.T, root string, files map[string]string) {
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		assert.NoError(t, os.MkdirAll(filepath.Dir(path), os.ModePerm))
+		assert.NoError(t, ioutil.WriteFile(path, []byte(content), 0644))
+	}
+}
@@ -3,13 +3,14 @@ package ast
 import (
 	"go/ast"
 	"go/parser"
+	"go/scanner"
 	"go/token"
-	"log"
+	"go/types"
 	"path/filepath"
 	"sort"
-	"strings"
 
 	"code.justin.tv/safety/go2proto/internal"
+	"code.justin.tv/safety/go2proto/internal/diag"
 )
 
 type ParseResult struct {
@@ -17,9 +18,11 @@ type ParseResult struct {
 	Structs     []internal.Struct
 	PodTypedefs []internal.PodTypedef
 	Enums       []internal.EnumAssignment
+	Errors      []internal.GoError
+	Diagnostics diag.Diagnostics // every construct that couldn't be parsed, parsing continues past them
 }
 
-func (r *ParseResult) ApplyOverrides(fieldOverrides []internal.FieldTypeOverride, enumOverrides []internal.EnumOverride) {
+func (r *ParseResult) ApplyOverrides(fieldOverrides []internal.FieldTypeOverride) {
 	for idx := range r.Structs {
 		r.Structs[idx].ApplyOverrides(fieldOverrides)
 	}
@@ -27,24 +30,211 @@ func (r *ParseResult) ApplyOverrides(fieldOverrides []internal.FieldTypeOverride
 	for idx := range r.Funcs {
 		r.Funcs[idx].ApplyOverrides(fieldOverrides)
 	}
+}
+
+// ApplyNaming names the fields of every struct and every enum value after the naming policy, see internal.ApplyNaming
+func (r *ParseResult) ApplyNaming(naming string) {
+	internal.ApplyNaming(r.Structs, r.Enums, naming)
+}
+
+// FilterInterfaces drops every function that was not declared in one of the named interfaces
+func (r *ParseResult) FilterInterfaces(names []string) {
+	keep := map[string]struct{}{}
+	for _, name := range names {
+		keep[name] = struct{}{}
+	}
+
+	funcs := []internal.Function{}
+	for _, f := range r.Funcs {
+		if _, ok := keep[f.Interface]; ok {
+			funcs = append(funcs, f)
+		}
+	}
+	r.Funcs = funcs
+}
+
+// DropPackages drops every struct, typedef, enum and error declared in one of the given go import paths
+func (r *ParseResult) DropPackages(importPaths []string) {
+	drop := map[string]struct{}{}
+	for _, path := range importPaths {
+		drop[path] = struct{}{}
+	}
+	dropped := func(p internal.Path) bool {
+		_, ok := drop[*p.Path]
+		return ok
+	}
+
+	structs := []internal.Struct{}
+	for _, s := range r.Structs {
+		if !dropped(s.Path) {
+			structs = append(structs, s)
+		}
+	}
+	r.Structs = structs
+
+	podTypedefs := []internal.PodTypedef{}
+	for _, pod := range r.PodTypedefs {
+		if !dropped(pod.Path) {
+			podTypedefs = append(podTypedefs, pod)
+		}
+	}
+	r.PodTypedefs = podTypedefs
+
+	enums := []internal.EnumAssignment{}
+	for _, enum := range r.Enums {
+		if !dropped(enum.Path) {
+			enums = append(enums, enum)
+		}
+	}
+	r.Enums = enums
+
+	goErrors := []internal.GoError{}
+	for _, goError := range r.Errors {
+		if !dropped(goError.Path) {
+			goErrors = append(goErrors, goError)
+		}
+	}
+	r.Errors = goErrors
+}
 
+// documentEnums gives every enum value the doc comment of the type of its enum
+func (r *ParseResult) documentEnums() {
+	docs := map[string]string{} // import path.Name -> doc
+	for _, pod := range r.PodTypedefs {
+		docs[*pod.Path.Path+"."+pod.Name] = pod.Doc
+	}
 	for idx := range r.Enums {
-		r.Enums[idx].ApplyOverrides(enumOverrides)
+		r.Enums[idx].TypeDoc = docs[r.Enums[idx].EnumType()]
 	}
 }
 
+// checkMaps resolves the underlying type of named map keys (e.g. type UserID string) from the parsed typedefs
+// and drops every map field whose key can't be a proto map key
+func (r *ParseResult) checkMaps() {
+	underlying := map[string]string{} // import path.Name and package name.Name -> type
+	for _, pod := range r.PodTypedefs {
+		underlying[*pod.Path.Path+"."+pod.Name] = pod.Type
+		underlying[pod.Package+"."+pod.Name] = pod.Type
+	}
+
+	// typedefs of typedefs are followed until a type that isn't declared in the package is found
+	resolveKey := func(key *internal.Field) {
+		if key.Underlying != "" {
+			return
+		}
+		prefix := key.Package + "."
+		name := key.Type
+		if !key.Selector {
+			if key.Path.Path == nil {
+				return
+			}
+			prefix = *key.Path.Path + "."
+			name = prefix + key.Type
+		}
+		for depth := 0; depth < 10; depth++ {
+			t, ok := underlying[name]
+			if !ok {
+				return
+			}
+			key.Underlying = t
+			name = prefix + t
+		}
+	}
+
+	var check func(decl string, fields []*internal.Field) []*internal.Field
+	check = func(decl string, fields []*internal.Field) []*internal.Field {
+		out := []*internal.Field{}
+		for _, f := range fields {
+			if !f.IsMap() {
+				out = append(out, f)
+				continue
+			}
+
+			resolveKey(f.MapKey)
+			if _, ok := f.MapKeyProtoType(); !ok {
+				r.Diagnostics.Add(diag.Warning, f.Pos, decl, "skipping field %s: %s can't be a proto map key, only integer, bool and string types can", f.Name, f.MapKey.Type)
+				continue
+			}
+			if f.MapValue.IsMap() {
+				value := *f.MapValue
+				value.Name = f.Name
+				value.Pos = f.Pos
+				if len(check(decl, []*internal.Field{&value})) == 0 {
+					continue
+				}
+			}
+			out = append(out, f)
+		}
+		return out
+	}
+
+	for idx := range r.Structs {
+		r.Structs[idx].Fields = check(r.Structs[idx].Package+"."+r.Structs[idx].Name, r.Structs[idx].Fields)
+	}
+	for idx := range r.Funcs {
+		r.Funcs[idx].Fields = check(r.Funcs[idx].Interface+"."+r.Funcs[idx].Name, r.Funcs[idx].Fields)
+		r.Funcs[idx].ReturnTypes = check(r.Funcs[idx].Interface+"."+r.Funcs[idx].Name, r.Funcs[idx].ReturnTypes)
+	}
+}
+
+// CheckMessages reports every message that would have two fields with the same proto name or number
+// e.g. because of struct tags, fields without a number are numbered by their position
+func (r *ParseResult) CheckMessages() {
+	for _, s := range r.Structs {
+		decl := s.Package + "." + s.Name
+		names := map[string]string{}
+		numbers := map[int]string{}
+		for idx, f := range s.Fields {
+			number := f.Number
+			if number == 0 {
+				number = idx + 1
+			}
+			if other, ok := names[f.ProtoFieldName()]; ok {
+				r.Diagnostics.Add(diag.Error, f.Pos, decl, "field %s has the same proto name %s as field %s", f.Name, f.ProtoFieldName(), other)
+			} else {
+				names[f.ProtoFieldName()] = f.Name
+			}
+			if other, ok := numbers[number]; ok {
+				r.Diagnostics.Add(diag.Error, f.Pos, decl, "field %s has the same proto field number %d as field %s", f.Name, number, other)
+			} else {
+				numbers[number] = f.Name
+			}
+		}
+	}
+}
+
+// Parse parses every directory in paths, the import path of each directory is deduced from goSrcDir
 func Parse(paths []string, goSrcDir string) ParseResult {
+	pkgs := []Package{}
+	diags := diag.Diagnostics{}
+	for _, globalPath := range paths {
+		path, err := filepath.Rel(goSrcDir, globalPath)
+		if err != nil {
+			diags.Add(diag.Error, token.Position{Filename: globalPath}, "", "%s", err)
+			continue
+		}
+		pkgs = append(pkgs, Package{ImportPath: path, Dir: globalPath})
+	}
+	result := ParsePackages(pkgs)
+	result.Diagnostics = append(diags, result.Diagnostics...)
+	return result
+}
+
+// ParsePackages parses every package in pkgs, e.g. the result of GoNode.UniquePackages
+func ParsePackages(pkgsToParse []Package) ParseResult {
 	functions := []internal.Function{}
 	structs := []internal.Struct{}
 	podTypedefs := []internal.PodTypedef{}
 	assignments := []internal.EnumAssignment{}
+	goErrors := []internal.GoError{}
+	sealed := []sealedInterface{}
+	methods := []methodDecl{}
 	parsedDirs := map[string]struct{}{}
+	diags := diag.Diagnostics{}
 
-	for _, globalPath := range paths {
-		path, err := filepath.Rel(goSrcDir, globalPath)
-		if err != nil {
-			panic(err)
-		}
+	for _, pkgToParse := range pkgsToParse {
+		path := pkgToParse.ImportPath
+		globalPath := pkgToParse.Dir
 		//Create a FileSet to work with
 		// note this is a bunch of files so that's why we have to index them
 		fset := token.NewFileSet()
@@ -55,17 +245,21 @@ func Parse(paths []string, goSrcDir string) ParseResult {
 		}
 
 		//Parse the file and create an AST
+		// files with syntax errors are still partially parsed so keep going with whatever was parsed
 		pkgs, err := parser.ParseDir(fset, globalPath, nil, parser.ParseComments)
-		if err != nil {
-			panic(err)
+		if errList, ok := err.(scanner.ErrorList); ok {
+			for _, e := range errList {
+				diags.Add(diag.Error, e.Pos, "", "%s", e.Msg)
+			}
+		} else if err != nil {
+			diags.Add(diag.Error, token.Position{Filename: globalPath}, "", "%s", err)
+			continue
 		}
 		parsedDirs[globalPath] = struct{}{}
+		r := diag.Reporter{Fset: fset, Diags: &diags}
 		for pkgName, pkg := range pkgs {
 			for globalFilePath, file := range pkg.Files {
-				filePath, err := filepath.Rel(goSrcDir, globalFilePath)
-				if err != nil {
-					panic(err)
-				}
+				filePath := path + "/" + filepath.Base(globalFilePath)
 
 				pathObj := internal.Path{
 					Path:           &path,
@@ -76,87 +270,105 @@ func Parse(paths []string, goSrcDir string) ParseResult {
 
 				for _, n := range file.Decls {
 					switch n.(type) {
+					case *ast.FuncDecl:
+						if goError, ok := errorType(n.(*ast.FuncDecl), pkgName, pathObj); ok {
+							goErrors = append(goErrors, goError)
+						}
+						if method, ok := methodOf(n.(*ast.FuncDecl)); ok {
+							method.path, method.pos = path, r.Position(n)
+							methods = append(methods, method)
+						}
 					case *ast.GenDecl:
 						genDecl := n.(*ast.GenDecl)
-						for _, spec := range genDecl.Specs {
+						if genDecl.Tok == token.VAR {
+							goErrors = append(goErrors, sentinelErrors(genDecl, pkgName, pathObj)...)
+						}
+						// a spec without values repeats the type and values of the previous one e.g. after iota
+						var previous []ast.Expr
+						var previousType ast.Expr
+						for specIdx, spec := range genDecl.Specs {
 							switch spec.(type) {
 							case *ast.ValueSpec:
 								value := spec.(*ast.ValueSpec)
-								funcName := "Type"
-
-								if j, ok := value.Type.(*ast.Ident); ok {
-									funcName = j.Name
+								if value.Values != nil {
+									previous, previousType = value.Values, value.Type
 								}
-
-								enum := internal.EnumAssignment{
-									Path:           pathObj,
-									UnderlyingType: "int", // always int by default
-									Package:        pkgName,
-									FuncName:       funcName,
-									Name:           value.Names[0].Name,
-									Decl:           genDecl,
+								if genDecl.Tok != token.CONST {
+									continue
 								}
-
-								// If values[0] is ast.Ident OR nil then we just append it default
-								if value.Values != nil {
-									if len(value.Values) != 1 {
-										panic("Length of enum block values should be 1")
+								// only constants of a named type are enum values, keepEnums drops the ones whose
+								// type isn't declared with a basic underlying type once every type is parsed
+								for nameIdx, name := range value.Names {
+									typeName := constTypeName(previousType, previous, nameIdx)
+									if name.Name == "_" || typeName == "" {
+										continue
 									}
-									if t, ok := value.Type.(*ast.Ident); ok {
-										enum.FuncName = t.Name
+									enum := internal.EnumAssignment{
+										Path:     pathObj,
+										Package:  pkgName,
+										FuncName: typeName,
+										Name:     name.Name,
+										Doc:      valueDoc(genDecl, value),
+										Pos:      r.Position(name),
 									}
-
-									if v, ok := value.Values[0].(*ast.Ident); ok {
-										if v.Name == "iota" {
-											assignments = append(assignments, enum)
+									if nameIdx < len(previous) {
+										if v, ok := intValue(previous[nameIdx], specIdx); ok {
+											enum.Value = &v
+										} else if v, ok := stringValue(previous[nameIdx], specIdx); ok {
+											enum.StringValue = &v
 										}
 									}
-								} else if value.Values == nil {
 									assignments = append(assignments, enum)
 								}
-								for _, expr := range value.Values {
-									if call, ok := expr.(*ast.CallExpr); ok {
-										if ident, ok := call.Fun.(*ast.Ident); ok {
-											enum.FuncName = ident.Name
-											// skip make
-											if enum.FuncName != "make" {
-												if len(call.Args) > 0 {
-													if lit, ok := call.Args[0].(*ast.BasicLit); ok {
-														enum.UnderlyingType = strings.ToLower(lit.Kind.String())
-													}
-												}
-												assignments = append(assignments, enum)
-											}
-										}
-									} else if lit, ok := expr.(*ast.BasicLit); ok {
-										enum.UnderlyingType = strings.ToLower(lit.Kind.String())
-										assignments = append(assignments, enum)
-									}
-								}
 
 							case *ast.TypeSpec:
 								typeSpec := spec.(*ast.TypeSpec)
+								doc := internal.DocText(typeDoc(genDecl, typeSpec))
 
 								switch typeSpec.Type.(type) {
 								case *ast.InterfaceType:
 									interfaces := typeSpec.Type.(*ast.InterfaceType)
+									// a sealed interface is a message, its methods aren't rpcs
+									if marker := markerMethod(interfaces); marker != "" {
+										sealed = append(sealed, sealedInterface{
+											s:       internal.Struct{Path: pathObj, Package: pkgName, Name: typeSpec.Name.Name, Doc: doc, Sealed: true},
+											marker:  marker,
+											methods: interfaceMethods(interfaces),
+											pos:     r.Position(typeSpec),
+										})
+										continue
+									}
+									service := serviceAnnotation(typeDoc(genDecl, typeSpec), typeSpec.Name.Name)
 									for _, field := range interfaces.Methods.List {
 										if fun, ok := field.Type.(*ast.FuncType); ok {
 											funcName := field.Names[0].Name
-											funcImpl := internal.Function{Name: funcName}
+											funcImpl := internal.Function{
+												Interface:    typeSpec.Name.Name,
+												Service:      service,
+												Name:         funcName,
+												Doc:          internal.DocText(field.Doc, field.Comment),
+												InterfaceDoc: doc,
+												Package:      pkgName,
+												Path:         pathObj,
+											}
+											methodReporter := r.In(pkgName + "." + typeSpec.Name.Name + "." + funcName)
 
-											funcImpl.Fields = internal.ProcessFields(fun.Params.List, pkgName, pathObj)
-											funcImpl.ReturnTypes = internal.ProcessFields(fun.Results.List, pkgName, pathObj)
+											funcImpl.Fields = internal.ProcessFields(fun.Params.List, pkgName, pathObj, methodReporter)
+											funcImpl.ReturnTypes = []*internal.Field{}
+											if fun.Results != nil {
+												funcImpl.ReturnTypes = internal.ProcessFields(fun.Results.List, pkgName, pathObj, methodReporter)
+											}
+											funcImpl.Incomplete = len(funcImpl.Fields) != fun.Params.NumFields() || len(funcImpl.ReturnTypes) != fun.Results.NumFields()
 											functions = append(functions, funcImpl)
 										} else {
-											panic("unexpected non func in interface")
+											r.In(pkgName+"."+typeSpec.Name.Name).Warnf(field, "skipping embedded interface %s, use the types frontend to include its methods", types.ExprString(field.Type))
 										}
 									}
 
 								case *ast.StructType:
 									structType := typeSpec.Type.(*ast.StructType)
-									structImpl := internal.Struct{Path: pathObj, Package: pkgName, Name: typeSpec.Name.Name}
-									structImpl.Fields = internal.ProcessFields(structType.Fields.List, pkgName, pathObj)
+									structImpl := internal.Struct{Path: pathObj, Package: pkgName, Name: typeSpec.Name.Name, Doc: doc}
+									structImpl.Fields = internal.ProcessFields(structType.Fields.List, pkgName, pathObj, r.In(pkgName+"."+typeSpec.Name.Name))
 									structs = append(structs, structImpl)
 								case *ast.Ident:
 									// found a type assignment that is an identifier not a struct
@@ -166,11 +378,23 @@ func Parse(paths []string, goSrcDir string) ParseResult {
 										Path:    pathObj,
 										Name:    typeSpec.Name.Name,
 										Type:    ident.Name,
+										Doc:     doc,
+										Alias:   typeSpec.Assign.IsValid(),
 									})
+								case *ast.MapType:
+									// this type is an alias on a map type, treat it like a struct with a single map
+									structImpl := internal.Struct{Path: pathObj, Package: pkgName, Name: typeSpec.Name.Name, Doc: doc, Wrapper: true}
+									structImpl.Fields = internal.ProcessFields([]*ast.Field{{
+										Names: []*ast.Ident{ast.NewIdent("Entries")},
+										Type:  typeSpec.Type,
+									}}, pkgName, pathObj, r.In(pkgName+"."+typeSpec.Name.Name))
+									if len(structImpl.Fields) > 0 {
+										structs = append(structs, structImpl)
+									}
 								case *ast.ArrayType:
 									arr := typeSpec.Type.(*ast.ArrayType)
 									// this type is an alias on an array type, treat it like an array struct
-									structImpl := internal.Struct{Path: pathObj, Package: pkgName, Name: typeSpec.Name.Name}
+									structImpl := internal.Struct{Path: pathObj, Package: pkgName, Name: typeSpec.Name.Name, Doc: doc, Wrapper: true}
 									/*
 																			Repeated bool
 										Path     string
@@ -191,10 +415,10 @@ func Parse(paths []string, goSrcDir string) ParseResult {
 												Type:     iden.Name,
 											},
 										}
+										structs = append(structs, structImpl)
 									} else {
-										panic("unimplemented")
+										r.In(pkgName+"."+typeSpec.Name.Name).Warnf(typeSpec, "skipping type %s: unsupported slice element %s", typeSpec.Name.Name, types.ExprString(arr.Elt))
 									}
-									structs = append(structs, structImpl)
 								default:
 									/*structImpl := internal.Struct{Path: path, Package: pkgName, Name: typeSpec.Name.Name}
 									structImpl.Fields = append(structImpl.Fields, internal.Field{
@@ -202,7 +426,7 @@ func Parse(paths []string, goSrcDir string) ParseResult {
 										Type: "unknown_type",
 									})
 									structs = append(structs, structImpl)*/
-									log.Println("Ignoring type ", globalPath, pkgName, typeSpec.Name.Name)
+									r.In(pkgName+"."+typeSpec.Name.Name).Warnf(typeSpec, "skipping type %s: unsupported type %s", typeSpec.Name.Name, types.ExprString(typeSpec.Type))
 								}
 							}
 						}
@@ -212,6 +436,8 @@ func Parse(paths []string, goSrcDir string) ParseResult {
 		}
 	}
 
+	structs = append(structs, sealedStructs(sealed, methods, structs, &diags)...)
+
 	sort.Slice(functions, func(i, j int) bool {
 		return functions[i].Name < functions[j].Name
 	})
@@ -220,18 +446,22 @@ func Parse(paths []string, goSrcDir string) ParseResult {
 		return structs[i].Name < structs[j].Name
 	})
 
-	sort.Slice(assignments, func(i, j int) bool {
-		return assignments[i].Name < assignments[j].Name
-	})
-
 	sort.Slice(podTypedefs, func(i, j int) bool {
 		return podTypedefs[i].Name < podTypedefs[j].Name
 	})
 
-	return ParseResult{
+	result := ParseResult{
 		Funcs:       functions,
 		Structs:     structs,
 		PodTypedefs: podTypedefs,
 		Enums:       assignments,
+		Errors:      goErrors,
+		Diagnostics: diags,
 	}
+	result.checkMaps()
+	result.keepEnums()
+	result.sortEnums()
+	result.documentEnums()
+	result.sortErrors()
+	return result
 }
@@ -0,0 +1,206 @@
+package ast
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"code.justin.tv/safety/go2proto/internal/diag"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDiagnostics(t *testing.T) {
+	root, err := ioutil.TempDir("", "dumptruck")
+	assert.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	writeTestFiles(t, root, map[string]string{
+		"api/api.go": `package api
+
+import "io"
+
+type API interface {
+	io.Closer
+	Get(id string) (*Model, error)
+	Fire(id string)
+}
+
+type Model struct {
+	ID     string
+	Handle func()
+	Nested []chan int
+	Tags   map[string]string
+	Scores map[float64]string
+}
+`,
+	})
+
+	result := ParsePackages([]Package{{ImportPath: "example.com/api", Dir: filepath.Join(root, "api")}})
+
+	// every unsupported construct is reported and parsing continues past it
+	assert.Equal(t, 2, len(result.Funcs))
+	assert.Equal(t, 0, len(result.Funcs[0].ReturnTypes))
+	assert.Equal(t, 1, len(result.Structs))
+	assert.Equal(t, 3, len(result.Structs[0].Fields))
+	assert.Equal(t, 0, result.Diagnostics.Count(diag.Error))
+
+	lines := []int{}
+	decls := []string{}
+	result.Diagnostics.Sort()
+	for _, d := range result.Diagnostics {
+		assert.Equal(t, filepath.Join(root, "api/api.go"), d.Pos.Filename)
+		lines = append(lines, d.Pos.Line)
+		decls = append(decls, d.Decl)
+	}
+	assert.Equal(t, []int{6, 13, 14, 16}, lines)
+	assert.Equal(t, []string{"api.API", "api.Model", "api.Model", "api.Model"}, decls)
+}
+
+func TestParseSelectorSlices(t *testing.T) {
+	root, err := ioutil.TempDir("", "dumptruck")
+	assert.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	writeTestFiles(t, root, map[string]string{
+		"api/api.go": `package api
+
+import "time"
+
+type API interface {
+	List() ([]time.Time, error)
+}
+
+type Model struct {
+	Created, Updated []time.Time
+}
+`,
+	})
+
+	result := ParsePackages([]Package{{ImportPath: "example.com/api", Dir: filepath.Join(root, "api")}})
+	assert.Empty(t, result.Diagnostics)
+
+	// an unnamed result is named after its type
+	assert.Equal(t, 1, len(result.Funcs))
+	assert.Equal(t, 2, len(result.Funcs[0].ReturnTypes))
+	assert.Equal(t, "Time", result.Funcs[0].ReturnTypes[0].Name)
+	assert.Equal(t, "time.Time", result.Funcs[0].ReturnTypes[0].Type)
+	assert.True(t, result.Funcs[0].ReturnTypes[0].Repeated)
+
+	// every name of a field is a field
+	assert.Equal(t, 1, len(result.Structs))
+	names := []string{}
+	for _, field := range result.Structs[0].Fields {
+		assert.Equal(t, "time.Time", field.Type)
+		assert.True(t, field.Repeated)
+		names = append(names, field.Name)
+	}
+	assert.Equal(t, []string{"Created", "Updated"}, names)
+}
+
+func TestParseMultiNameFields(t *testing.T) {
+	root, err := ioutil.TempDir("", "dumptruck")
+	assert.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	writeTestFiles(t, root, map[string]string{
+		"svc/go.mod": "module example.com/svc\n\ngo 1.23\n",
+		"svc/api/api.go": `package api
+
+import "time"
+
+type API interface {
+	Do(a, b []string) error
+}
+
+type S struct{ ID string }
+
+type Model struct {
+	A, B []string
+	C, D *time.Time
+	E, F time.Time
+	G, H interface{}
+	I, J []*S
+	K, L []*time.Time
+	M, N *S
+}
+`,
+	})
+
+	packages := []Package{{ImportPath: "example.com/svc/api", Dir: filepath.Join(root, "svc/api")}}
+	for name, result := range map[string]ParseResult{
+		"ast":   ParsePackages(packages),
+		"types": parseTypedModule(t, filepath.Join(root, "svc"), packages),
+	} {
+		assert.Empty(t, result.Diagnostics, name)
+
+		// every name of a field is a field of the same type
+		fields := map[string]string{}
+		for _, s := range result.Structs {
+			if s.Name != "Model" {
+				continue
+			}
+			for _, field := range s.Fields {
+				fields[field.Name] = fmt.Sprintf("%s repeated=%t optional=%t", field.Type, field.Repeated, field.Optional)
+			}
+		}
+		assert.Equal(t, map[string]string{
+			"A": "string repeated=true optional=false",
+			"B": "string repeated=true optional=false",
+			"C": "time.Time repeated=false optional=true",
+			"D": "time.Time repeated=false optional=true",
+			"E": "time.Time repeated=false optional=false",
+			"F": "time.Time repeated=false optional=false",
+			"G": "interface repeated=false optional=false",
+			"H": "interface repeated=false optional=false",
+			"I": "S repeated=true optional=true",
+			"J": "S repeated=true optional=true",
+			"K": "time.Time repeated=true optional=true",
+			"L": "time.Time repeated=true optional=true",
+			"M": "S repeated=false optional=true",
+			"N": "S repeated=false optional=true",
+		}, fields, name)
+
+		// so a method with a parameter of several names can be called with its fields
+		if assert.Equal(t, 1, len(result.Funcs), name) {
+			assert.False(t, result.Funcs[0].Incomplete, name)
+			params := []string{}
+			for _, field := range result.Funcs[0].Fields {
+				params = append(params, field.Name)
+			}
+			assert.Equal(t, []string{"a", "b"}, params, name)
+		}
+	}
+}
+
+func TestCheckMessages(t *testing.T) {
+	root, err := ioutil.TempDir("", "dumptruck")
+	assert.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	writeTestFiles(t, root, map[string]string{
+		"api/api.go": `package api
+
+type Model struct {
+	UserID string ` + "`json:\"user_id\"`" + `
+	User   string ` + "`proto:\"user_id,1\"`" + `
+	Count  int
+}
+`,
+	})
+
+	result := ParsePackages([]Package{{ImportPath: "example.com/api", Dir: filepath.Join(root, "api")}})
+	assert.Empty(t, result.Diagnostics)
+
+	result.CheckMessages()
+	msgs := []string{}
+	for _, d := range result.Diagnostics {
+		assert.Equal(t, diag.Error, d.Severity)
+		msgs = append(msgs, d.Msg)
+	}
+	assert.Equal(t, []string{
+		"field User has the same proto name user_id as field UserID",
+		"field User has the same proto field number 1 as field UserID",
+	}, msgs)
+}
@@ -4,7 +4,6 @@ import (
 	"errors"
 	"fmt"
 	"io/ioutil"
-	"os"
 	"path/filepath"
 	"sort"
 	"strings"
@@ -19,6 +18,7 @@ import (
 var (
 	ErrMissingGoPath = errors.New("missing GOPATH")
 	ErrNotAnImport   = errors.New("unexpected non import")
+	ErrEmptyPackage  = errors.New("package has no go files")
 )
 
 // GoNode is a single go file in a Go file import dependency tree
@@ -49,6 +49,18 @@ func (g *GoNode) ImportsForPath(filepath string) []*ImportNode {
 	return []*ImportNode{}
 }
 
+// FindPackage returns a node of the package with the given import path anywhere in the tree
+func (g *GoNode) FindPackage(importPath string) *GoNode {
+	flattenedNodes := map[string]*GoNode{}
+	crawl(g, flattenedNodes)
+	for _, node := range flattenedNodes {
+		if *node.Path.Path == importPath {
+			return node
+		}
+	}
+	return nil
+}
+
 func FindImport(selector string, imports []*ImportNode) *ImportNode {
 	for _, imp := range imports {
 		if imp.Alias != nil && *imp.Alias == selector {
@@ -97,6 +109,34 @@ func (g *GoNode) UniqueLocalPaths() []string {
 	return out
 }
 
+// Package is the import path of a go package and the directory its source lives in
+type Package struct {
+	ImportPath string
+	Dir        string
+}
+
+// UniquePackages returns every package in the tree sorted by import path
+func (g *GoNode) UniquePackages() []Package {
+	out := []Package{}
+	m := map[string]*GoNode{}
+	crawl(g, m)
+
+	seen := map[string]struct{}{}
+	for _, node := range m {
+		if _, ok := seen[*node.Path.Path]; !ok {
+			seen[*node.Path.Path] = struct{}{}
+			out = append(out, Package{
+				ImportPath: *node.Path.Path,
+				Dir:        *node.Path.GlobalPath,
+			})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].ImportPath < out[j].ImportPath
+	})
+	return out
+}
+
 func crawl(g *GoNode, m map[string]*GoNode) {
 	if _, ok := m[*g.Path.FilePath]; !ok {
 		m[*g.Path.FilePath] = g
@@ -123,21 +163,83 @@ func goFilesInDir(dir string) ([]string, error) {
 }
 
 // ResolveGoTree builds a package tree (assuming the import tree is non cyclic)
-// **Note that the path of inputFile is RELATIVE to your $GOPATH already and
-// we deduce the global path from $GOPATH
+// **Note that inputFile is the import path of the package followed by the file name e.g
+// code.justin.tv/safety/go2proto/dummy/interface.go and we deduce the global path from
+// the module of the working directory or $GOPATH
 func ResolveGoTree(inputFile string, rootPath string) (*GoNode, error) {
-	return resolveGoTree(inputFile, rootPath, map[string]*GoNode{})
+	resolver, err := DefaultResolver()
+	if err != nil {
+		return nil, err
+	}
+	return ResolveGoTreeWith(resolver, inputFile, rootPath)
 }
 
-func resolveGoTree(inputFile string, rootPath string, cache map[string]*GoNode) (*GoNode, error) {
-	gopath := os.Getenv("GOPATH")
-	if gopath == "" {
-		return nil, ErrMissingGoPath
+// ResolveGoTreeWith is ResolveGoTree with the imports resolved by resolver
+func ResolveGoTreeWith(resolver Resolver, inputFile string, rootPath string) (*GoNode, error) {
+	return resolveGoTree(inputFile, rootPath, resolver, map[string]*GoNode{})
+}
+
+// ResolveGoPackage builds a package tree for every file in a package
+// the first file of the package is the root and the other files of the package are added as its imports
+// **Note that the pkgPath is an import path like in ResolveGoTree
+func ResolveGoPackage(pkgPath string, rootPath string) (*GoNode, error) {
+	resolver, err := DefaultResolver()
+	if err != nil {
+		return nil, err
+	}
+	return ResolveGoPackageWith(resolver, pkgPath, rootPath)
+}
+
+// ResolveGoPackageWith is ResolveGoPackage with the imports resolved by resolver
+func ResolveGoPackageWith(resolver Resolver, pkgPath string, rootPath string) (*GoNode, error) {
+	dir, err := resolver.Dir(pkgPath)
+	if err != nil {
+		return nil, err
+	}
+
+	goFiles, err := goFilesInDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	pkgFiles := []string{}
+	for _, fileName := range goFiles {
+		if !strings.HasSuffix(fileName, "_test.go") {
+			pkgFiles = append(pkgFiles, fileName)
+		}
+	}
+	if len(pkgFiles) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrEmptyPackage, pkgPath)
+	}
+
+	cache := map[string]*GoNode{}
+	root, err := resolveGoTree(pkgPath+"/"+pkgFiles[0], rootPath, resolver, cache)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, fileName := range pkgFiles[1:] {
+		node, err := resolveGoTree(pkgPath+"/"+fileName, rootPath, resolver, cache)
+		if err != nil {
+			return nil, err
+		}
+		root.AddImport(&ImportNode{
+			Path:   pkgPath,
+			GoNode: node,
+		})
+	}
+	return root, nil
+}
+
+func resolveGoTree(inputFile string, rootPath string, resolver Resolver, cache map[string]*GoNode) (*GoNode, error) {
+	currentPath := filepath.Dir(inputFile) // e.g code.justin.tv/safety/go2proto/dummy
+	globPath, err := resolver.Dir(currentPath)
+	if err != nil {
+		return nil, err
 	}
 
 	fset := token.NewFileSet()
-	globalPath := fmt.Sprintf("%s/src/", gopath) // e.g /Users/gritaras/src/
-	globalFilePath := globalPath + inputFile
+	globalFilePath := filepath.Join(globPath, filepath.Base(inputFile))
 
 	// Check the cache
 	if _, ok := cache[globalFilePath]; ok {
@@ -149,13 +251,11 @@ func resolveGoTree(inputFile string, rootPath string, cache map[string]*GoNode)
 		return nil, err
 	}
 
-	currentPath := filepath.Dir(inputFile) // e.g code.justin.tv/safety/go2proto/dummy
-	goFiles, err := goFilesInDir(globalPath + currentPath)
+	goFiles, err := goFilesInDir(globPath)
 	if err != nil {
 		return nil, err
 	}
 
-	globPath := filepath.Dir(globalFilePath)
 	pathObj := internal.Path{
 		Path:           &currentPath,
 		GlobalPath:     &globPath,
@@ -187,7 +287,11 @@ func resolveGoTree(inputFile string, rootPath string, cache map[string]*GoNode)
 
 						// Check that the import is a relative import
 						if strings.Contains(astImportPath, rootPath) {
-							filesInImportPath, err := goFilesInDir(globalPath + astImportPath)
+							importDir, err := resolver.Dir(astImportPath)
+							if err != nil {
+								return nil, err
+							}
+							filesInImportPath, err := goFilesInDir(importDir)
 							if err != nil {
 								return nil, err
 							}
@@ -199,7 +303,7 @@ func resolveGoTree(inputFile string, rootPath string, cache map[string]*GoNode)
 
 							// Recursively process all of the files in the import's package
 							for _, fileName := range filesInImportPath {
-								importNode, err := resolveGoTree(astImportPath+"/"+fileName, rootPath, cache)
+								importNode, err := resolveGoTree(astImportPath+"/"+fileName, rootPath, resolver, cache)
 								if err != nil {
 									return nil, err
 								}
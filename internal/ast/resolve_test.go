@@ -14,7 +14,7 @@ func TestResolveDependencyTree(t *testing.T) {
 
 	assert.NotNil(t, parentPkg.Path.FilePath)
 	assert.Equal(t, "code.justin.tv/safety/go2proto/dummy/interface.go", *parentPkg.Path.FilePath)
-	assert.Equal(t, parentPkg.GoFiles, []string{"interface.go"})
+	assert.Equal(t, parentPkg.GoFiles, []string{"errors.go", "interface.go"})
 	assert.Equal(t, 3, len(parentPkg.Imports))
 
 	assert.NotNil(t, parentPkg.Imports[0].GoNode.Path.FilePath)
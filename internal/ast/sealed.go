@@ -0,0 +1,214 @@
+package ast
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"sort"
+	"strings"
+
+	"code.justin.tv/safety/go2proto/internal"
+	"code.justin.tv/safety/go2proto/internal/diag"
+)
+
+// sealedInterface is an interface with a marker method, the structs of its package with all of its methods
+// implement it
+type sealedInterface struct {
+	s       internal.Struct // the message of the interface, its fields are added once the methods are parsed
+	marker  string
+	methods map[string]string // name -> signature of the methods declared in the interface
+	pos     token.Position
+}
+
+// methodDecl is a method of a type of a package that could implement a sealed interface
+type methodDecl struct {
+	path      string // import path of the package
+	name      string // name of the type
+	method    string
+	signature string
+	pointer   bool // the method has a pointer receiver, only *T has it
+	pos       token.Position
+}
+
+// isMarker returns true for the unexported methods without parameters and results that seal an interface e.g.
+// isShape(), only the types of the package of the interface can implement them
+func isMarker(name string, fun *ast.FuncType) bool {
+	return !ast.IsExported(name) && name != "_" && fun.Params.NumFields() == 0 && fun.Results.NumFields() == 0
+}
+
+// markerMethod returns the name of the marker method of an interface, empty when it isn't sealed
+func markerMethod(iface *ast.InterfaceType) string {
+	for _, method := range iface.Methods.List {
+		if fun, ok := method.Type.(*ast.FuncType); ok && len(method.Names) == 1 && isMarker(method.Names[0].Name, fun) {
+			return method.Names[0].Name
+		}
+	}
+	return ""
+}
+
+// interfaceMethods returns the signatures of the methods declared in an interface by name, the methods of
+// embedded interfaces are only known to the types frontend
+func interfaceMethods(iface *ast.InterfaceType) map[string]string {
+	methods := map[string]string{}
+	for _, method := range iface.Methods.List {
+		if fun, ok := method.Type.(*ast.FuncType); ok && len(method.Names) == 1 {
+			methods[method.Names[0].Name] = signature(fun)
+		}
+	}
+	return methods
+}
+
+// signature returns the types of the parameters and results of a func without their names e.g. (int, ...string) error
+func signature(fun *ast.FuncType) string {
+	list := func(fields *ast.FieldList) string {
+		out := []string{}
+		if fields != nil {
+			for _, field := range fields.List {
+				for idx := 0; idx < len(field.Names) || idx == 0; idx++ {
+					out = append(out, types.ExprString(field.Type))
+				}
+			}
+		}
+		return strings.Join(out, ", ")
+	}
+	return "(" + list(fun.Params) + ") (" + list(fun.Results) + ")"
+}
+
+// methodOf returns the type and method of a method declaration
+func methodOf(funcDecl *ast.FuncDecl) (methodDecl, bool) {
+	if funcDecl.Recv == nil || len(funcDecl.Recv.List) != 1 {
+		return methodDecl{}, false
+	}
+	recv := funcDecl.Recv.List[0].Type
+	pointer := false
+	if star, ok := recv.(*ast.StarExpr); ok {
+		recv, pointer = star.X, true
+	}
+	ident, ok := recv.(*ast.Ident)
+	if !ok {
+		return methodDecl{}, false
+	}
+	return methodDecl{name: ident.Name, method: funcDecl.Name.Name, signature: signature(funcDecl.Type), pointer: pointer}, true
+}
+
+// methodSets finds the methods of the types of the parsed packages
+type methodSets struct {
+	declared map[string][]methodDecl    // import path.type -> the methods declared with it as receiver
+	structs  map[string]internal.Struct // import path.struct -> struct
+}
+
+// methodSet returns the signatures of the methods of the type key (of *key when pointer) by name with the ones
+// promoted from the structs of its package it embeds, the methods of other packages aren't known to the ast frontend
+func (m *methodSets) methodSet(key string, pointer bool, seen map[string]bool) map[string]string {
+	set := map[string]string{}
+	if seen[key] {
+		return set
+	}
+	seen[key] = true
+	defer delete(seen, key)
+
+	if s, ok := m.structs[key]; ok {
+		for _, field := range s.Fields {
+			if !field.Embedded || field.Selector {
+				continue
+			}
+			// the pointer methods of an embedded struct are promoted to *T or when it's embedded as a pointer
+			for name, sig := range m.methodSet(*s.Path.Path+"."+field.Type, pointer || field.Optional, seen) {
+				set[name] = sig
+			}
+		}
+	}
+	// the methods declared with the type shadow the promoted ones
+	for _, method := range m.declared[key] {
+		if pointer || !method.pointer {
+			set[method.method] = method.signature
+		}
+	}
+	return set
+}
+
+// implements returns true when a method set has every method of a sealed interface
+func (iface *sealedInterface) implements(set map[string]string) bool {
+	for name, sig := range iface.methods {
+		if set[name] != sig {
+			return false
+		}
+	}
+	return true
+}
+
+// sealedStructs returns the message of every sealed interface with a field for each struct of its package that
+// implements it. Other types implementing it can't be a message and are reported, so is an interface nothing
+// implements
+func sealedStructs(sealed []sealedInterface, methods []methodDecl, structs []internal.Struct, diags *diag.Diagnostics) []internal.Struct {
+	sets := &methodSets{declared: map[string][]methodDecl{}, structs: map[string]internal.Struct{}}
+	keys := []string{} // the structs and then the other types with methods in the order they were parsed
+	for _, s := range structs {
+		key := *s.Path.Path + "." + s.Name
+		sets.structs[key] = s
+		keys = append(keys, key)
+	}
+	for _, method := range methods {
+		key := method.path + "." + method.name
+		if _, ok := sets.declared[key]; !ok {
+			if _, ok := sets.structs[key]; !ok {
+				keys = append(keys, key)
+			}
+		}
+		sets.declared[key] = append(sets.declared[key], method)
+	}
+
+	out := []internal.Struct{}
+	for _, iface := range sealed {
+		s := iface.s
+		decl := s.Package + "." + s.Name
+		for _, key := range keys {
+			if !strings.HasPrefix(key, *s.Path.Path+".") || strings.Contains(key[len(*s.Path.Path)+1:], ".") {
+				continue
+			}
+			// *T has every method of T, T only the ones with a value receiver
+			value := iface.implements(sets.methodSet(key, false, map[string]bool{}))
+			if !value && !iface.implements(sets.methodSet(key, true, map[string]bool{})) {
+				continue
+			}
+			name := key[len(*s.Path.Path)+1:]
+			if _, ok := sets.structs[key]; !ok {
+				pos := sets.declared[key][0].pos
+				for _, method := range sets.declared[key] {
+					if method.method == iface.marker {
+						pos = method.pos
+					}
+				}
+				diags.Add(diag.Warning, pos, decl, "skipping %s: only structs can implement the sealed interface %s", name, s.Name)
+				continue
+			}
+			s.Fields = append(s.Fields, sealedVariant(s, name, !value))
+		}
+		if len(s.Fields) == 0 {
+			diags.Add(diag.Warning, iface.pos, decl, "skipping sealed interface %s: no struct has its method %s", s.Name, iface.marker)
+			continue
+		}
+		sort.Slice(s.Fields, func(i, j int) bool {
+			return s.Fields[i].Name < s.Fields[j].Name
+		})
+		out = append(out, s)
+	}
+	return out
+}
+
+// sealedVariant returns the field of the message of a sealed interface that holds the struct name
+func sealedVariant(s internal.Struct, name string, pointer bool) *internal.Field {
+	return &internal.Field{Path: s.Path, Package: s.Package, Name: name, Type: name, Optional: pointer}
+}
+
+// typedMarker returns the name of the marker method of a type checked interface, empty when it isn't sealed
+func typedMarker(iface *types.Interface) string {
+	for idx := 0; idx < iface.NumMethods(); idx++ {
+		method := iface.Method(idx)
+		sig := method.Type().(*types.Signature)
+		if !method.Exported() && sig.Params().Len() == 0 && sig.Results().Len() == 0 {
+			return method.Name()
+		}
+	}
+	return ""
+}
@@ -0,0 +1,107 @@
+package ast
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"code.justin.tv/safety/go2proto/internal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSealed(t *testing.T) {
+	root, err := ioutil.TempDir("", "dumptruck")
+	assert.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	writeTestFiles(t, root, map[string]string{
+		"svc/go.mod": "module example.com/svc\n\ngo 1.23\n",
+		"svc/shapes/shapes.go": `package shapes
+
+type Shape interface {
+	isShape()
+	Area() float64
+}
+
+type Square struct{ Side float64 }
+
+func (Square) isShape()        {}
+func (s Square) Area() float64 { return s.Side * s.Side }
+
+type Circle struct{ Radius float64 }
+
+func (*Circle) isShape()        {}
+func (c *Circle) Area() float64 { return 3 * c.Radius * c.Radius }
+
+// the methods of embedded structs are promoted, the pointer methods of Circle only to *Disc
+type Ring struct{ *Circle }
+
+type Disc struct{ Circle }
+
+type Tile struct{ Square }
+
+// the marker alone doesn't implement Shape, neither does an Area of another type
+type Partial struct{}
+
+func (Partial) isShape() {}
+
+type Wrong struct{}
+
+func (Wrong) isShape() {}
+func (Wrong) Area() int { return 0 }
+
+type Label string
+
+func (Label) isShape()      {}
+func (Label) Area() float64 { return 0 }
+
+// nothing has the marker, so it isn't a message
+type Empty interface {
+	isEmpty()
+}
+
+// exported methods don't seal an interface
+type Open interface {
+	Area() float64
+}
+`,
+	})
+
+	packages := []Package{{ImportPath: "example.com/svc/shapes", Dir: filepath.Join(root, "svc/shapes")}}
+	for name, result := range map[string]ParseResult{
+		"ast":   ParsePackages(packages),
+		"types": parseTypedModule(t, filepath.Join(root, "svc"), packages),
+	} {
+		messages := []string{}
+		for _, d := range result.Diagnostics {
+			messages = append(messages, d.Msg)
+		}
+		assert.ElementsMatch(t, []string{
+			"skipping Label: only structs can implement the sealed interface Shape",
+			"skipping sealed interface Empty: no struct has its method isEmpty",
+		}, messages, name)
+
+		var shape *internal.Struct
+		for idx := range result.Structs {
+			if result.Structs[idx].Sealed {
+				assert.Nil(t, shape, name)
+				shape = &result.Structs[idx]
+			}
+		}
+		if assert.NotNil(t, shape, name) {
+			assert.Equal(t, "Shape", shape.Name, name)
+			variants := map[string]bool{} // name -> only the pointer implements Shape
+			for _, field := range shape.Fields {
+				variants[field.Type] = field.Optional
+			}
+			assert.Equal(t, map[string]bool{"Circle": true, "Disc": true, "Ring": false, "Square": false, "Tile": false}, variants, name)
+		}
+		// the methods of a sealed interface aren't rpcs, Open is still an interface of functions
+		interfaces := []string{}
+		for _, fun := range result.Funcs {
+			interfaces = append(interfaces, fun.Interface)
+		}
+		assert.Equal(t, []string{"Open"}, interfaces, name)
+	}
+}
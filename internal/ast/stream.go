@@ -0,0 +1,100 @@
+package ast
+
+import (
+	"code.justin.tv/safety/go2proto/internal"
+	"code.justin.tv/safety/go2proto/internal/diag"
+)
+
+// CheckStreams keeps the channels, configured iterators and callbacks of every function that can stream its
+// requests or responses and drops and reports the others, along with every stream that isn't a method parameter
+// or result. A function streams its requests with at most one parameter and its responses with at most one result
+// or callback, the other parameters are sent with the first request and nothing but an error can be returned
+// with streamed responses. Functions with a dropped parameter or result are marked Incomplete
+func (r *ParseResult) CheckStreams(cfg internal.StreamConfig) {
+	supported := func(f *internal.Field) bool {
+		return f.Stream == internal.StreamChan ||
+			(f.Stream == internal.StreamIterator && cfg.IsIterator(f.Iterator)) ||
+			(f.Stream == internal.StreamCallback && cfg.Callbacks)
+	}
+	unsupported := func(f *internal.Field) string {
+		if f.Stream == internal.StreamCallback {
+			return "callbacks aren't streams unless streams.callbacks is set"
+		}
+		return f.Iterator + " isn't one of the iterators in streams.iterators"
+	}
+
+	for idx := range r.Structs {
+		s := &r.Structs[idx]
+		fields := []*internal.Field{}
+		for _, f := range s.Fields {
+			if f.Stream != "" {
+				r.Diagnostics.Add(diag.Warning, f.Pos, s.Package+"."+s.Name, "skipping field %s: only method parameters and results can stream", f.Name)
+				continue
+			}
+			fields = append(fields, f)
+		}
+		s.Fields = fields
+	}
+
+	for idx := range r.Funcs {
+		f := &r.Funcs[idx]
+		decl := f.Interface + "." + f.Name
+
+		var client, server *internal.Field
+		params := []*internal.Field{}
+		for _, param := range f.Fields {
+			switch {
+			case param.Stream == "":
+			case !supported(param):
+				r.Diagnostics.Add(diag.Warning, param.Pos, decl, "skipping parameter %s: %s", param.Name, unsupported(param))
+				f.Incomplete = true
+				continue
+			case param.Stream == internal.StreamCallback && server != nil:
+				r.Diagnostics.Add(diag.Error, param.Pos, decl, "skipping parameter %s: the responses are already streamed by %s", param.Name, server.Name)
+				f.Incomplete = true
+				continue
+			case param.Stream == internal.StreamCallback:
+				server = param
+			case client != nil:
+				r.Diagnostics.Add(diag.Error, param.Pos, decl, "skipping parameter %s: the requests are already streamed by %s", param.Name, client.Name)
+				f.Incomplete = true
+				continue
+			default:
+				client = param
+			}
+			params = append(params, param)
+		}
+		f.Fields = params
+
+		results := []*internal.Field{}
+		for _, result := range f.ReturnTypes {
+			switch {
+			case result.Stream == internal.StreamCallback:
+				r.Diagnostics.Add(diag.Warning, result.Pos, decl, "skipping result %s: only a parameter can be a callback", result.Name)
+				f.Incomplete = true
+				continue
+			case result.Stream != "" && !supported(result):
+				r.Diagnostics.Add(diag.Warning, result.Pos, decl, "skipping result %s: %s", result.Name, unsupported(result))
+				f.Incomplete = true
+				continue
+			case result.Stream != "" && server != nil:
+				r.Diagnostics.Add(diag.Error, result.Pos, decl, "skipping result %s: the responses are already streamed by %s", result.Name, server.Name)
+				f.Incomplete = true
+				continue
+			case result.Stream != "":
+				server = result
+			}
+			results = append(results, result)
+		}
+
+		f.ReturnTypes = []*internal.Field{}
+		for _, result := range results {
+			if server != nil && result != server && result.Type != "error" {
+				r.Diagnostics.Add(diag.Warning, result.Pos, decl, "skipping result %s: only an error can be returned with the streamed %s", result.Name, server.Name)
+				f.Incomplete = true
+				continue
+			}
+			f.ReturnTypes = append(f.ReturnTypes, result)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package ast
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"code.justin.tv/safety/go2proto/internal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckStreams(t *testing.T) {
+	root, err := ioutil.TempDir("", "dumptruck")
+	assert.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	writeTestFiles(t, root, map[string]string{
+		"svc/go.mod": "module example.com/svc\n\ngo 1.23\n",
+		"svc/api/api.go": `package api
+
+import (
+	"context"
+	"iter"
+)
+
+type Event struct {
+	ID     string
+	Events <-chan string
+}
+
+type API interface {
+	Watch(ctx context.Context, id string) (<-chan *Event, error)
+	Upload(ctx context.Context, bucket string, events <-chan Event) (int64, error)
+	Chat(ctx context.Context, in iter.Seq[string]) (iter.Seq[string], error)
+	Each(ctx context.Context, fn func(Event) error) error
+	Pages(ctx context.Context) (Pages[Event], error)
+	Twice(ctx context.Context, a <-chan string, b <-chan string) (<-chan string, int, error)
+}
+
+type Pages[T any] struct {
+	Items []T
+}
+`,
+	})
+
+	packages := []Package{{ImportPath: "example.com/svc/api", Dir: filepath.Join(root, "svc/api")}}
+	for name, result := range map[string]ParseResult{
+		"ast":   ParsePackages(packages),
+		"types": parseTypedModule(t, filepath.Join(root, "svc"), packages),
+	} {
+		result.Diagnostics = nil
+		result.CheckStreams(internal.StreamConfig{Iterators: []string{"iter.Seq"}, Callbacks: true})
+
+		streams := map[string][2]string{}
+		for _, f := range result.Funcs {
+			kinds := [2]string{}
+			if client := f.ClientStream(); client != nil {
+				kinds[0] = client.Stream + " " + client.Type
+			}
+			if server := f.ServerStream(); server != nil {
+				kinds[1] = server.Stream + " " + server.Type
+			}
+			streams[f.Name] = kinds
+			if f.Name == "Watch" {
+				assert.True(t, f.ServerStream().Optional, name)
+			}
+			if f.Name == "Upload" {
+				assert.Equal(t, 3, len(f.Fields), name)
+				assert.Equal(t, 2, len(f.ReturnTypes), name)
+				assert.False(t, f.Incomplete, name)
+			}
+			if f.Name == "Twice" {
+				assert.Equal(t, 2, len(f.Fields), name)
+				assert.Equal(t, 2, len(f.ReturnTypes), name)
+				// the go method can't be called without the dropped parameter and result
+				assert.True(t, f.Incomplete, name)
+			}
+		}
+		assert.Equal(t, map[string][2]string{
+			"Watch":  {"", "chan Event"},
+			"Upload": {"chan Event", ""},
+			"Chat":   {"iterator string", "iterator string"},
+			"Each":   {"", "callback Event"},
+			"Pages":  {"", ""},
+			"Twice":  {"chan string", "chan string"},
+		}, streams, name)
+
+		msgs := []string{}
+		for _, d := range result.Diagnostics {
+			msgs = append(msgs, d.Decl+": "+d.Msg)
+		}
+		assert.ElementsMatch(t, []string{
+			"api.Event: skipping field Events: only method parameters and results can stream",
+			"API.Pages: skipping result Event: Pages isn't one of the iterators in streams.iterators",
+			"API.Twice: skipping parameter b: the requests are already streamed by a",
+			"API.Twice: skipping result int: only an error can be returned with the streamed string",
+		}, msgs, name)
+	}
+}
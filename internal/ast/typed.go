@@ -0,0 +1,559 @@
+package ast
+
+import (
+	"go/ast"
+	"go/constant"
+	"go/token"
+	"go/types"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"code.justin.tv/safety/go2proto/internal"
+	"code.justin.tv/safety/go2proto/internal/diag"
+	"golang.org/x/tools/go/packages"
+)
+
+// typedSpec is a type declaration and the file it is declared in
+type typedSpec struct {
+	spec *ast.TypeSpec
+	path internal.Path
+}
+
+// typedPackage is a parsed and type checked package
+type typedPackage struct {
+	importPath string
+	dir        string
+	fileNames  []string // sorted global file paths
+	files      map[string]*ast.File
+	pkg        *types.Package
+	info       *types.Info
+	specs      map[*types.TypeName]typedSpec
+}
+
+// typedLoader type checks packages with go/packages so the go command finds them and their imports the way a build
+// in the module would, with go.work, module versions, build tags and cgo
+type typedLoader struct {
+	fset *token.FileSet
+	pkgs map[string]*typedPackage // import path -> package
+}
+
+// loadTyped loads every package of pkgs from the module in dir, errors of the go command and parse and type errors
+// are reported to diags and the packages are still transpiled as far as they could be checked
+func loadTyped(dir string, pkgs []Package, diags *diag.Diagnostics) *typedLoader {
+	l := &typedLoader{fset: token.NewFileSet(), pkgs: map[string]*typedPackage{}}
+	if len(pkgs) == 0 {
+		return l
+	}
+
+	patterns := make([]string, len(pkgs))
+	for idx, pkg := range pkgs {
+		patterns[idx] = pkg.ImportPath
+	}
+	cfg := &packages.Config{
+		Mode: packages.NeedName | packages.NeedFiles | packages.NeedTypes | packages.NeedSyntax | packages.NeedTypesInfo,
+		Dir:  dir,
+		Fset: l.fset,
+	}
+	loaded, err := packages.Load(cfg, patterns...)
+	if err != nil {
+		diags.Add(diag.Error, token.Position{Filename: dir}, "", "%s", err)
+		return l
+	}
+
+	for _, loadedPkg := range loaded {
+		// the go command compiles the package as well, its output repeats the parse and type errors of the package
+		checked := false
+		for _, e := range loadedPkg.Errors {
+			checked = checked || e.Kind != packages.ListError
+		}
+		for _, e := range loadedPkg.Errors {
+			if checked && e.Kind == packages.ListError {
+				continue
+			}
+			diags.Add(diag.Error, errorPosition(e.Pos), loadedPkg.PkgPath, "%s", e.Msg)
+		}
+		if loadedPkg.Types == nil || len(loadedPkg.Syntax) == 0 {
+			continue
+		}
+		l.add(loadedPkg)
+	}
+	return l
+}
+
+// add indexes the files and type declarations of a loaded package
+func (l *typedLoader) add(loadedPkg *packages.Package) {
+	pkg := &typedPackage{
+		importPath: loadedPkg.PkgPath,
+		files:      map[string]*ast.File{},
+		pkg:        loadedPkg.Types,
+		info:       loadedPkg.TypesInfo,
+		specs:      map[*types.TypeName]typedSpec{},
+	}
+	for _, file := range loadedPkg.Syntax {
+		// the position of the package clause is in the go file even for the files cgo generates
+		globalFilePath := l.fset.Position(file.Package).Filename
+		pkg.fileNames = append(pkg.fileNames, globalFilePath)
+		pkg.files[globalFilePath] = file
+		pkg.dir = filepath.Dir(globalFilePath)
+	}
+	sort.Strings(pkg.fileNames)
+
+	for _, globalFilePath := range pkg.fileNames {
+		pathObj := pkg.pathFor(globalFilePath)
+		for _, decl := range pkg.files[globalFilePath].Decls {
+			if genDecl, ok := decl.(*ast.GenDecl); ok && genDecl.Tok == token.TYPE {
+				for _, spec := range genDecl.Specs {
+					typeSpec := spec.(*ast.TypeSpec)
+					if obj, ok := pkg.info.Defs[typeSpec.Name].(*types.TypeName); ok {
+						pkg.specs[obj] = typedSpec{spec: typeSpec, path: pathObj}
+					}
+				}
+			}
+		}
+	}
+	l.pkgs[pkg.importPath] = pkg
+}
+
+// errorPosition parses the file:line:col position of a go/packages error, any part of it can be missing
+func errorPosition(pos string) token.Position {
+	parts := strings.Split(pos, ":")
+	position := token.Position{Filename: pos}
+	// the file name itself can contain a colon (e.g. a windows drive) so the line and column are parsed from the end
+	for idx := 0; idx < 2 && len(parts) > 1; idx++ {
+		n, err := strconv.Atoi(parts[len(parts)-1])
+		if err != nil {
+			break
+		}
+		position.Column, position.Line = position.Line, n
+		parts = parts[:len(parts)-1]
+		position.Filename = strings.Join(parts, ":")
+	}
+	if position.Filename == "-" {
+		position.Filename = ""
+	}
+	return position
+}
+
+func (p *typedPackage) pathFor(globalFilePath string) internal.Path {
+	importPath := p.importPath
+	dir := p.dir
+	filePath := importPath + "/" + filepath.Base(globalFilePath)
+	return internal.Path{
+		Path:           &importPath,
+		FilePath:       &filePath,
+		GlobalPath:     &dir,
+		GlobalFilePath: &globalFilePath,
+	}
+}
+
+// ParseTyped is the type checked alternative to ParsePackages, every package is loaded with go/packages from the
+// module in dir (the working directory when empty) so selectors, aliases, named types and underlying types are
+// resolved exactly instead of being guessed from the syntax
+func ParseTyped(dir string, pkgs []Package) ParseResult {
+	p := &typedParser{}
+	p.loader = loadTyped(dir, pkgs, &p.result.Diagnostics)
+	for _, pkgToParse := range pkgs {
+		pkg, ok := p.loader.pkgs[pkgToParse.ImportPath]
+		if !ok {
+			continue
+		}
+		p.parsePackage(pkg)
+	}
+
+	result := p.result
+	result.checkMaps()
+	result.sortEnums()
+	result.documentEnums()
+	result.sortErrors()
+	sort.Slice(result.Funcs, func(i, j int) bool {
+		return result.Funcs[i].Name < result.Funcs[j].Name
+	})
+	sort.Slice(result.Structs, func(i, j int) bool {
+		return result.Structs[i].Name < result.Structs[j].Name
+	})
+	sort.Slice(result.PodTypedefs, func(i, j int) bool {
+		return result.PodTypedefs[i].Name < result.PodTypedefs[j].Name
+	})
+	return result
+}
+
+type typedParser struct {
+	loader *typedLoader
+	result ParseResult
+}
+
+// reporter reports diagnostics for the named declaration
+func (p *typedParser) reporter(decl string) diag.Reporter {
+	return diag.Reporter{Fset: p.loader.fset, Decl: decl, Diags: &p.result.Diagnostics}
+}
+
+func (p *typedParser) parsePackage(pkg *typedPackage) {
+	pkgName := pkg.pkg.Name()
+	for _, globalFilePath := range pkg.fileNames {
+		pathObj := pkg.pathFor(globalFilePath)
+		for _, decl := range pkg.files[globalFilePath].Decls {
+			genDecl, ok := decl.(*ast.GenDecl)
+			if !ok {
+				continue
+			}
+
+			switch genDecl.Tok {
+			case token.CONST:
+				p.parseConsts(pkg, genDecl, pathObj)
+			case token.VAR:
+				p.parseErrors(pkg, genDecl, pathObj)
+			case token.TYPE:
+				for _, spec := range genDecl.Specs {
+					p.parseTypeSpec(pkg, pkgName, genDecl, spec.(*ast.TypeSpec), pathObj)
+				}
+				p.parseErrors(pkg, genDecl, pathObj)
+			}
+		}
+	}
+}
+
+// parseConsts adds every constant of a type declared in the package that has an underlying basic type as an enum value
+func (p *typedParser) parseConsts(pkg *typedPackage, genDecl *ast.GenDecl, pathObj internal.Path) {
+	// specs without a type or values repeat the previous spec (e.g. iota blocks)
+	var typeExpr ast.Expr
+	var values []ast.Expr
+	for _, spec := range genDecl.Specs {
+		valueSpec := spec.(*ast.ValueSpec)
+		if valueSpec.Type != nil || len(valueSpec.Values) > 0 {
+			typeExpr = valueSpec.Type
+			values = valueSpec.Values
+		}
+
+		for idx, name := range valueSpec.Names {
+			obj, ok := pkg.info.Defs[name].(*types.Const)
+			if !ok || name.Name == "_" {
+				continue
+			}
+
+			var typeName *types.TypeName
+			if typeExpr != nil {
+				typeName = typeNameOf(pkg.info, typeExpr)
+			} else if idx < len(values) {
+				// conversions like Country("Canada") name their type in the call
+				if call, ok := values[idx].(*ast.CallExpr); ok && len(call.Args) == 1 {
+					typeName = typeNameOf(pkg.info, call.Fun)
+				}
+			}
+			if typeName == nil {
+				if named, ok := obj.Type().(*types.Named); ok {
+					typeName = named.Obj()
+				}
+			}
+			// the constants of an alias are constants of the aliased type, not values of an enum
+			if typeName == nil || typeName.Pkg() != pkg.pkg || typeName.IsAlias() {
+				continue
+			}
+
+			basic, ok := typeName.Type().Underlying().(*types.Basic)
+			if !ok || basic.Info()&(types.IsInteger|types.IsString) == 0 {
+				continue
+			}
+
+			enum := internal.EnumAssignment{
+				Package:        pkg.pkg.Name(),
+				Path:           pathObj,
+				Name:           name.Name,
+				FuncName:       typeName.Name(),
+				UnderlyingType: basic.Name(),
+				Doc:            valueDoc(genDecl, valueSpec),
+				Pos:            p.loader.fset.Position(name.Pos()),
+			}
+			switch obj.Val().Kind() {
+			case constant.Int:
+				if v, exact := constant.Int64Val(obj.Val()); exact {
+					value := int(v)
+					enum.Value = &value
+				}
+			case constant.String:
+				value := constant.StringVal(obj.Val())
+				enum.StringValue = &value
+			}
+			p.result.Enums = append(p.result.Enums, enum)
+		}
+	}
+}
+
+func (p *typedParser) parseTypeSpec(pkg *typedPackage, pkgName string, genDecl *ast.GenDecl, typeSpec *ast.TypeSpec, pathObj internal.Path) {
+	obj, ok := pkg.info.Defs[typeSpec.Name].(*types.TypeName)
+	if !ok {
+		return
+	}
+	r := p.reporter(pkgName + "." + obj.Name())
+	doc := internal.DocText(typeDoc(genDecl, typeSpec))
+
+	switch t := typeSpec.Type.(type) {
+	case *ast.InterfaceType:
+		// a sealed interface is a message, its methods aren't rpcs
+		if iface, ok := obj.Type().Underlying().(*types.Interface); ok && typedMarker(iface) != "" {
+			p.parseSealed(pkg, obj, iface, internal.Struct{Path: pathObj, Package: pkgName, Name: obj.Name(), Doc: doc, Sealed: true}, r)
+			return
+		}
+		service := serviceAnnotation(typeDoc(genDecl, typeSpec), obj.Name())
+		for _, f := range p.interfaceMethods(pkg, obj.Name(), t, pathObj, r) {
+			f.Service = service
+			f.InterfaceDoc = doc
+			f.Package, f.Path = pkgName, pathObj
+			p.result.Funcs = append(p.result.Funcs, f)
+		}
+	case *ast.StructType:
+		p.result.Structs = append(p.result.Structs, internal.Struct{
+			Path:    pathObj,
+			Package: pkgName,
+			Name:    obj.Name(),
+			Doc:     doc,
+			Fields:  p.fields(pkg, t.Fields, pathObj, r),
+		})
+	case *ast.MapType:
+		// this type is an alias on a map type, treat it like a struct with a single map
+		field := &internal.Field{Path: pathObj, Package: pkgName, Name: "Entries", Pos: r.Position(typeSpec)}
+		if !p.fieldType(pkg, t, field) {
+			r.Warnf(typeSpec, "skipping type %s: unsupported map %s", obj.Name(), types.ExprString(t))
+		} else {
+			p.result.Structs = append(p.result.Structs, internal.Struct{
+				Path:    pathObj,
+				Package: pkgName,
+				Name:    obj.Name(),
+				Doc:     doc,
+				Fields:  []*internal.Field{field},
+				Wrapper: true,
+			})
+		}
+	case *ast.ArrayType:
+		// this type is an alias on an array type, treat it like an array struct
+		field := &internal.Field{Path: pathObj, Package: pkgName, Name: "Elements"}
+		if !p.fieldType(pkg, t, field) {
+			r.Warnf(typeSpec, "skipping type %s: unsupported slice element %s", obj.Name(), types.ExprString(t.Elt))
+		} else {
+			p.result.Structs = append(p.result.Structs, internal.Struct{
+				Path:    pathObj,
+				Package: pkgName,
+				Name:    obj.Name(),
+				Doc:     doc,
+				Fields:  []*internal.Field{field},
+				Wrapper: true,
+			})
+		}
+	default:
+		if basic, ok := obj.Type().Underlying().(*types.Basic); ok {
+			p.result.PodTypedefs = append(p.result.PodTypedefs, internal.PodTypedef{
+				Package: pkgName,
+				Path:    pathObj,
+				Name:    obj.Name(),
+				Doc:     doc,
+				Type:    basic.Name(),
+				Alias:   obj.IsAlias(),
+			})
+		} else {
+			r.Warnf(typeSpec, "skipping type %s: unsupported type %s", obj.Name(), types.ExprString(typeSpec.Type))
+		}
+	}
+}
+
+// parseSealed adds the message of a sealed interface with a field for every struct of the package implementing it,
+// the struct or a pointer to it
+func (p *typedParser) parseSealed(pkg *typedPackage, obj *types.TypeName, iface *types.Interface, s internal.Struct, r diag.Reporter) {
+	scope := pkg.pkg.Scope()
+	for _, name := range scope.Names() {
+		typeName, ok := scope.Lookup(name).(*types.TypeName)
+		if !ok || typeName.IsAlias() || types.IsInterface(typeName.Type()) {
+			continue
+		}
+		value := types.Implements(typeName.Type(), iface)
+		if !value && !types.Implements(types.NewPointer(typeName.Type()), iface) {
+			continue
+		}
+		if _, ok := typeName.Type().Underlying().(*types.Struct); !ok {
+			p.result.Diagnostics.Add(diag.Warning, p.loader.fset.Position(typeName.Pos()), r.Decl, "skipping %s: only structs can implement the sealed interface %s", name, obj.Name())
+			continue
+		}
+		s.Fields = append(s.Fields, sealedVariant(s, name, !value))
+	}
+	if len(s.Fields) == 0 {
+		p.result.Diagnostics.Add(diag.Warning, p.loader.fset.Position(obj.Pos()), r.Decl, "skipping sealed interface %s: no struct has its method %s", obj.Name(), typedMarker(iface))
+		return
+	}
+	p.result.Structs = append(p.result.Structs, s)
+}
+
+// interfaceMethods returns the methods of an interface including the methods of embedded interfaces
+func (p *typedParser) interfaceMethods(pkg *typedPackage, ifaceName string, iface *ast.InterfaceType, pathObj internal.Path, r diag.Reporter) []internal.Function {
+	functions := []internal.Function{}
+	for _, method := range iface.Methods.List {
+		if fun, ok := method.Type.(*ast.FuncType); ok {
+			for _, name := range method.Names {
+				methodReporter := r.In(r.Decl + "." + name.Name)
+				f := internal.Function{
+					Interface:   ifaceName,
+					Name:        name.Name,
+					Doc:         internal.DocText(method.Doc, method.Comment),
+					Fields:      p.fields(pkg, fun.Params, pathObj, methodReporter),
+					ReturnTypes: p.fields(pkg, fun.Results, pathObj, methodReporter),
+				}
+				f.Incomplete = len(f.Fields) != fun.Params.NumFields() || len(f.ReturnTypes) != fun.Results.NumFields()
+				functions = append(functions, f)
+			}
+			continue
+		}
+
+		// embedded interfaces can only be flattened when their source was loaded
+		embeddedPkg, embedded, ok := p.embeddedInterface(pkg, method.Type)
+		if !ok {
+			r.Warnf(method, "skipping embedded interface %s, its source isn't part of the input", types.ExprString(method.Type))
+			continue
+		}
+		functions = append(functions, p.interfaceMethods(embeddedPkg, ifaceName, embedded.spec.Type.(*ast.InterfaceType), embedded.path, r)...)
+	}
+	return functions
+}
+
+// embeddedInterface finds the declaration of an embedded interface in the loaded packages
+func (p *typedParser) embeddedInterface(pkg *typedPackage, expr ast.Expr) (*typedPackage, typedSpec, bool) {
+	typeName := typeNameOf(pkg.info, expr)
+	if typeName == nil || typeName.Pkg() == nil {
+		return nil, typedSpec{}, false
+	}
+	embeddedPkg, ok := p.loader.pkgs[typeName.Pkg().Path()]
+	if !ok {
+		return nil, typedSpec{}, false
+	}
+	embedded, ok := embeddedPkg.specs[typeName]
+	if !ok {
+		return nil, typedSpec{}, false
+	}
+	_, ok = embedded.spec.Type.(*ast.InterfaceType)
+	return embeddedPkg, embedded, ok
+}
+
+func (p *typedParser) fields(pkg *typedPackage, list *ast.FieldList, pathObj internal.Path, r diag.Reporter) []*internal.Field {
+	outFields := []*internal.Field{}
+	if list == nil {
+		return outFields
+	}
+
+	for _, field := range list.List {
+		start := len(outFields)
+		names := []string{}
+		for _, name := range field.Names {
+			names = append(names, name.Name)
+		}
+		// If there are no names then we just use a default field an assume a name that is the type
+		if len(names) == 0 {
+			names = append(names, "")
+		}
+
+		for _, name := range names {
+			outField := &internal.Field{Path: pathObj, Package: pkg.pkg.Name(), Name: name, Pos: r.Position(field)}
+			if !p.fieldType(pkg, field.Type, outField) {
+				r.Warnf(field, "skipping field %s: unsupported type %s", name, types.ExprString(field.Type))
+				continue
+			}
+			if outField.Name == "" {
+				outField.Name = outField.Type[strings.LastIndex(outField.Type, ".")+1:]
+				outField.Embedded = true
+			}
+			outFields = append(outFields, outField)
+		}
+		outFields = append(outFields[:start], internal.ApplyFieldTag(field, internal.ApplyFieldDoc(field, outFields[start:]), r)...)
+	}
+	return outFields
+}
+
+// fieldType fills in the type of a field from its type expression, it returns false for unsupported types
+func (p *typedParser) fieldType(pkg *typedPackage, expr ast.Expr, field *internal.Field) bool {
+	switch e := expr.(type) {
+	case *ast.ParenExpr:
+		return p.fieldType(pkg, e.X, field)
+	case *ast.StarExpr:
+		field.Optional = true
+		return p.fieldType(pkg, e.X, field)
+	case *ast.Ellipsis:
+		field.Repeated = true
+		field.Variadic = true
+		return p.fieldType(pkg, e.Elt, field)
+	case *ast.ArrayType:
+		if basic, ok := pkg.info.TypeOf(e.Elt).(*types.Basic); ok && basic.Kind() == types.Byte {
+			field.Type = "bytes"
+			return true
+		}
+		field.Repeated = true
+		return p.fieldType(pkg, e.Elt, field)
+	case *ast.InterfaceType:
+		field.Type = "interface"
+		return true
+	case *ast.MapType:
+		field.Type = "map"
+		field.MapKey = &internal.Field{Path: field.Path, Package: field.Package}
+		field.MapValue = &internal.Field{Path: field.Path, Package: field.Package}
+		return p.fieldType(pkg, e.Key, field.MapKey) && p.fieldType(pkg, e.Value, field.MapValue)
+	case *ast.ChanType, *ast.FuncType, *ast.IndexExpr:
+		// streams can't be nested, see internal.StreamElem
+		kind, iterator, elem, ok := internal.StreamElem(e)
+		if !ok || field.Stream != "" || field.Repeated {
+			return false
+		}
+		field.Stream, field.Iterator = kind, iterator
+		return p.fieldType(pkg, elem, field)
+	case *ast.Ident, *ast.SelectorExpr:
+		typeName := typeNameOf(pkg.info, e)
+		if typeName == nil {
+			field.Type = types.ExprString(e)
+			return true
+		}
+		namedField(pkg, typeName, field)
+		return true
+	default:
+		field.Type = types.ExprString(expr)
+		return true
+	}
+}
+
+// namedField resolves a field that refers to a type by name
+func namedField(pkg *typedPackage, typeName *types.TypeName, field *internal.Field) {
+	switch {
+	case typeName.Pkg() == nil: // predeclared e.g. string, error or any
+		field.Type = typeName.Name()
+		if typeName.Name() == "any" {
+			field.Type = "interface"
+		}
+		return
+	case typeName.Pkg() == pkg.pkg:
+		field.Type = typeName.Name()
+	default:
+		field.Selector = true
+		field.Package = typeName.Pkg().Name()
+		field.ImportPath = typeName.Pkg().Path()
+		field.Type = typeName.Pkg().Name() + "." + typeName.Name()
+	}
+
+	switch underlying := typeName.Type().Underlying().(type) {
+	case *types.Basic:
+		field.Underlying = underlying.Name()
+	case *types.Interface:
+		field.Underlying = "interface"
+	}
+}
+
+// typeNameOf returns the type an identifier or selector expression refers to, nil if it isn't a type
+func typeNameOf(info *types.Info, expr ast.Expr) *types.TypeName {
+	var ident *ast.Ident
+	switch e := expr.(type) {
+	case *ast.ParenExpr:
+		return typeNameOf(info, e.X)
+	case *ast.Ident:
+		ident = e
+	case *ast.SelectorExpr:
+		ident = e.Sel
+	default:
+		return nil
+	}
+
+	typeName, _ := info.Uses[ident].(*types.TypeName)
+	return typeName
+}
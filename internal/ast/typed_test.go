@@ -0,0 +1,205 @@
+package ast
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"code.justin.tv/safety/go2proto/internal"
+	"code.justin.tv/safety/go2proto/internal/diag"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTyped(t *testing.T) {
+	root, err := ioutil.TempDir("", "dumptruck")
+	assert.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	writeTestFiles(t, root, map[string]string{
+		"svc/go.mod": "module example.com/svc\n\ngo 1.23\n",
+		"svc/api/api.go": `package api
+
+import (
+	"time"
+
+	m "example.com/svc/models"
+)
+
+type Base interface {
+	Ping() error
+}
+
+type API interface {
+	Base
+	Get(id m.ID, at time.Time, colors ...m.Color) (*m.Model, error)
+}
+`,
+		"svc/models/models.go": `package models
+
+type ID = string
+
+type Color int
+
+const (
+	Red Color = iota
+	Green
+)
+
+const Blue = Color(5)
+
+const NotAnEnum = 3
+
+type Model struct {
+	ID
+	Color Color
+	Data  []byte
+	Tags   map[Color][]string
+	Scores map[float64]string
+}
+
+type Models []*Model
+`,
+	})
+
+	resolver, err := NewModuleResolver(filepath.Join(root, "svc"))
+	assert.NoError(t, err)
+	node, err := ResolveGoTreeWith(resolver, "example.com/svc/api/api.go", "example.com")
+	assert.NoError(t, err)
+
+	result := parseTypedModule(t, filepath.Join(root, "svc"), node.UniquePackages())
+
+	// the map with a float key is skipped with a warning
+	assert.Equal(t, 1, len(result.Diagnostics))
+	assert.Equal(t, diag.Warning, result.Diagnostics[0].Severity)
+	assert.Equal(t, "models.Model", result.Diagnostics[0].Decl)
+	assert.Equal(t, 21, result.Diagnostics[0].Pos.Line)
+
+	assert.Equal(t, 3, len(result.Funcs))
+	get := result.Funcs[0]
+	assert.Equal(t, "Get", get.Name)
+	assert.Equal(t, "API", get.Interface)
+	assert.Equal(t, 3, len(get.Fields))
+
+	id := get.Fields[0]
+	assert.True(t, id.Selector)
+	assert.Equal(t, "models", id.Package)
+	assert.Equal(t, "example.com/svc/models", id.ImportPath)
+	assert.Equal(t, "models.ID", id.Type)
+	assert.Equal(t, "string", id.Underlying)
+	assert.Equal(t, &internal.Selector{Package: "models", Name: "ID", ImportPath: "example.com/svc/models"}, id.ComputeSelector())
+
+	assert.Equal(t, "time.Time", get.Fields[1].Type)
+	assert.Equal(t, "time", get.Fields[1].ImportPath)
+	assert.True(t, get.Fields[2].Repeated)
+	assert.True(t, get.Fields[2].Variadic)
+	assert.Equal(t, "int", get.Fields[2].Underlying)
+	assert.True(t, get.ReturnTypes[0].Optional)
+	assert.Equal(t, "models.Model", get.ReturnTypes[0].Type)
+	assert.Equal(t, "error", get.ReturnTypes[1].Type)
+
+	// embedded interfaces are flattened into the embedding interface
+	interfaces := []string{}
+	for _, fn := range result.Funcs[1:] {
+		assert.Equal(t, "Ping", fn.Name)
+		interfaces = append(interfaces, fn.Interface)
+	}
+	assert.ElementsMatch(t, []string{"API", "Base"}, interfaces)
+
+	assert.Equal(t, 2, len(result.Structs))
+	model := result.Structs[0]
+	assert.Equal(t, "Model", model.Name)
+	assert.Equal(t, 4, len(model.Fields))
+	assert.Equal(t, "ID", model.Fields[0].Name)
+	assert.Equal(t, "ID", model.Fields[0].Type)
+	assert.Equal(t, "Color", model.Fields[1].Type)
+	assert.Equal(t, "bytes", model.Fields[2].Type)
+	assert.True(t, model.Fields[3].IsMap())
+	assert.Equal(t, "int", model.Fields[3].MapKey.Underlying)
+	assert.True(t, model.Fields[3].MapValue.Repeated)
+	assert.True(t, model.Fields[3].MapValueNeedsWrapper())
+	assert.Equal(t, "Models", result.Structs[1].Name)
+	assert.True(t, result.Structs[1].Fields[0].Repeated)
+	assert.True(t, result.Structs[1].Fields[0].Optional)
+
+	assert.Equal(t, 2, len(result.PodTypedefs))
+	assert.Equal(t, "Color", result.PodTypedefs[0].Name)
+	assert.Equal(t, "int", result.PodTypedefs[0].Type)
+	assert.False(t, result.PodTypedefs[0].Alias)
+	assert.Equal(t, "ID", result.PodTypedefs[1].Name)
+	assert.Equal(t, "string", result.PodTypedefs[1].Type)
+	assert.True(t, result.PodTypedefs[1].Alias)
+
+	enums := []string{}
+	values := []int{}
+	for _, enum := range result.Enums {
+		assert.Equal(t, "Color", enum.FuncName)
+		assert.Equal(t, "int", enum.UnderlyingType)
+		enums = append(enums, enum.Name)
+		values = append(values, *enum.Value)
+	}
+	assert.Equal(t, []string{"Red", "Green", "Blue"}, enums)
+	assert.Equal(t, []int{0, 1, 5}, values)
+}
+
+func TestParseTypedDiagnostics(t *testing.T) {
+	root, err := ioutil.TempDir("", "dumptruck")
+	assert.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	writeTestFiles(t, root, map[string]string{
+		"svc/go.mod":     "module example.com/svc\n\ngo 1.23\n",
+		"svc/api/api.go": "package api\n\ntype API interface {\n\tGet(Missing) error\n\tPut(string) error\n}\n",
+	})
+
+	result := parseTypedModule(t, filepath.Join(root, "svc"), []Package{{ImportPath: "example.com/svc/api", Dir: filepath.Join(root, "svc/api")}})
+
+	// type errors are reported but everything else is still parsed
+	assert.Equal(t, 2, len(result.Funcs))
+	assert.Equal(t, 1, result.Diagnostics.Count(diag.Error))
+	assert.Equal(t, filepath.Join(root, "svc/api/api.go"), result.Diagnostics[0].Pos.Filename)
+	assert.Equal(t, 4, result.Diagnostics[0].Pos.Line)
+	assert.Error(t, result.Diagnostics.Err(diag.Error))
+}
+
+func TestParseTypedWorkspace(t *testing.T) {
+	root, err := ioutil.TempDir("", "dumptruck")
+	assert.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	writeTestFiles(t, root, map[string]string{
+		"go.work":    "go 1.23\n\nuse (\n\t./svc\n\t./lib\n)\n",
+		"svc/go.mod": "module example.com/svc\n\ngo 1.23\n",
+		"svc/api/api.go": `package api
+
+import "example.com/lib/types"
+
+type API interface {
+	Get(id types.ID) error
+}
+`,
+		// excluded by its build constraint, otherwise API would be declared twice
+		"svc/api/api_other.go": "//go:build never\n\npackage api\n\ntype API interface{}\n",
+		"lib/go.mod":           "module example.com/lib\n\ngo 1.23\n",
+		"lib/types/types.go":   "package types\n\ntype ID string\n",
+	})
+
+	// the go command finds the other module of the workspace without a replace directive
+	result := parseTypedModule(t, filepath.Join(root, "svc"), []Package{{ImportPath: "example.com/svc/api", Dir: filepath.Join(root, "svc/api")}})
+	assert.Empty(t, result.Diagnostics)
+	if assert.Equal(t, 1, len(result.Funcs)) {
+		id := result.Funcs[0].Fields[0]
+		assert.Equal(t, "types.ID", id.Type)
+		assert.Equal(t, "example.com/lib/types", id.ImportPath)
+		assert.Equal(t, "string", id.Underlying)
+	}
+}
+
+// parseTypedModule type checks pkgs of the test module in dir, the go command loads it in module mode without
+// touching the network even when the tests run in GOPATH mode
+func parseTypedModule(t *testing.T, dir string, pkgs []Package) ParseResult {
+	t.Setenv("GO111MODULE", "on")
+	t.Setenv("GOFLAGS", "")
+	t.Setenv("GOPROXY", "off")
+	return ParseTyped(dir, pkgs)
+}
@@ -0,0 +1,275 @@
+package compat
+
+import (
+	"bytes"
+	"fmt"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"code.justin.tv/safety/go2proto/internal/diag"
+)
+
+// ParseAll parses sources keyed by their path in the output directory, dir is prepended to the paths in positions
+func ParseAll(sources map[string]string, dir string) ([]*File, error) {
+	names := []string{}
+	for name := range sources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	files := []*File{}
+	for _, name := range names {
+		f, err := Parse(filepath.ToSlash(name), filepath.Join(dir, name), sources[name])
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+	}
+	return files, nil
+}
+
+// LoadDir parses every .proto file under dir
+func LoadDir(dir string) ([]*File, error) {
+	sources := map[string]string{}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || filepath.Ext(path) != ".proto" {
+			return err
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		sources[rel] = string(data)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ParseAll(sources, dir)
+}
+
+// LoadGitRef parses every .proto file under dir as it was committed at ref
+func LoadGitRef(ref, dir string) ([]*File, error) {
+	out, err := git(dir, "ls-tree", "-r", "--name-only", ref, "--", ".")
+	if err != nil {
+		return nil, err
+	}
+
+	sources := map[string]string{}
+	for _, name := range strings.Split(strings.TrimSpace(out), "\n") {
+		if filepath.Ext(name) != ".proto" {
+			continue
+		}
+		src, err := git(dir, "show", ref+":./"+name)
+		if err != nil {
+			return nil, err
+		}
+		sources[name] = src
+	}
+	return ParseAll(sources, ref+":"+dir)
+}
+
+func git(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git %s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return string(out), nil
+}
+
+// Compare reports every change from baseline to current that breaks clients generated from baseline, such as
+// removing or renumbering a field without reserving it, changing its type or changing a package or an rpc
+func Compare(baseline, current []*File) diag.Diagnostics {
+	c := &checker{}
+	files := map[string]*File{}
+	for _, f := range current {
+		files[f.Name] = f
+	}
+	for _, old := range baseline {
+		f, ok := files[old.Name]
+		if !ok {
+			c.errorf(old.Pos, old.Package, "%s was removed", old.Name)
+			continue
+		}
+		if f.Package != old.Package {
+			c.errorf(f.Pos, f.Package, "package %s was renamed to %s", old.Package, f.Package)
+		}
+		c.file(old, f)
+	}
+	return c.diags
+}
+
+type checker struct {
+	diags diag.Diagnostics
+}
+
+func (c *checker) errorf(pos token.Position, decl string, format string, args ...interface{}) {
+	c.diags.Add(diag.Error, pos, decl, format, args...)
+}
+
+func (c *checker) file(old, f *File) {
+	messages := map[string]*Message{}
+	for _, m := range f.Messages {
+		messages[m.Name] = m
+	}
+	for _, om := range old.Messages {
+		if m, ok := messages[om.Name]; ok {
+			c.message(old, f, om, m)
+		} else {
+			c.errorf(om.Pos, old.Package+"."+om.Name, "message %s was removed", om.Name)
+		}
+	}
+
+	enums := map[string]*Enum{}
+	for _, e := range f.Enums {
+		enums[e.Name] = e
+	}
+	for _, oe := range old.Enums {
+		if e, ok := enums[oe.Name]; ok {
+			c.enum(old, oe, e)
+		} else {
+			c.errorf(oe.Pos, old.Package+"."+oe.Name, "enum %s was removed", oe.Name)
+		}
+	}
+
+	services := map[string]*Service{}
+	for _, s := range f.Services {
+		services[s.Name] = s
+	}
+	for _, oldService := range old.Services {
+		if s, ok := services[oldService.Name]; ok {
+			c.service(old, f, oldService, s)
+		} else {
+			c.errorf(oldService.Pos, old.Package+"."+oldService.Name, "service %s was removed", oldService.Name)
+		}
+	}
+}
+
+func (c *checker) message(oldFile, file *File, old, m *Message) {
+	decl := file.Package + "." + m.Name
+	byNumber := map[int]*Field{}
+	for _, f := range m.Fields {
+		byNumber[f.Number] = f
+	}
+
+	for _, of := range old.Fields {
+		f, ok := byNumber[of.Number]
+		if !ok {
+			if !m.Reserved.HasNumber(of.Number) {
+				c.errorf(m.Pos, decl, "field %s = %d was removed without reserving its number", of.Name, of.Number)
+			}
+			continue
+		}
+
+		oldType, newType := fieldType(oldFile, of), fieldType(file, f)
+		switch {
+		case f.Name != of.Name && oldType != newType:
+			c.errorf(f.Pos, decl, "number %d of field %s %s is reused by field %s %s", of.Number, oldType, of.Name, newType, f.Name)
+		case f.Name != of.Name:
+			c.errorf(f.Pos, decl, "field %s = %d was renamed to %s", of.Name, of.Number, f.Name)
+		case oldType != newType:
+			c.errorf(f.Pos, decl, "field %s changed type from %s to %s", f.Name, oldType, newType)
+		}
+	}
+
+	for _, f := range m.Fields {
+		if old.Reserved.HasNumber(f.Number) {
+			c.errorf(f.Pos, decl, "field %s uses the reserved number %d", f.Name, f.Number)
+		}
+	}
+}
+
+func (c *checker) enum(oldFile *File, old, e *Enum) {
+	decl := oldFile.Package + "." + e.Name
+	byNumber := map[int]*EnumValue{}
+	for _, v := range e.Values {
+		byNumber[v.Number] = v
+	}
+
+	for _, ov := range old.Values {
+		v, ok := byNumber[ov.Number]
+		switch {
+		case !ok && !e.Reserved.HasNumber(ov.Number):
+			c.errorf(e.Pos, decl, "enum value %s = %d was removed without reserving its number", ov.Name, ov.Number)
+		case ok && v.Name != ov.Name:
+			c.errorf(v.Pos, decl, "enum value %s = %d was renamed to %s", ov.Name, ov.Number, v.Name)
+		}
+	}
+
+	for _, v := range e.Values {
+		if old.Reserved.HasNumber(v.Number) {
+			c.errorf(v.Pos, decl, "enum value %s uses the reserved number %d", v.Name, v.Number)
+		}
+	}
+}
+
+func (c *checker) service(oldFile, file *File, old, s *Service) {
+	decl := file.Package + "." + s.Name
+	rpcs := map[string]*RPC{}
+	for _, r := range s.RPCs {
+		rpcs[r.Name] = r
+	}
+
+	for _, or := range old.RPCs {
+		r, ok := rpcs[or.Name]
+		if !ok {
+			c.errorf(s.Pos, decl, "rpc %s was removed", or.Name)
+			continue
+		}
+		if oldSig, sig := signature(oldFile, or), signature(file, r); oldSig != sig {
+			c.errorf(r.Pos, decl, "rpc %s changed from %s to %s", r.Name, oldSig, sig)
+		}
+	}
+}
+
+// scalars are the proto types that are never qualified with a package
+var scalars = map[string]struct{}{
+	"double": {}, "float": {}, "int32": {}, "int64": {}, "uint32": {}, "uint64": {}, "sint32": {}, "sint64": {},
+	"fixed32": {}, "fixed64": {}, "sfixed32": {}, "sfixed64": {}, "bool": {}, "string": {}, "bytes": {},
+}
+
+// qualify returns the full name of a type used in f
+func qualify(f *File, t string) string {
+	if strings.HasPrefix(t, "map<") {
+		parts := strings.SplitN(strings.TrimSuffix(strings.TrimPrefix(t, "map<"), ">"), ",", 2)
+		if len(parts) == 2 {
+			return fmt.Sprintf("map<%s,%s>", parts[0], qualify(f, parts[1]))
+		}
+	}
+	if _, ok := scalars[t]; ok || strings.Contains(t, ".") || f.Package == "" {
+		return t
+	}
+	return f.Package + "." + t
+}
+
+// fieldType is the qualified type of a field with its label, optional doesn't change the wire format
+func fieldType(file *File, f *Field) string {
+	t := qualify(file, f.Type)
+	if f.Repeated {
+		return "repeated " + t
+	}
+	return t
+}
+
+func signature(file *File, r *RPC) string {
+	stream := func(streaming bool) string {
+		if streaming {
+			return "stream "
+		}
+		return ""
+	}
+	return fmt.Sprintf("(%s%s) returns (%s%s)", stream(r.ClientStreaming), qualify(file, r.Request), stream(r.ServerStreaming), qualify(file, r.Response))
+}
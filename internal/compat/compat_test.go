@@ -0,0 +1,120 @@
+package compat
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const baseline = `syntax = "proto3";
+package api;
+
+enum Kind {
+     KindA = 0;
+     KindB = 1;
+     KindC = 2;
+}
+
+message Model {
+    string ID = 1;
+    Kind Kind = 2;
+    repeated string Tags = 3;
+    int64 Size = 4;
+    string Gone = 5;
+}
+
+service API {
+     rpc Get(Model) returns (Model);
+     rpc Delete(Model) returns (Model);
+}
+`
+
+func compare(t *testing.T, old, current map[string]string) []string {
+	baseline, err := ParseAll(old, "base")
+	assert.NoError(t, err)
+	files, err := ParseAll(current, "out")
+	assert.NoError(t, err)
+
+	msgs := []string{}
+	for _, d := range Compare(baseline, files) {
+		msgs = append(msgs, d.Msg)
+	}
+	return msgs
+}
+
+func TestCompare(t *testing.T) {
+	// regenerating the same files is compatible
+	assert.Empty(t, compare(t, map[string]string{"api/const.proto": baseline}, map[string]string{"api/const.proto": baseline}))
+
+	// adding fields, values and rpcs and removing reserved fields is compatible
+	assert.Empty(t, compare(t, map[string]string{"api/const.proto": baseline}, map[string]string{"api/const.proto": `syntax = "proto3";
+package api;
+
+enum Kind {
+     KindA = 0;
+     KindB = 1;
+     KindC = 2;
+     KindD = 3;
+}
+
+message Model {
+    reserved 5;
+    reserved "Gone";
+    string ID = 1;
+    Kind Kind = 2;
+    repeated string Tags = 3;
+    int64 Size = 4;
+    optional string Name = 6;
+}
+
+service API {
+     rpc Get(Model) returns (Model);
+     rpc Delete(Model) returns (Model);
+     rpc List(Model) returns (Model);
+}
+`}))
+
+	assert.Equal(t, []string{
+		"field Kind changed type from api.Kind to other.Kind",
+		"field Tags changed type from repeated string to string",
+		"number 4 of field int64 Size is reused by field string Name",
+		"field Gone = 5 was removed without reserving its number",
+		"enum value KindB = 1 was renamed to KindBee",
+		"enum value KindC = 2 was removed without reserving its number",
+		"rpc Get changed from (api.Model) returns (api.Model) to (stream api.Model) returns (api.Model)",
+		"rpc Delete was removed",
+	}, compare(t, map[string]string{"api/const.proto": baseline}, map[string]string{"api/const.proto": `syntax = "proto3";
+package api;
+
+enum Kind {
+     KindA = 0;
+     KindBee = 1;
+}
+
+message Model {
+    string ID = 1;
+    other.Kind Kind = 2;
+    string Tags = 3;
+    string Name = 4;
+}
+
+service API {
+     rpc Get(stream Model) returns (Model);
+}
+`}))
+
+	// renaming the package breaks every type qualified with it
+	assert.Equal(t, []string{
+		"package api was renamed to api.v2",
+	}, compare(t, map[string]string{"api/const.proto": "package api;\nmessage A {\n    string B = 1;\n}\n"}, map[string]string{"api/const.proto": "package api.v2;\nmessage A {\n    string B = 1;\n}\n"}))
+
+	assert.Equal(t, []string{
+		"api/const.proto was removed",
+		"field B uses the reserved number 2",
+	}, compare(t, map[string]string{
+		"api/const.proto":   "package api;\n",
+		"other/const.proto": "package other;\nmessage A {\n    reserved 2;\n}\n",
+	}, map[string]string{
+		"other/const.proto": "package other;\nmessage A {\n    string B = 2;\n}\n",
+	}))
+}
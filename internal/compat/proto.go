@@ -0,0 +1,284 @@
+// Package compat finds the changes between two generations of the .proto files that break
+// clients built against the older one
+package compat
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"go/token"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrSyntax   = errors.New("unsupported proto syntax")
+	ErrBreaking = errors.New("breaking changes")
+)
+
+// File is what the compatibility check knows about a .proto file, it only understands the subset of proto3
+// dumptruck generates
+type File struct {
+	Name     string // path of the file relative to the output directory
+	Package  string
+	Pos      token.Position // of the package statement
+	Messages []*Message
+	Enums    []*Enum
+	Services []*Service
+}
+
+type Message struct {
+	Name     string
+	Pos      token.Position
+	Fields   []*Field
+	Reserved Reserved
+}
+
+type Field struct {
+	Name     string
+	Type     string // map fields are map<key, value>
+	Repeated bool
+	Optional bool
+	Number   int
+	Pos      token.Position
+}
+
+type Enum struct {
+	Name     string
+	Pos      token.Position
+	Values   []*EnumValue
+	Reserved Reserved
+}
+
+type EnumValue struct {
+	Name   string
+	Number int
+	Pos    token.Position
+}
+
+type Service struct {
+	Name string
+	Pos  token.Position
+	RPCs []*RPC
+}
+
+type RPC struct {
+	Name            string
+	Request         string
+	Response        string
+	ClientStreaming bool
+	ServerStreaming bool
+	Pos             token.Position
+}
+
+// Reserved are the numbers and names a message or enum reserved
+type Reserved struct {
+	Ranges [][2]int // inclusive
+	Names  []string
+}
+
+// HasNumber returns true if number is in one of the reserved ranges
+func (r Reserved) HasNumber(number int) bool {
+	for _, rng := range r.Ranges {
+		if number >= rng[0] && number <= rng[1] {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	fieldPattern   = regexp.MustCompile(`^(repeated\s+|optional\s+)?(map\s*<\s*[\w.]+\s*,\s*[\w.]+\s*>|[\w.]+)\s+(\w+)\s*=\s*(\d+)\s*(\[.*\])?\s*;$`)
+	valuePattern   = regexp.MustCompile(`^(\w+)\s*=\s*(-?\d+)\s*(\[.*\])?\s*;$`)
+	rpcPattern     = regexp.MustCompile(`^rpc\s+(\w+)\s*\(\s*(stream\s+)?([\w.]+)\s*\)\s*returns\s*\(\s*(stream\s+)?([\w.]+)\s*\)\s*(;|\{\s*\}|\{)$`)
+	blockPattern   = regexp.MustCompile(`^(message|enum|service|oneof|extend)\s+([\w.]+)\s*\{(\s*\})?$`)
+	packagePattern = regexp.MustCompile(`^package\s+([\w.]+)\s*;$`)
+)
+
+// Parse parses a generated .proto file, name is the path of the file in the output directory
+// and filename is where it was read from, it's only used in positions
+func Parse(name, filename string, src string) (*File, error) {
+	f := &File{Name: name}
+
+	// the block every line is in, an oneof adds its fields to the message it's in
+	type block struct {
+		kind    string
+		name    string
+		message *Message
+		enum    *Enum
+		service *Service
+	}
+	stack := []block{}
+
+	scanner := bufio.NewScanner(strings.NewReader(src))
+	line := 0
+	for scanner.Scan() {
+		line++
+		pos := token.Position{Filename: filename, Line: line, Column: 1}
+		text := scanner.Text()
+		if idx := strings.Index(text, "//"); idx != -1 {
+			text = text[:idx]
+		}
+		text = strings.TrimSpace(text)
+		if text == "" {
+			continue
+		}
+		errorf := func(format string, args ...interface{}) error {
+			return fmt.Errorf("%s: %w: %s", pos, ErrSyntax, fmt.Sprintf(format, args...))
+		}
+
+		if text == "}" {
+			if len(stack) == 0 {
+				return nil, errorf("unbalanced }")
+			}
+			stack = stack[:len(stack)-1]
+			continue
+		}
+
+		if match := blockPattern.FindStringSubmatch(text); match != nil {
+			b := block{kind: match[1], name: match[2]}
+			switch match[1] {
+			case "message":
+				b.message = &Message{Name: match[2], Pos: pos}
+				f.Messages = append(f.Messages, b.message)
+			case "enum":
+				b.enum = &Enum{Name: match[2], Pos: pos}
+				f.Enums = append(f.Enums, b.enum)
+			case "service":
+				b.service = &Service{Name: match[2], Pos: pos}
+				f.Services = append(f.Services, b.service)
+			case "oneof":
+				if len(stack) == 0 || stack[len(stack)-1].message == nil {
+					return nil, errorf("oneof outside of a message")
+				}
+				b.message = stack[len(stack)-1].message
+			}
+			if len(stack) > 0 && match[1] != "oneof" {
+				return nil, errorf("nested %s %s", match[1], match[2])
+			}
+			if match[3] == "" {
+				stack = append(stack, b)
+			}
+			continue
+		}
+
+		if len(stack) == 0 {
+			switch {
+			case packagePattern.MatchString(text):
+				f.Package = packagePattern.FindStringSubmatch(text)[1]
+				f.Pos = pos
+			case strings.HasPrefix(text, "syntax"), strings.HasPrefix(text, "option"), strings.HasPrefix(text, "import"):
+			default:
+				return nil, errorf("%s", text)
+			}
+			continue
+		}
+
+		current := stack[len(stack)-1]
+		if strings.HasPrefix(text, "option ") {
+			continue
+		}
+		if strings.HasPrefix(text, "reserved ") {
+			var reserved *Reserved
+			switch {
+			case current.kind == "message":
+				reserved = &current.message.Reserved
+			case current.kind == "enum":
+				reserved = &current.enum.Reserved
+			default:
+				return nil, errorf("reserved in a %s", current.kind)
+			}
+			if err := parseReserved(strings.TrimSuffix(strings.TrimPrefix(text, "reserved "), ";"), reserved); err != nil {
+				return nil, errorf("%s", err)
+			}
+			continue
+		}
+
+		switch current.kind {
+		case "message", "oneof":
+			match := fieldPattern.FindStringSubmatch(text)
+			if match == nil {
+				return nil, errorf("%s", text)
+			}
+			number, _ := strconv.Atoi(match[4])
+			current.message.Fields = append(current.message.Fields, &Field{
+				Name:     match[3],
+				Type:     normalizeMap(match[2]),
+				Repeated: strings.TrimSpace(match[1]) == "repeated",
+				Optional: strings.TrimSpace(match[1]) == "optional",
+				Number:   number,
+				Pos:      pos,
+			})
+		case "extend":
+			// the fields of the options of the generated protos, they aren't compared
+			if !fieldPattern.MatchString(text) {
+				return nil, errorf("%s", text)
+			}
+		case "enum":
+			match := valuePattern.FindStringSubmatch(text)
+			if match == nil {
+				return nil, errorf("%s", text)
+			}
+			number, _ := strconv.Atoi(match[2])
+			current.enum.Values = append(current.enum.Values, &EnumValue{Name: match[1], Number: number, Pos: pos})
+		case "service":
+			match := rpcPattern.FindStringSubmatch(text)
+			if match == nil {
+				return nil, errorf("%s", text)
+			}
+			current.service.RPCs = append(current.service.RPCs, &RPC{
+				Name:            match[1],
+				ClientStreaming: match[2] != "",
+				Request:         match[3],
+				ServerStreaming: match[4] != "",
+				Response:        match[5],
+				Pos:             pos,
+			})
+			// an rpc with options has a body of its own
+			if match[6] == "{" {
+				stack = append(stack, block{kind: "rpc", name: match[1]})
+			}
+		}
+	}
+	if len(stack) > 0 {
+		unclosed := stack[len(stack)-1]
+		return nil, fmt.Errorf("%s: %w: %s %s is never closed", filename, ErrSyntax, unclosed.kind, unclosed.name)
+	}
+	return f, scanner.Err()
+}
+
+// parseReserved parses the part of a reserved statement after the keyword e.g. 2, 4 to 6 or "Old", "Older"
+func parseReserved(text string, reserved *Reserved) error {
+	for _, part := range strings.Split(text, ",") {
+		part = strings.TrimSpace(part)
+		if unquoted, err := strconv.Unquote(part); err == nil {
+			reserved.Names = append(reserved.Names, unquoted)
+			continue
+		}
+
+		bounds := strings.SplitN(part, " to ", 2)
+		from, err := strconv.Atoi(strings.TrimSpace(bounds[0]))
+		if err != nil {
+			return fmt.Errorf("reserved %s", part)
+		}
+		to := from
+		if len(bounds) == 2 {
+			if strings.TrimSpace(bounds[1]) == "max" {
+				to = 1<<29 - 1
+			} else if to, err = strconv.Atoi(strings.TrimSpace(bounds[1])); err != nil {
+				return fmt.Errorf("reserved %s", part)
+			}
+		}
+		reserved.Ranges = append(reserved.Ranges, [2]int{from, to})
+	}
+	return nil
+}
+
+// normalizeMap removes the spaces from a map type so map<string, int32> and map<string,int32> compare equal
+func normalizeMap(t string) string {
+	if !strings.HasPrefix(t, "map") {
+		return t
+	}
+	return strings.Join(strings.Fields(t), "")
+}
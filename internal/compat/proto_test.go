@@ -0,0 +1,90 @@
+package compat
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	f, err := Parse("api/const.proto", "out/api/const.proto", `syntax = "proto3";
+package api;
+option go_package = "example.com/gen/api";
+
+import "google/protobuf/timestamp.proto";
+
+// a comment
+enum Kind {
+     reserved 2;
+     KindA = 0;
+     KindB = 1 [deprecated = true];
+     KindC = 3 [(api.go_value) = "c"];
+}
+
+extend google.protobuf.EnumValueOptions {
+     string go_value = 50100;
+}
+
+message Model {
+    reserved 3, 5 to 7;
+    reserved "Old";
+    string ID = 1; // trailing comment
+    repeated Kind Kinds = 2;
+    map<string, Model> Children = 4;
+    optional google.protobuf.Timestamp At = 8;
+    oneof value {
+        string text = 9;
+    }
+}
+
+message Empty {}
+
+service API {
+     rpc Get(Model) returns (Model);
+     rpc Watch(stream Empty) returns (stream Model) {}
+}
+`)
+	assert.NoError(t, err)
+	assert.Equal(t, "api", f.Package)
+	assert.Equal(t, 2, f.Pos.Line)
+
+	assert.Equal(t, 1, len(f.Enums))
+	assert.Equal(t, []*EnumValue{
+		{Name: "KindA", Number: 0, Pos: f.Enums[0].Values[0].Pos},
+		{Name: "KindB", Number: 1, Pos: f.Enums[0].Values[1].Pos},
+		{Name: "KindC", Number: 3, Pos: f.Enums[0].Values[2].Pos},
+	}, f.Enums[0].Values)
+	assert.True(t, f.Enums[0].Reserved.HasNumber(2))
+
+	assert.Equal(t, 2, len(f.Messages))
+	model := f.Messages[0]
+	assert.Equal(t, Reserved{Ranges: [][2]int{{3, 3}, {5, 7}}, Names: []string{"Old"}}, model.Reserved)
+	types := []string{}
+	for _, field := range model.Fields {
+		types = append(types, field.Type)
+	}
+	assert.Equal(t, []string{"string", "Kind", "map<string,Model>", "google.protobuf.Timestamp", "string"}, types)
+	assert.True(t, model.Fields[1].Repeated)
+	assert.True(t, model.Fields[3].Optional)
+	assert.Equal(t, 22, model.Fields[0].Pos.Line)
+	assert.Equal(t, "out/api/const.proto", model.Fields[0].Pos.Filename)
+	assert.Empty(t, f.Messages[1].Fields)
+
+	rpcs := f.Services[0].RPCs
+	assert.Equal(t, 2, len(rpcs))
+	assert.Equal(t, RPC{Name: "Watch", Request: "Empty", Response: "Model", ClientStreaming: true, ServerStreaming: true, Pos: rpcs[1].Pos}, *rpcs[1])
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, src := range []string{
+		"message A {\n    string = 1;\n}\n",
+		"message A {\n",
+		"}\n",
+		"extend A {\n    string = 1;\n}\n",
+		"message A {\n    message B {\n    }\n}\n",
+	} {
+		_, err := Parse("a.proto", "a.proto", src)
+		assert.True(t, errors.Is(err, ErrSyntax), src)
+	}
+}
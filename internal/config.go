@@ -1,22 +1,288 @@
 package internal
 
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"code.justin.tv/safety/go2proto/internal/diag"
+	"code.justin.tv/safety/go2proto/internal/lock"
+)
+
+var ErrInvalidConfig = errors.New("invalid config")
+
+const (
+	FrontendAST   = "ast"   // guesses types from the syntax of each file
+	FrontendTypes = "types" // type checks every package with go/types
+
+	EmbedMessage = "message" // embedded structs are a field named after the embedded type
+	EmbedFlatten = "flatten" // the promoted fields of embedded structs are fields of the parent message
+
+	NamingStyle = "style" // snake_case fields and SCREAMING_SNAKE_CASE enum values prefixed with their enum
+	NamingGo    = "go"    // fields and enum values keep the name of their go identifier
+
+	ErrorCodesGRPC  = "grpc"  // errors map to the codes of google.golang.org/grpc/codes
+	ErrorCodesTwirp = "twirp" // errors map to twirp error codes, the adapters get twirp translations as well
+)
+
+// grpcCodes are the names of the grpc codes an error can be mapped to
+var grpcCodes = []string{
+	"Canceled", "Unknown", "InvalidArgument", "DeadlineExceeded", "NotFound", "AlreadyExists", "PermissionDenied",
+	"ResourceExhausted", "FailedPrecondition", "Aborted", "OutOfRange", "Unimplemented", "Internal", "Unavailable",
+	"DataLoss", "Unauthenticated",
+}
+
+// twirpOnlyCodes are the names of the twirp error codes without a grpc code of the same name and the grpc code they
+// are sent with over grpc
+var twirpOnlyCodes = map[string]string{"Malformed": "InvalidArgument", "BadRoute": "Unimplemented"}
+
 type TranspilerConfig struct {
-	GoProjectPath  string
-	PkgPrefix      string
-	PkgPrefixSlash string
-	RootPkgName    string
-	OutDir         string
-	InputDir       string
+	GoProjectPath  string                   // import path prefix of the project, only packages under it are transpiled
+	PkgPrefix      string                   // optional prefix prepended to every generated proto package
+	PkgPrefixSlash string                   // go_package prefix of the generated protobuf go code
+	RootPkgName    string                   // proto package of the generated server
+	OutDir         string                   // directory the .proto files are written to
+	ConvertersDir  string                   // directory the go converters are written to
+	ConvertersPkg  string                   // go import path of ConvertersDir, PkgPrefixSlash/converters when empty
+	AdaptersDir    string                   // directory the go adapters of the services are written to
+	TemplatesDir   string                   // directory of .tmpl files replacing the default templates of the same name, none when empty
+	Input          string                   // import path of the input interface file or package
+	ModuleDir      string                   // directory of the go module to resolve imports from, discovered when empty
+	Frontend       string                   // FrontendAST or FrontendTypes
+	FailOn         string                   // severity of the diagnostics that fail a run, warning or error
+	Embedded       string                   // EmbedMessage or EmbedFlatten, how the embedded structs of every struct are transpiled
+	Naming         string                   // NamingStyle or NamingGo, how the fields of structs and enum values are named
+	LockFile       string                   // lock file of the assigned field numbers, nothing is locked when empty
+	Interfaces     []string                 // names of the interfaces to export, all of them when empty
+	Services       []ServiceConfig          // interfaces transpiled to a proto service, see BuildServices
+	Streams        StreamConfig             // go types besides <-chan T that stream the requests or responses of an rpc
+	Packages       map[string]PackageConfig // per package overrides keyed by go import path
+	TypeMappings   map[string]string        // go field type -> type it is transpiled as
+	ErrorCodes     string                   // ErrorCodesGRPC or ErrorCodesTwirp, the codes of Errors
+	Errors         map[string]string        // name of a sentinel error or error type -> name of the code its rpcs fail with
+
+	source *configSource // the config file the settings were loaded from, nil without one
+}
+
+// PackageConfig overrides how a single go package is transpiled
+type PackageConfig struct {
+	ProtoPackage string            // replaces the generated proto package
+	GoPackage    string            // replaces the generated go_package option
+	Skip         bool              // don't transpile any of the package's types
+	TypeMappings map[string]string // same as TranspilerConfig.TypeMappings but only for fields declared in this package
+	Embedded     map[string]string // struct name -> EmbedMessage or EmbedFlatten, overrides TranspilerConfig.Embedded
+	Errors       map[string]string // same as TranspilerConfig.Errors but only for the errors of this package
+}
+
+// ServiceConfig maps a go interface to a proto service
+type ServiceConfig struct {
+	Interface string                  // name of the go interface, e.g. api.Users with the name of its go package when more packages declare it
+	Name      string                  // name of the proto service, the interface name when empty
+	Package   string                  // proto package of the service and its messages, the root package with the snake_case name appended when empty
+	GoPackage string                  // go_package of the service, derived from Package when empty
+	File      string                  // path of the .proto file in the output directory, the snake_case name when empty
+	Methods   map[string]MethodConfig // method name -> overrides of the rpc of that method
+}
+
+// MethodConfig overrides how the request and response messages of a method are transpiled
+type MethodConfig struct {
+	Results []string // names of the response fields in the order of the results (without the error), empty keeps a name
 }
 
-// GetTranspilerConfig returns the config for the transpiler
-func GetTranspilerConfig() TranspilerConfig {
+// DefaultTranspilerConfig returns the config every config file and flag is applied on top of
+func DefaultTranspilerConfig() TranspilerConfig {
 	return TranspilerConfig{
-		GoProjectPath:  "code.justin.tv/safety/go2proto",
-		PkgPrefix:      "code.justin.tv.safety.gateway.testserver",
-		PkgPrefixSlash: "code.justin.tv/safety/gateway/testserver/rpc/testserver/gen",
-		RootPkgName:    "root",
-		OutDir:         "out",
-		InputDir:       "models/",
+		RootPkgName:   "root",
+		OutDir:        "out",
+		ConvertersDir: "converters",
+		AdaptersDir:   "adapters",
+		Frontend:      FrontendAST,
+		FailOn:        diag.Warning.String(),
+		Embedded:      EmbedMessage,
+		Naming:        NamingStyle,
+		LockFile:      lock.DefaultFile,
+		Streams:       StreamConfig{Iterators: []string{"iter.Seq"}},
+		Packages:      map[string]PackageConfig{},
+		TypeMappings:  map[string]string{},
+		ErrorCodes:    ErrorCodesGRPC,
+		Errors:        map[string]string{},
+	}
+}
+
+// Validate checks the settings that are required to run the transpiler at all, the error of a config loaded from a
+// file is a ConfigError at the key of the invalid setting or at the start of the file for a missing one
+func (c TranspilerConfig) Validate() error {
+	key, err := c.validate()
+	if err != nil && c.source != nil {
+		return c.source.errorAt(key, err)
+	}
+	return err
+}
+
+// validate returns the key of the setting that is invalid with the error, empty for a missing setting
+func (c TranspilerConfig) validate() (string, error) {
+	missing := []string{}
+	if c.GoProjectPath == "" {
+		missing = append(missing, "project")
+	}
+	if c.Input == "" {
+		missing = append(missing, "input")
+	}
+	if c.RootPkgName == "" {
+		missing = append(missing, "root_package")
+	}
+	if c.OutDir == "" {
+		missing = append(missing, "out")
+	}
+	if len(missing) > 0 {
+		return "", fmt.Errorf("%w: missing %s", ErrInvalidConfig, strings.Join(missing, ", "))
+	}
+	if c.Frontend != FrontendAST && c.Frontend != FrontendTypes {
+		return "frontend", fmt.Errorf("%w: unknown frontend %q, expected %q or %q", ErrInvalidConfig, c.Frontend, FrontendAST, FrontendTypes)
+	}
+	if _, err := diag.ParseSeverity(c.FailOn); err != nil {
+		return "fail_on", fmt.Errorf("%w: fail_on: %s", ErrInvalidConfig, err)
+	}
+	if !validEmbedStrategy(c.Embedded) {
+		return "embedded", fmt.Errorf("%w: unknown embedded strategy %q, expected %q or %q", ErrInvalidConfig, c.Embedded, EmbedMessage, EmbedFlatten)
+	}
+	if c.Naming != NamingStyle && c.Naming != NamingGo {
+		return "naming", fmt.Errorf("%w: unknown naming %q, expected %q or %q", ErrInvalidConfig, c.Naming, NamingStyle, NamingGo)
+	}
+	interfaces := map[string]struct{}{}
+	for _, svc := range c.Services {
+		if svc.Interface == "" {
+			return "services", fmt.Errorf("%w: service %q has no interface", ErrInvalidConfig, svc.Name)
+		}
+		if _, ok := interfaces[svc.Interface]; ok {
+			return "services", fmt.Errorf("%w: interface %s is more than one service", ErrInvalidConfig, svc.Interface)
+		}
+		interfaces[svc.Interface] = struct{}{}
+	}
+	if c.ErrorCodes != ErrorCodesGRPC && c.ErrorCodes != ErrorCodesTwirp {
+		return "error_codes", fmt.Errorf("%w: unknown error codes %q, expected %q or %q", ErrInvalidConfig, c.ErrorCodes, ErrorCodesGRPC, ErrorCodesTwirp)
+	}
+	if err := c.validErrorCodes(c.Errors, ""); err != nil {
+		return "errors", err
+	}
+	for path, pkg := range c.Packages {
+		for name, strategy := range pkg.Embedded {
+			if !validEmbedStrategy(strategy) {
+				return "packages", fmt.Errorf("%w: unknown embedded strategy %q for %s.%s, expected %q or %q", ErrInvalidConfig, strategy, path, name, EmbedMessage, EmbedFlatten)
+			}
+		}
+		if err := c.validErrorCodes(pkg.Errors, path+"."); err != nil {
+			return "packages", err
+		}
+	}
+	return "", nil
+}
+
+// validErrorCodes checks that every error maps to a code of c.ErrorCodes, prefix qualifies the names of the errors
+func (c TranspilerConfig) validErrorCodes(errs map[string]string, prefix string) error {
+	names := make([]string, 0, len(errs))
+	for name := range errs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		code := errs[name]
+		if _, ok := twirpOnlyCodes[code]; ok && c.ErrorCodes == ErrorCodesTwirp {
+			continue
+		}
+		valid := false
+		for _, grpcCode := range grpcCodes {
+			valid = valid || grpcCode == code
+		}
+		if !valid {
+			return fmt.Errorf("%w: unknown %s code %q for error %s%s", ErrInvalidConfig, c.ErrorCodes, code, prefix, name)
+		}
+	}
+	return nil
+}
+
+func validEmbedStrategy(strategy string) bool {
+	return strategy == EmbedMessage || strategy == EmbedFlatten
+}
+
+// EmbedStrategy returns how the embedded structs of a struct are transpiled
+func (c TranspilerConfig) EmbedStrategy(s Struct) string {
+	if s.Path.Path != nil {
+		if strategy, ok := c.Packages[*s.Path.Path].Embedded[s.Name]; ok {
+			return strategy
+		}
+	}
+	return c.Embedded
+}
+
+// ProtoPackage returns the proto package for a dot separated package path with the PkgPrefix applied
+func (c TranspilerConfig) ProtoPackage(pkg string) string {
+	if c.PkgPrefix == "" {
+		return pkg
+	}
+	return c.PkgPrefix + "." + pkg
+}
+
+// ConvertersImportPath returns the go import path of the converters of the go package named pkg
+func (c TranspilerConfig) ConvertersImportPath(pkg string) string {
+	base := c.ConvertersPkg
+	if base == "" {
+		base = c.PkgPrefixSlash + "/converters"
+	}
+	return base + "/" + pkg
+}
+
+// ErrorCode returns the name of the code the rpcs fail with when a method returns the error, Unknown when it isn't
+// mapped. The errors of a package are mapped before the errors of every package
+func (c TranspilerConfig) ErrorCode(goError GoError) string {
+	if goError.Path.Path != nil {
+		if code, ok := c.Packages[*goError.Path.Path].Errors[goError.Name]; ok {
+			return code
+		}
+	}
+	if code, ok := c.Errors[goError.Name]; ok {
+		return code
+	}
+	return "Unknown"
+}
+
+// GRPCCode returns the name of the grpc code of an error code, the codes only twirp has are sent as a similar code
+func GRPCCode(code string) string {
+	if grpcCode, ok := twirpOnlyCodes[code]; ok {
+		return grpcCode
+	}
+	return code
+}
+
+// SkippedPackages returns the sorted import paths of every package that is configured to be skipped
+func (c TranspilerConfig) SkippedPackages() []string {
+	out := []string{}
+	for path, pkg := range c.Packages {
+		if pkg.Skip {
+			out = append(out, path)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// FieldTypeOverrides turns the configured type mappings into field overrides
+// a mapping of the package a field is declared in wins over the global mappings
+func (c TranspilerConfig) FieldTypeOverrides() []FieldTypeOverride {
+	return []FieldTypeOverride{
+		func(f *Field, parentFunc *Function, parentStruct *Struct) bool {
+			if f.Path.Path != nil {
+				if mapped, ok := c.Packages[*f.Path.Path].TypeMappings[f.Type]; ok {
+					f.Type = mapped
+					return true
+				}
+			}
+			if mapped, ok := c.TypeMappings[f.Type]; ok {
+				f.Type = mapped
+				return true
+			}
+			return false
+		},
 	}
 }
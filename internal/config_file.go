@@ -0,0 +1,451 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"code.justin.tv/safety/go2proto/internal/diag"
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigVersion is the only config file version this transpiler understands
+const ConfigVersion = 1
+
+// ConfigFileNames are the file names searched for when discovering a config file, in order
+var ConfigFileNames = []string{"dumptruck.yaml", "dumptruck.yml", "dumptruck.json"}
+
+var ErrConfigNotFound = errors.New("no dumptruck config file found")
+
+// ConfigError is a single problem at a line and column of a config file
+type ConfigError struct {
+	File   string
+	Line   int
+	Column int
+	Msg    string
+	Err    error // error of a setting that failed validation, Msg is its message
+}
+
+func (e *ConfigError) Error() string {
+	return fmt.Sprintf("%s:%d:%d: %s", e.File, e.Line, e.Column, e.Msg)
+}
+
+func (e *ConfigError) Unwrap() error {
+	return e.Err
+}
+
+// ConfigErrors are all of the problems found while loading a config file
+type ConfigErrors []*ConfigError
+
+func (e ConfigErrors) Error() string {
+	msgs := make([]string, len(e))
+	for idx, err := range e {
+		msgs[idx] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+func (e ConfigErrors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for idx, err := range e {
+		errs[idx] = err
+	}
+	return errs
+}
+
+// configSource remembers where the settings of a config file are so errors found after decoding point at them
+type configSource struct {
+	file string
+	doc  *yaml.Node            // root of the config
+	keys map[string]*yaml.Node // top level key -> its node
+}
+
+// errorAt returns err at the position of key, or at the start of the config when the key isn't in it
+func (s *configSource) errorAt(key string, err error) error {
+	node := s.doc
+	if keyNode, ok := s.keys[key]; ok {
+		node = keyNode
+	}
+	return ConfigErrors{{File: s.file, Line: node.Line, Column: node.Column, Msg: err.Error(), Err: err}}
+}
+
+// position returns the position of key, the zero position when the config wasn't read from a file or doesn't set it
+func (s *configSource) position(key string) token.Position {
+	if s == nil {
+		return token.Position{}
+	}
+	keyNode, ok := s.keys[key]
+	if !ok {
+		return token.Position{}
+	}
+	return token.Position{Filename: s.file, Line: keyNode.Line, Column: keyNode.Column}
+}
+
+// FindConfig looks for a config file in dir and then in each of its parents
+func FindConfig(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+
+	for {
+		for _, name := range ConfigFileNames {
+			path := filepath.Join(dir, name)
+			if _, err := os.Stat(path); err == nil {
+				return path, nil
+			}
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", ErrConfigNotFound
+		}
+		dir = parent
+	}
+}
+
+// LoadConfig reads and validates the config file at path, the file is applied on top of the default config
+func LoadConfig(path string) (TranspilerConfig, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return TranspilerConfig{}, err
+	}
+	cfg, err := ParseConfig(path, data)
+	if err != nil {
+		return cfg, err
+	}
+
+	// every path is relative to the config file so a run from any working directory reads and writes the same files
+	for _, dir := range []*string{&cfg.ModuleDir, &cfg.LockFile, &cfg.TemplatesDir, &cfg.OutDir, &cfg.ConvertersDir, &cfg.AdaptersDir} {
+		if *dir != "" && !filepath.IsAbs(*dir) {
+			*dir = filepath.Join(filepath.Dir(path), *dir)
+		}
+	}
+	return cfg, nil
+}
+
+// ParseConfig parses and validates a YAML or JSON config file, file is only used in errors
+func ParseConfig(file string, data []byte) (TranspilerConfig, error) {
+	cfg := DefaultTranspilerConfig()
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return cfg, fmt.Errorf("%s: %w", file, err)
+	}
+
+	d := &configDecoder{file: file}
+	if len(doc.Content) == 0 {
+		d.errorf(&doc, "empty config, expected at least version: %d", ConfigVersion)
+		return cfg, d.errs
+	}
+	cfg.source = &configSource{file: file, doc: doc.Content[0], keys: map[string]*yaml.Node{}}
+	d.decodeRoot(doc.Content[0], &cfg)
+	if len(d.errs) > 0 {
+		return cfg, d.errs
+	}
+	return cfg, nil
+}
+
+// configDecoder walks the yaml nodes of a config file so every error knows its line and column
+type configDecoder struct {
+	file string
+	errs ConfigErrors
+}
+
+func (d *configDecoder) errorf(node *yaml.Node, format string, args ...interface{}) {
+	d.errs = append(d.errs, &ConfigError{
+		File:   d.file,
+		Line:   node.Line,
+		Column: node.Column,
+		Msg:    fmt.Sprintf(format, args...),
+	})
+}
+
+// mapping calls fn for every key and value of a mapping node, duplicate keys are errors
+func (d *configDecoder) mapping(node *yaml.Node, what string, fn func(key, value *yaml.Node)) bool {
+	if node.Kind != yaml.MappingNode {
+		d.errorf(node, "%s must be a mapping", what)
+		return false
+	}
+
+	seen := map[string]struct{}{}
+	for idx := 0; idx+1 < len(node.Content); idx += 2 {
+		key, value := node.Content[idx], node.Content[idx+1]
+		if _, ok := seen[key.Value]; ok {
+			d.errorf(key, "duplicate key %q in %s", key.Value, what)
+			continue
+		}
+		seen[key.Value] = struct{}{}
+		fn(key, value)
+	}
+	return true
+}
+
+func (d *configDecoder) decodeString(node *yaml.Node, key string, out *string) {
+	if node.Kind != yaml.ScalarNode || node.ShortTag() != "!!str" {
+		d.errorf(node, "%s must be a string", key)
+		return
+	}
+	*out = node.Value
+}
+
+func (d *configDecoder) decodeStringList(node *yaml.Node, key string, out *[]string) {
+	if node.Kind != yaml.SequenceNode {
+		d.errorf(node, "%s must be a list of strings", key)
+		return
+	}
+
+	seen := map[string]struct{}{}
+	for _, item := range node.Content {
+		var s string
+		d.decodeString(item, key+" item", &s)
+		if s == "" {
+			continue
+		}
+		if _, ok := seen[s]; ok {
+			d.errorf(item, "duplicate %s item %q", key, s)
+			continue
+		}
+		seen[s] = struct{}{}
+		*out = append(*out, s)
+	}
+}
+
+func (d *configDecoder) decodeStringMap(node *yaml.Node, key string, out map[string]string) {
+	d.mapping(node, key, func(k, v *yaml.Node) {
+		var mapped string
+		d.decodeString(v, key+"."+k.Value, &mapped)
+		if mapped == "" {
+			d.errorf(v, "%s.%s must not be empty", key, k.Value)
+			return
+		}
+		out[k.Value] = mapped
+	})
+}
+
+func (d *configDecoder) decodeEmbedStrategy(node *yaml.Node, key string, out *string) {
+	var strategy string
+	d.decodeString(node, key, &strategy)
+	if strategy == "" {
+		return
+	}
+	if !validEmbedStrategy(strategy) {
+		d.errorf(node, "%s must be %q or %q", key, EmbedMessage, EmbedFlatten)
+		return
+	}
+	*out = strategy
+}
+
+func (d *configDecoder) decodeRoot(node *yaml.Node, cfg *TranspilerConfig) {
+	var version *yaml.Node
+	var packages *yaml.Node
+	ok := d.mapping(node, "config", func(key, value *yaml.Node) {
+		cfg.source.keys[key.Value] = key
+		switch key.Value {
+		case "version":
+			version = value
+		case "project":
+			d.decodeString(value, key.Value, &cfg.GoProjectPath)
+		case "input":
+			d.decodeString(value, key.Value, &cfg.Input)
+		case "module":
+			d.decodeString(value, key.Value, &cfg.ModuleDir)
+		case "frontend":
+			d.decodeString(value, key.Value, &cfg.Frontend)
+			if cfg.Frontend != FrontendAST && cfg.Frontend != FrontendTypes {
+				d.errorf(value, "frontend must be %q or %q", FrontendAST, FrontendTypes)
+			}
+		case "fail_on":
+			d.decodeString(value, key.Value, &cfg.FailOn)
+			if _, err := diag.ParseSeverity(cfg.FailOn); err != nil {
+				d.errorf(value, "fail_on must be %q or %q", diag.Warning, diag.Error)
+			}
+		case "embedded":
+			d.decodeEmbedStrategy(value, key.Value, &cfg.Embedded)
+		case "naming":
+			d.decodeString(value, key.Value, &cfg.Naming)
+			if cfg.Naming != NamingStyle && cfg.Naming != NamingGo {
+				d.errorf(value, "naming must be %q or %q", NamingStyle, NamingGo)
+			}
+		case "lock":
+			d.decodeString(value, key.Value, &cfg.LockFile)
+		case "interfaces":
+			d.decodeStringList(value, key.Value, &cfg.Interfaces)
+		case "services":
+			d.decodeServices(value, &cfg.Services)
+		case "out":
+			d.decodeString(value, key.Value, &cfg.OutDir)
+		case "converters_out":
+			d.decodeString(value, key.Value, &cfg.ConvertersDir)
+		case "converters_package":
+			d.decodeString(value, key.Value, &cfg.ConvertersPkg)
+		case "adapters_out":
+			d.decodeString(value, key.Value, &cfg.AdaptersDir)
+		case "templates":
+			d.decodeString(value, key.Value, &cfg.TemplatesDir)
+		case "streams":
+			d.decodeStreams(value, &cfg.Streams)
+		case "proto_package_prefix":
+			d.decodeString(value, key.Value, &cfg.PkgPrefix)
+		case "go_package_prefix":
+			d.decodeString(value, key.Value, &cfg.PkgPrefixSlash)
+		case "root_package":
+			d.decodeString(value, key.Value, &cfg.RootPkgName)
+		case "type_mappings":
+			d.decodeStringMap(value, key.Value, cfg.TypeMappings)
+		case "error_codes":
+			d.decodeString(value, key.Value, &cfg.ErrorCodes)
+			if cfg.ErrorCodes != ErrorCodesGRPC && cfg.ErrorCodes != ErrorCodesTwirp {
+				d.errorf(value, "error_codes must be %q or %q", ErrorCodesGRPC, ErrorCodesTwirp)
+			}
+		case "errors":
+			d.decodeStringMap(value, key.Value, cfg.Errors)
+		case "packages":
+			packages = value
+		default:
+			d.errorf(key, "unknown field %q", key.Value)
+		}
+	})
+	if !ok {
+		return
+	}
+
+	if version == nil {
+		d.errorf(node, "missing version, expected version: %d", ConfigVersion)
+	} else {
+		var v int
+		if version.Kind != yaml.ScalarNode || version.Decode(&v) != nil {
+			d.errorf(version, "version must be an integer")
+		} else if v != ConfigVersion {
+			d.errorf(version, "unsupported version %d, expected %d", v, ConfigVersion)
+		}
+	}
+
+	// packages are decoded last so they can be checked against the project path
+	if packages != nil {
+		d.mapping(packages, "packages", func(key, value *yaml.Node) {
+			if cfg.GoProjectPath != "" && !strings.HasPrefix(key.Value, cfg.GoProjectPath) {
+				d.errorf(key, "package %q is not in project %q", key.Value, cfg.GoProjectPath)
+				return
+			}
+			pkg := PackageConfig{TypeMappings: map[string]string{}, Embedded: map[string]string{}, Errors: map[string]string{}}
+			d.decodePackage(value, key.Value, &pkg)
+			cfg.Packages[key.Value] = pkg
+		})
+	}
+}
+
+func (d *configDecoder) decodeServices(node *yaml.Node, out *[]ServiceConfig) {
+	if node.Kind != yaml.SequenceNode {
+		d.errorf(node, "services must be a list")
+		return
+	}
+
+	seen := map[string]struct{}{}
+	for _, item := range node.Content {
+		svc := ServiceConfig{}
+		d.mapping(item, "service", func(key, value *yaml.Node) {
+			switch key.Value {
+			case "interface":
+				d.decodeString(value, key.Value, &svc.Interface)
+			case "name":
+				d.decodeString(value, key.Value, &svc.Name)
+			case "package":
+				d.decodeString(value, key.Value, &svc.Package)
+			case "go_package":
+				d.decodeString(value, key.Value, &svc.GoPackage)
+			case "file":
+				d.decodeString(value, key.Value, &svc.File)
+			case "methods":
+				svc.Methods = map[string]MethodConfig{}
+				d.mapping(value, key.Value, func(k, v *yaml.Node) {
+					svc.Methods[k.Value] = d.decodeMethod(v, k.Value)
+				})
+			default:
+				d.errorf(key, "unknown field %q in service", key.Value)
+			}
+		})
+		if svc.Interface == "" {
+			d.errorf(item, "service must have an interface")
+			continue
+		}
+		if _, ok := seen[svc.Interface]; ok {
+			d.errorf(item, "duplicate service for interface %q", svc.Interface)
+			continue
+		}
+		seen[svc.Interface] = struct{}{}
+		*out = append(*out, svc)
+	}
+}
+
+func (d *configDecoder) decodeMethod(node *yaml.Node, name string) MethodConfig {
+	method := MethodConfig{}
+	d.mapping(node, "method "+name, func(key, value *yaml.Node) {
+		switch key.Value {
+		case "results":
+			// empty names keep the name of the result at their position so they aren't skipped like in other lists
+			if value.Kind != yaml.SequenceNode {
+				d.errorf(value, "results must be a list of strings")
+				return
+			}
+			for _, item := range value.Content {
+				result := ""
+				d.decodeString(item, "results item", &result)
+				method.Results = append(method.Results, result)
+			}
+		default:
+			d.errorf(key, "unknown field %q in method %s", key.Value, name)
+		}
+	})
+	return method
+}
+
+func (d *configDecoder) decodeStreams(node *yaml.Node, out *StreamConfig) {
+	d.mapping(node, "streams", func(key, value *yaml.Node) {
+		switch key.Value {
+		case "iterators":
+			// the configured iterators replace the default ones
+			out.Iterators = nil
+			d.decodeStringList(value, "streams."+key.Value, &out.Iterators)
+		case "callbacks":
+			if value.Kind != yaml.ScalarNode || value.ShortTag() != "!!bool" || value.Decode(&out.Callbacks) != nil {
+				d.errorf(value, "streams.callbacks must be a boolean")
+			}
+		default:
+			d.errorf(key, "unknown field %q in streams", key.Value)
+		}
+	})
+}
+
+func (d *configDecoder) decodePackage(node *yaml.Node, path string, pkg *PackageConfig) {
+	d.mapping(node, "package "+path, func(key, value *yaml.Node) {
+		switch key.Value {
+		case "proto_package":
+			d.decodeString(value, key.Value, &pkg.ProtoPackage)
+		case "go_package":
+			d.decodeString(value, key.Value, &pkg.GoPackage)
+		case "skip":
+			if value.Kind != yaml.ScalarNode || value.ShortTag() != "!!bool" || value.Decode(&pkg.Skip) != nil {
+				d.errorf(value, "skip must be a boolean")
+			}
+		case "type_mappings":
+			d.decodeStringMap(value, key.Value, pkg.TypeMappings)
+		case "errors":
+			d.decodeStringMap(value, key.Value, pkg.Errors)
+		case "embedded":
+			d.mapping(value, key.Value, func(k, v *yaml.Node) {
+				strategy := ""
+				d.decodeEmbedStrategy(v, key.Value+"."+k.Value, &strategy)
+				if strategy != "" {
+					pkg.Embedded[k.Value] = strategy
+				}
+			})
+		default:
+			d.errorf(key, "unknown field %q in package %s", key.Value, path)
+		}
+	})
+}
@@ -0,0 +1,177 @@
+package internal
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseConfig(t *testing.T) {
+	cfg, err := ParseConfig("dumptruck.yaml", []byte(`
+version: 1
+project: code.justin.tv/safety/go2proto
+input: code.justin.tv/safety/go2proto/dummy/interface.go
+interfaces: [TestInterface]
+services:
+  - interface: TestInterface
+    name: Leviathan
+    file: server.proto
+    methods:
+      Function3:
+        results: [names, ""]
+streams:
+  iterators: [iter.Seq, seq.Of]
+  callbacks: true
+proto_package_prefix: code.justin.tv
+embedded: flatten
+naming: go
+templates: templates
+type_mappings:
+  WizardPath: StringArray
+error_codes: twirp
+errors:
+  ErrNotFound: NotFound
+  ValidationError: Malformed
+packages:
+  code.justin.tv/safety/go2proto/dummy/pkg3:
+    skip: true
+  code.justin.tv/safety/go2proto/meta:
+    proto_package: meta.v1
+    type_mappings:
+      ContentTags: StringArray
+    errors:
+      ErrNotFound: FailedPrecondition
+    embedded:
+      Meta: message
+`))
+	assert.NoError(t, err)
+	assert.NoError(t, cfg.Validate())
+	assert.Equal(t, "code.justin.tv/safety/go2proto", cfg.GoProjectPath)
+	assert.Equal(t, []string{"TestInterface"}, cfg.Interfaces)
+	assert.Equal(t, []ServiceConfig{{Interface: "TestInterface", Name: "Leviathan", File: "server.proto", Methods: map[string]MethodConfig{"Function3": {Results: []string{"names", ""}}}}}, cfg.Services)
+	assert.Equal(t, StreamConfig{Iterators: []string{"iter.Seq", "seq.Of"}, Callbacks: true}, cfg.Streams)
+	assert.Equal(t, "out", cfg.OutDir) // default
+	assert.Equal(t, "templates", cfg.TemplatesDir)
+	assert.Equal(t, NamingGo, cfg.Naming)
+	assert.Equal(t, "code.justin.tv.root", cfg.ProtoPackage(cfg.RootPkgName))
+	assert.Equal(t, []string{"code.justin.tv/safety/go2proto/dummy/pkg3"}, cfg.SkippedPackages())
+	assert.Equal(t, "meta.v1", cfg.Packages["code.justin.tv/safety/go2proto/meta"].ProtoPackage)
+
+	metaPath := "code.justin.tv/safety/go2proto/meta"
+	otherPath := "code.justin.tv/safety/go2proto/dummy/pkg1"
+	assert.Equal(t, EmbedMessage, cfg.EmbedStrategy(Struct{Path: Path{Path: &metaPath}, Name: "Meta"}))
+	assert.Equal(t, EmbedFlatten, cfg.EmbedStrategy(Struct{Path: Path{Path: &metaPath}, Name: "Other"}))
+	assert.Equal(t, EmbedFlatten, cfg.EmbedStrategy(Struct{Path: Path{Path: &otherPath}, Name: "Meta"}))
+	fields := []*Field{
+		{Path: Path{Path: &metaPath}, Type: "ContentTags"},
+		{Path: Path{Path: &otherPath}, Type: "ContentTags"},
+		{Path: Path{Path: &otherPath}, Type: "WizardPath"},
+	}
+	applyOverrides(fields, cfg.FieldTypeOverrides(), nil, nil)
+	assert.Equal(t, "StringArray", fields[0].Type)
+	assert.Equal(t, "ContentTags", fields[1].Type)
+	assert.Equal(t, "StringArray", fields[2].Type)
+
+	assert.Equal(t, ErrorCodesTwirp, cfg.ErrorCodes)
+	assert.Equal(t, "FailedPrecondition", cfg.ErrorCode(GoError{Path: Path{Path: &metaPath}, Name: "ErrNotFound"}))
+	assert.Equal(t, "NotFound", cfg.ErrorCode(GoError{Path: Path{Path: &otherPath}, Name: "ErrNotFound"}))
+	assert.Equal(t, "Unknown", cfg.ErrorCode(GoError{Path: Path{Path: &otherPath}, Name: "ErrExists"}))
+	assert.Equal(t, "InvalidArgument", GRPCCode(cfg.ErrorCode(GoError{Path: Path{Path: &otherPath}, Name: "ValidationError", Type: true})))
+
+	// only twirp has a malformed code, the errors point at the key of the invalid setting
+	cfg.ErrorCodes = ErrorCodesGRPC
+	err = cfg.Validate()
+	assert.EqualError(t, err, "dumptruck.yaml:23:1: invalid config: unknown grpc code \"Malformed\" for error ValidationError")
+	assert.True(t, errors.Is(err, ErrInvalidConfig))
+	cfg.Errors = map[string]string{}
+	pkg := cfg.Packages[metaPath]
+	pkg.Errors["ErrNotFound"] = "Missing"
+	assert.EqualError(t, cfg.Validate(), "dumptruck.yaml:26:1: invalid config: unknown grpc code \"Missing\" for error code.justin.tv/safety/go2proto/meta.ErrNotFound")
+
+	// or at the start of the config for a missing one
+	cfg.Input = ""
+	assert.EqualError(t, cfg.Validate(), "dumptruck.yaml:2:1: invalid config: missing input")
+	cfg.source = nil
+	assert.EqualError(t, cfg.Validate(), "invalid config: missing input")
+}
+
+func TestLoadConfigPaths(t *testing.T) {
+	root, err := ioutil.TempDir("", "dumptruck")
+	assert.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	path := filepath.Join(root, "dumptruck.yaml")
+	assert.NoError(t, ioutil.WriteFile(path, []byte(`version: 1
+project: a/b
+input: a/b/c
+module: ../mod
+out: proto
+adapters_out: /abs/adapters
+`), 0644))
+
+	// every path is relative to the config file, not to the working directory
+	cfg, err := LoadConfig(path)
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(filepath.Dir(root), "mod"), cfg.ModuleDir)
+	assert.Equal(t, filepath.Join(root, "proto"), cfg.OutDir)
+	assert.Equal(t, filepath.Join(root, "converters"), cfg.ConvertersDir) // default
+	assert.Equal(t, "/abs/adapters", cfg.AdaptersDir)
+	assert.Equal(t, filepath.Join(root, "dumptruck.lock.json"), cfg.LockFile) // default
+}
+
+func TestParseConfigJSON(t *testing.T) {
+	cfg, err := ParseConfig("dumptruck.json", []byte(`{"version": 1, "project": "a/b", "input": "a/b/c"}`))
+	assert.NoError(t, err)
+	assert.Equal(t, "a/b/c", cfg.Input)
+	assert.Equal(t, FrontendAST, cfg.Frontend)                                  // default
+	assert.Equal(t, "warning", cfg.FailOn)                                      // default
+	assert.Equal(t, EmbedMessage, cfg.Embedded)                                 // default
+	assert.Equal(t, StreamConfig{Iterators: []string{"iter.Seq"}}, cfg.Streams) // default
+	assert.Equal(t, ErrorCodesGRPC, cfg.ErrorCodes)                             // default
+}
+
+func TestParseConfigErrors(t *testing.T) {
+	_, err := ParseConfig("dumptruck.yaml", []byte(`version: 2
+project: code.justin.tv/safety/go2proto
+outdir: out
+frontend: magic
+fail_on: never
+embedded: sideways
+error_codes: http
+naming: camel
+interfaces:
+  - TestInterface
+  - 5
+packages:
+  code.justin.tv/other:
+    skip: yes please
+`))
+	var errs ConfigErrors
+	assert.True(t, errors.As(err, &errs))
+	assert.Equal(t, []string{
+		"dumptruck.yaml:3:1: unknown field \"outdir\"",
+		"dumptruck.yaml:4:11: frontend must be \"ast\" or \"types\"",
+		"dumptruck.yaml:5:10: fail_on must be \"warning\" or \"error\"",
+		"dumptruck.yaml:6:11: embedded must be \"message\" or \"flatten\"",
+		"dumptruck.yaml:7:14: error_codes must be \"grpc\" or \"twirp\"",
+		"dumptruck.yaml:8:9: naming must be \"style\" or \"go\"",
+		"dumptruck.yaml:11:5: interfaces item must be a string",
+		"dumptruck.yaml:1:10: unsupported version 2, expected 1",
+		"dumptruck.yaml:13:3: package \"code.justin.tv/other\" is not in project \"code.justin.tv/safety/go2proto\"",
+	}, errorStrings(errs))
+
+	_, err = ParseConfig("dumptruck.yaml", []byte("project: a/b\n"))
+	assert.EqualError(t, err, "dumptruck.yaml:1:1: missing version, expected version: 1")
+}
+
+func errorStrings(errs ConfigErrors) []string {
+	out := []string{}
+	for _, err := range errs {
+		out = append(out, err.Error())
+	}
+	return out
+}
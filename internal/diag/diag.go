@@ -0,0 +1,164 @@
+// Package diag collects the problems found while transpiling so one unsupported construct
+// doesn't stop the run and every problem can be reported together at the end
+package diag
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"io"
+	"sort"
+	"strings"
+)
+
+var (
+	ErrDiagnostics     = errors.New("transpiling failed")
+	ErrUnknownSeverity = errors.New("unknown severity")
+)
+
+type Severity int
+
+const (
+	Warning Severity = iota // the construct was skipped or approximated, the output is still usable
+	Error                   // the output is missing something it needs
+)
+
+func (s Severity) String() string {
+	switch s {
+	case Warning:
+		return "warning"
+	case Error:
+		return "error"
+	}
+	return fmt.Sprintf("severity(%d)", int(s))
+}
+
+// ParseSeverity is the inverse of Severity.String
+func ParseSeverity(s string) (Severity, error) {
+	switch s {
+	case "warning":
+		return Warning, nil
+	case "error":
+		return Error, nil
+	}
+	return Warning, fmt.Errorf("%w: %q", ErrUnknownSeverity, s)
+}
+
+// Diagnostic is a single problem found in the go source
+type Diagnostic struct {
+	Severity Severity
+	Pos      token.Position // invalid when the problem isn't tied to a position
+	Decl     string         // the go declaration the problem is in e.g. pkg.Struct or pkg.Interface.Method
+	Msg      string
+}
+
+func (d Diagnostic) String() string {
+	sb := strings.Builder{}
+	if d.Pos.IsValid() {
+		sb.WriteString(d.Pos.String())
+		sb.WriteString(": ")
+	}
+	sb.WriteString(d.Severity.String())
+	sb.WriteString(": ")
+	sb.WriteString(d.Msg)
+	if d.Decl != "" {
+		sb.WriteString(" (in ")
+		sb.WriteString(d.Decl)
+		sb.WriteString(")")
+	}
+	return sb.String()
+}
+
+// Diagnostics are all of the problems found during a run
+type Diagnostics []Diagnostic
+
+func (d *Diagnostics) Add(severity Severity, pos token.Position, decl string, format string, args ...interface{}) {
+	*d = append(*d, Diagnostic{
+		Severity: severity,
+		Pos:      pos,
+		Decl:     decl,
+		Msg:      fmt.Sprintf(format, args...),
+	})
+}
+
+// Count returns the number of diagnostics with the given severity
+func (d Diagnostics) Count(severity Severity) int {
+	count := 0
+	for _, diag := range d {
+		if diag.Severity == severity {
+			count++
+		}
+	}
+	return count
+}
+
+// Sort orders the diagnostics by file, line and column
+func (d Diagnostics) Sort() {
+	sort.SliceStable(d, func(i, j int) bool {
+		a, b := d[i].Pos, d[j].Pos
+		if a.Filename != b.Filename {
+			return a.Filename < b.Filename
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+}
+
+// Print writes every diagnostic sorted by position followed by a summary
+func (d Diagnostics) Print(w io.Writer) {
+	if len(d) == 0 {
+		return
+	}
+
+	d.Sort()
+	for _, diag := range d {
+		fmt.Fprintln(w, diag.String())
+	}
+	fmt.Fprintf(w, "%d error(s), %d warning(s)\n", d.Count(Error), d.Count(Warning))
+}
+
+// Err returns an error if there is any diagnostic at least as severe as failOn
+func (d Diagnostics) Err(failOn Severity) error {
+	for _, diag := range d {
+		if diag.Severity >= failOn {
+			return fmt.Errorf("%w: %d error(s), %d warning(s)", ErrDiagnostics, d.Count(Error), d.Count(Warning))
+		}
+	}
+	return nil
+}
+
+// Reporter adds diagnostics for the nodes of a single file set
+type Reporter struct {
+	Fset  *token.FileSet
+	Decl  string
+	Diags *Diagnostics
+}
+
+// In returns a reporter for the nodes of the named declaration
+func (r Reporter) In(decl string) Reporter {
+	r.Decl = decl
+	return r
+}
+
+func (r Reporter) Warnf(node ast.Node, format string, args ...interface{}) {
+	r.add(Warning, node, format, args...)
+}
+
+func (r Reporter) Errorf(node ast.Node, format string, args ...interface{}) {
+	r.add(Error, node, format, args...)
+}
+
+// Position returns the position of node, invalid if the reporter has no file set
+func (r Reporter) Position(node ast.Node) token.Position {
+	if r.Fset == nil || node == nil {
+		return token.Position{}
+	}
+	return r.Fset.Position(node.Pos())
+}
+
+func (r Reporter) add(severity Severity, node ast.Node, format string, args ...interface{}) {
+	r.Diags.Add(severity, r.Position(node), r.Decl, format, args...)
+}
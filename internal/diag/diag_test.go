@@ -0,0 +1,41 @@
+package diag
+
+import (
+	"bytes"
+	"go/token"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiagnostics(t *testing.T) {
+	diags := Diagnostics{}
+	diags.Add(Warning, token.Position{Filename: "b.go", Line: 3, Column: 2}, "pkg.B", "skipping field %s", "F")
+	diags.Add(Error, token.Position{Filename: "a.go", Line: 10, Column: 1}, "", "undefined: Missing")
+	diags.Add(Warning, token.Position{}, "", "no position")
+
+	assert.Equal(t, 1, diags.Count(Error))
+	assert.Equal(t, 2, diags.Count(Warning))
+	assert.ErrorIs(t, diags.Err(Warning), ErrDiagnostics)
+	assert.ErrorIs(t, diags.Err(Error), ErrDiagnostics)
+	assert.NoError(t, diags[:1].Err(Error))
+
+	out := &bytes.Buffer{}
+	diags.Print(out)
+	assert.Equal(t, `warning: no position
+a.go:10:1: error: undefined: Missing
+b.go:3:2: warning: skipping field F (in pkg.B)
+1 error(s), 2 warning(s)
+`, out.String())
+}
+
+func TestParseSeverity(t *testing.T) {
+	for _, severity := range []Severity{Warning, Error} {
+		parsed, err := ParseSeverity(severity.String())
+		assert.NoError(t, err)
+		assert.Equal(t, severity, parsed)
+	}
+
+	_, err := ParseSeverity("fatal")
+	assert.ErrorIs(t, err, ErrUnknownSeverity)
+}
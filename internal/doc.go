@@ -0,0 +1,26 @@
+package internal
+
+import (
+	"go/ast"
+	"strings"
+)
+
+// DocText returns the text of the first comment group that has any, without comment markers and directives
+// such as //dumptruck:service, used for a doc comment that falls back to a trailing line comment
+func DocText(groups ...*ast.CommentGroup) string {
+	for _, group := range groups {
+		if text := strings.TrimSpace(group.Text()); text != "" {
+			return text
+		}
+	}
+	return ""
+}
+
+// ApplyFieldDoc sets the doc of every field converted from field, its doc comment or else its line comment
+func ApplyFieldDoc(field *ast.Field, fields []*Field) []*Field {
+	doc := DocText(field.Doc, field.Comment)
+	for _, f := range fields {
+		f.Doc = doc
+	}
+	return fields
+}
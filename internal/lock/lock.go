@@ -0,0 +1,252 @@
+// Package lock records the field numbers, enum values and rpcs dumptruck assigned so regenerating the protos
+// after the go code changed never renumbers anything that was already generated
+package lock
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+)
+
+// Version is the only lock file version this transpiler understands
+const Version = 1
+
+// DefaultFile is the name of the lock file written next to the config file
+const DefaultFile = "dumptruck.lock.json"
+
+var ErrUnsupportedVersion = errors.New("unsupported lock file version")
+
+// File is the content of a lock file, every map is keyed by the full proto name e.g. dummy.pkg4.D
+type File struct {
+	Version  int                 `json:"version"`
+	Messages map[string]*Numbers `json:"messages"`
+	Enums    map[string]*Numbers `json:"enums"`
+	Services map[string]*Numbers `json:"services"`
+}
+
+// Numbers are the numbers of the fields of a message, the values of an enum or the rpcs of a service
+// and everything that was removed from it since
+type Numbers struct {
+	Numbers         map[string]int `json:"numbers"`
+	ReservedNumbers []int          `json:"reserved_numbers,omitempty"`
+	ReservedNames   []string       `json:"reserved_names,omitempty"`
+}
+
+// Entry is a field, enum value or rpc to number
+type Entry struct {
+	Name      string
+	Number    int  // only used when Fixed or Preferred
+	Fixed     bool // Number was given explicitly (e.g. by a struct tag) and wins over the locked number
+	Preferred bool // Number should be used unless it was already locked or taken, only used for new entries
+}
+
+// IsReserved returns true if number belonged to an entry that was removed or renumbered
+func (n *Numbers) IsReserved(number int) bool {
+	for _, reserved := range n.ReservedNumbers {
+		if reserved == number {
+			return true
+		}
+	}
+	return false
+}
+
+func New() *File {
+	return &File{
+		Version:  Version,
+		Messages: map[string]*Numbers{},
+		Enums:    map[string]*Numbers{},
+		Services: map[string]*Numbers{},
+	}
+}
+
+// Load reads the lock file at path, a missing file is an empty lock file
+func Load(path string) (*File, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return New(), nil
+	} else if err != nil {
+		return nil, err
+	}
+	return Parse(path, data)
+}
+
+// Parse parses the content of a lock file, path is only used in errors
+func Parse(path string, data []byte) (*File, error) {
+	f := New()
+	if err := json.Unmarshal(data, f); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if f.Version != Version {
+		return nil, fmt.Errorf("%s: %w %d, expected %d", path, ErrUnsupportedVersion, f.Version, Version)
+	}
+	for _, m := range []*map[string]*Numbers{&f.Messages, &f.Enums, &f.Services} {
+		if *m == nil {
+			*m = map[string]*Numbers{}
+		}
+		for name, numbers := range *m {
+			if numbers == nil {
+				numbers = &Numbers{}
+				(*m)[name] = numbers
+			}
+			if numbers.Numbers == nil {
+				numbers.Numbers = map[string]int{}
+			}
+		}
+	}
+	return f, nil
+}
+
+// Save writes the lock file to path, the output is sorted so it diffs well
+func (f *File) Save(path string) error {
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// Message returns the numbers of the fields of the named message, creating them if needed
+func (f *File) Message(name string) *Numbers {
+	return get(f.Messages, name)
+}
+
+// Enum returns the values of the named enum, creating them if needed
+func (f *File) Enum(name string) *Numbers {
+	return get(f.Enums, name)
+}
+
+// Service returns the numbers of the rpcs of the named service, creating them if needed
+func (f *File) Service(name string) *Numbers {
+	return get(f.Services, name)
+}
+
+func get(m map[string]*Numbers, name string) *Numbers {
+	if _, ok := m[name]; !ok {
+		m[name] = &Numbers{Numbers: map[string]int{}}
+	}
+	return m[name]
+}
+
+// Rename moves the locked number of old to new unless new already has one, it returns true if it was moved
+func (n *Numbers) Rename(old string, new string) bool {
+	number, ok := n.Numbers[old]
+	if _, taken := n.Numbers[new]; !ok || taken || old == new {
+		return false
+	}
+	delete(n.Numbers, old)
+	n.Numbers[new] = number
+	return true
+}
+
+// reservedByProtobuf is true for the field numbers protobuf keeps for itself
+func reservedByProtobuf(number int) bool {
+	return number >= 19000 && number <= 19999
+}
+
+// Assign numbers every entry and updates the locked numbers, the returned numbers are in the order of entries
+// entries keep their locked number, new entries get their preferred or positional number (counting from first)
+// when it is free and the next unused number otherwise, locked entries that are gone are reserved
+func (n *Numbers) Assign(entries []Entry, first int) []int {
+	present := map[string]struct{}{}
+	for _, e := range entries {
+		present[e.Name] = struct{}{}
+	}
+
+	for name, number := range n.Numbers {
+		if _, ok := present[name]; !ok {
+			n.ReservedNumbers = append(n.ReservedNumbers, number)
+			n.ReservedNames = append(n.ReservedNames, name)
+			delete(n.Numbers, name)
+		}
+	}
+	// a name that came back can be used again but not with its old number
+	names := []string{}
+	for _, name := range n.ReservedNames {
+		if _, ok := present[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	n.ReservedNames = names
+
+	reserved := map[int]struct{}{}
+	max := first - 1
+	for _, number := range n.ReservedNumbers {
+		reserved[number] = struct{}{}
+		if number > max {
+			max = number
+		}
+	}
+	used := map[int]struct{}{}
+	take := func(number int) {
+		used[number] = struct{}{}
+		if number > max {
+			max = number
+		}
+	}
+	free := func(number int) bool {
+		_, isUsed := used[number]
+		_, isReserved := reserved[number]
+		return number >= first && !isUsed && !isReserved && !reservedByProtobuf(number)
+	}
+
+	out := make([]int, len(entries))
+	assigned := make([]bool, len(entries))
+	for idx, e := range entries {
+		if !e.Fixed {
+			continue
+		}
+		// the old number of a renumbered entry can't be reused by anything else
+		if number, ok := n.Numbers[e.Name]; ok && number != e.Number {
+			n.ReservedNumbers = append(n.ReservedNumbers, number)
+			reserved[number] = struct{}{}
+			delete(n.Numbers, e.Name)
+		}
+		out[idx], assigned[idx] = e.Number, true
+		take(e.Number)
+	}
+	for idx, e := range entries {
+		if number, ok := n.Numbers[e.Name]; ok && !assigned[idx] && free(number) {
+			out[idx], assigned[idx] = number, true
+			take(number)
+		}
+	}
+	// the numbers of the other locked entries are never handed out to a new entry
+	for _, number := range n.Numbers {
+		if number > max {
+			max = number
+		}
+		reserved[number] = struct{}{}
+	}
+
+	position := first
+	for idx, e := range entries {
+		if assigned[idx] {
+			continue
+		}
+		number := position
+		if e.Preferred {
+			number = e.Number
+		} else {
+			position++
+		}
+		if !free(number) {
+			number = max + 1
+			for !free(number) {
+				number++
+			}
+		}
+		out[idx], assigned[idx] = number, true
+		take(number)
+	}
+
+	n.Numbers = map[string]int{}
+	for idx, e := range entries {
+		n.Numbers[e.Name] = out[idx]
+	}
+	sort.Ints(n.ReservedNumbers)
+	sort.Strings(n.ReservedNames)
+	return out
+}
@@ -0,0 +1,89 @@
+package lock
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func entries(names ...string) []Entry {
+	out := make([]Entry, len(names))
+	for idx, name := range names {
+		out[idx] = Entry{Name: name}
+	}
+	return out
+}
+
+func TestAssign(t *testing.T) {
+	n := &Numbers{Numbers: map[string]int{}}
+
+	// the first run numbers by position
+	assert.Equal(t, []int{1, 2, 3}, n.Assign(entries("A", "B", "C"), 1))
+
+	// B is removed and D is inserted before C, nothing moves and B is never reused
+	assert.Equal(t, []int{1, 4, 3}, n.Assign(entries("A", "D", "C"), 1))
+	assert.Equal(t, []int{2}, n.ReservedNumbers)
+	assert.Equal(t, []string{"B"}, n.ReservedNames)
+
+	// a name that comes back gets a new number and is no longer a reserved name
+	assert.Equal(t, []int{1, 4, 3, 5}, n.Assign(entries("A", "D", "C", "B"), 1))
+	assert.Equal(t, []int{2}, n.ReservedNumbers)
+	assert.Empty(t, n.ReservedNames)
+
+	// a fixed number wins over the lock file and reserves the old one
+	assert.Equal(t, []int{10, 4, 3, 5}, n.Assign([]Entry{{Name: "A", Number: 10, Fixed: true}, {Name: "D"}, {Name: "C"}, {Name: "B"}}, 1))
+	assert.Equal(t, []int{1, 2}, n.ReservedNumbers)
+
+	// a preferred number is only used for new entries
+	assert.Equal(t, []int{10, 4, 3, 5, 1001}, n.Assign([]Entry{{Name: "A", Number: 10, Fixed: true}, {Name: "D", Number: 7, Preferred: true}, {Name: "C"}, {Name: "B"}, {Name: "E", Number: 1001, Preferred: true}}, 1))
+}
+
+func TestAssignSkipsReservedNumbers(t *testing.T) {
+	n := &Numbers{Numbers: map[string]int{"A": 18999}}
+	assert.Equal(t, []int{18999, 20000, 1}, n.Assign([]Entry{{Name: "A"}, {Name: "B", Number: 19000, Preferred: true}, {Name: "C"}}, 1))
+
+	// enums count from 0
+	values := &Numbers{Numbers: map[string]int{}}
+	assert.Equal(t, []int{0, 1}, values.Assign(entries("X", "Y"), 0))
+}
+
+func TestRename(t *testing.T) {
+	n := &Numbers{Numbers: map[string]int{"Field1": 1, "Field2": 2, "b": 3}}
+	assert.True(t, n.Rename("Field1", "a"))
+	assert.Equal(t, map[string]int{"a": 1, "Field2": 2, "b": 3}, n.Numbers)
+
+	// unlocked names and names that are already locked don't move
+	assert.False(t, n.Rename("Field3", "c"))
+	assert.False(t, n.Rename("Field2", "b"))
+	assert.False(t, n.Rename("b", "b"))
+	assert.Equal(t, map[string]int{"a": 1, "Field2": 2, "b": 3}, n.Numbers)
+}
+
+func TestLoadAndSave(t *testing.T) {
+	root, err := ioutil.TempDir("", "dumptruck")
+	assert.NoError(t, err)
+	defer os.RemoveAll(root)
+	path := filepath.Join(root, DefaultFile)
+
+	// a missing lock file is an empty one
+	f, err := Load(path)
+	assert.NoError(t, err)
+	assert.Empty(t, f.Messages)
+
+	f.Message("pkg.M").Assign(entries("A", "B"), 1)
+	f.Message("pkg.M").Assign(entries("B"), 1)
+	assert.NoError(t, f.Save(path))
+
+	loaded, err := Load(path)
+	assert.NoError(t, err)
+	assert.Equal(t, f, loaded)
+	assert.Equal(t, map[string]int{"B": 2}, loaded.Message("pkg.M").Numbers)
+	assert.Equal(t, []int{1}, loaded.Message("pkg.M").ReservedNumbers)
+
+	_, err = Parse("future.json", []byte(`{"version": 2}`))
+	assert.True(t, errors.Is(err, ErrUnsupportedVersion))
+}
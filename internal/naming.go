@@ -0,0 +1,97 @@
+package internal
+
+import (
+	"strings"
+	"unicode"
+)
+
+// SnakeCase converts a go identifier to snake_case, initialisms stay together e.g. HTTPServer is http_server
+func SnakeCase(name string) string {
+	runes := []rune(name)
+	sb := strings.Builder{}
+	for idx, r := range runes {
+		if unicode.IsUpper(r) {
+			if idx > 0 && runes[idx-1] != '_' {
+				prevLower := unicode.IsLower(runes[idx-1]) || unicode.IsDigit(runes[idx-1])
+				// the last letter of an initialism followed by a word starts that word
+				endsInitialism := unicode.IsUpper(runes[idx-1]) && idx+1 < len(runes) && unicode.IsLower(runes[idx+1])
+				if prevLower || endsInitialism {
+					sb.WriteByte('_')
+				}
+			}
+			sb.WriteRune(unicode.ToLower(r))
+			continue
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+// EnumValueName returns the SCREAMING_SNAKE_CASE name of a value of enum prefixed with the name of enum, the values
+// of proto3 enums share the scope of the package e.g. COUNTRY_CANADA for Canada. A value that already starts with
+// the name of its enum isn't prefixed twice, SortTypeAsc of SortType is SORT_TYPE_ASC
+func EnumValueName(enum string, value string) string {
+	prefix := strings.ToUpper(SnakeCase(enum))
+	name := strings.ToUpper(SnakeCase(value))
+	if name == prefix || strings.HasPrefix(name, prefix+"_") {
+		return name
+	}
+	return prefix + "_" + name
+}
+
+// UnspecifiedValueName returns the name of the value 0 of an enum that unset fields read back as e.g.
+// COUNTRY_UNSPECIFIED, CountryUnspecified with NamingGo
+func UnspecifiedValueName(enum string, naming string) string {
+	if naming == NamingGo {
+		return enum + "Unspecified"
+	}
+	return EnumValueName(enum, "Unspecified")
+}
+
+// ApplyNaming names the fields of structs and the enum values that aren't named yet (e.g. by a struct tag) after
+// the naming policy, NamingGo keeps the go names. The go names stay in Field.Name and EnumAssignment.Name, they
+// are what the converters and adapters look the proto names up by
+func ApplyNaming(structs []Struct, enums []EnumAssignment, naming string) {
+	if naming == NamingGo {
+		return
+	}
+	for _, s := range structs {
+		for _, f := range s.Fields {
+			if f.ProtoName == "" {
+				f.ProtoName = SnakeCase(f.Name)
+			}
+		}
+	}
+	for idx := range enums {
+		if enums[idx].ProtoName == "" {
+			enums[idx].ProtoName = EnumValueName(enums[idx].FuncName, enums[idx].Name)
+		}
+	}
+}
+
+// Plural returns the english plural of a snake_case name e.g. addresses for address
+func Plural(name string) string {
+	switch {
+	case name == "":
+		return name
+	case strings.HasSuffix(name, "s") || strings.HasSuffix(name, "x") || strings.HasSuffix(name, "z") ||
+		strings.HasSuffix(name, "ch") || strings.HasSuffix(name, "sh"):
+		return name + "es"
+	case strings.HasSuffix(name, "y") && len(name) > 1 && !strings.ContainsAny(name[len(name)-2:len(name)-1], "aeiou"):
+		return name[:len(name)-1] + "ies"
+	}
+	return name + "s"
+}
+
+// TypeFieldName derives the snake_case name of an unnamed parameter or result from its type
+// e.g. strings for []string, a for *pkg1.A and as_by_country for map[nest.Country][]*pkg1.A
+func TypeFieldName(f *Field) string {
+	if f.IsMap() {
+		return TypeFieldName(f.MapValue) + "_by_" + TypeFieldName(f.MapKey)
+	}
+	name := SnakeCase(f.Type[strings.LastIndex(f.Type, ".")+1:])
+	if f.Repeated {
+		return Plural(name)
+	}
+	return name
+}
@@ -0,0 +1,76 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSnakeCase(t *testing.T) {
+	for name, expected := range map[string]string{
+		"Leviathan":     "leviathan",
+		"TestInterface": "test_interface",
+		"HTTPServer":    "http_server",
+		"UserID":        "user_id",
+		"V2Service":     "v2_service",
+		"already_snake": "already_snake",
+		"Snake_Case":    "snake_case",
+	} {
+		assert.Equal(t, expected, SnakeCase(name), name)
+	}
+}
+
+func TestTypeFieldName(t *testing.T) {
+	country := &Field{Type: "nest.Country"}
+	for expected, field := range map[string]*Field{
+		"strings":         {Type: "string", Repeated: true},
+		"a":               {Type: "pkg1.A", Optional: true},
+		"addresses":       {Type: "Address", Repeated: true},
+		"categories":      {Type: "Category", Repeated: true},
+		"keys":            {Type: "Key", Repeated: true},
+		"http_server":     {Type: "HTTPServer"},
+		"as_by_country":   {Type: "map", MapKey: country, MapValue: &Field{Type: "pkg1.A", Repeated: true}},
+		"int64_by_string": {Type: "map", MapKey: &Field{Type: "string"}, MapValue: &Field{Type: "int64"}},
+	} {
+		assert.Equal(t, expected, TypeFieldName(field), expected)
+	}
+}
+
+func TestEnumValueName(t *testing.T) {
+	assert.Equal(t, "COUNTRY_CANADA", EnumValueName("Country", "Canada"))
+	assert.Equal(t, "COUNTRY_US", EnumValueName("Country", "US"))
+	assert.Equal(t, "HTTP_METHOD_GET", EnumValueName("HTTPMethod", "Get"))
+	// values named after their enum aren't prefixed twice
+	assert.Equal(t, "SORT_TYPE_ASC", EnumValueName("SortType", "SortTypeAsc"))
+	assert.Equal(t, "SORT_TYPE_SORT_ASCENDING", EnumValueName("SortType", "SortAscending"))
+}
+
+func TestUnspecifiedValueName(t *testing.T) {
+	assert.Equal(t, "COUNTRY_UNSPECIFIED", UnspecifiedValueName("Country", NamingStyle))
+	assert.Equal(t, "CountryUnspecified", UnspecifiedValueName("Country", NamingGo))
+}
+
+func TestApplyNaming(t *testing.T) {
+	structs := []Struct{{Name: "User", Fields: []*Field{{Name: "CreatedAt"}, {Name: "ID"}, {Name: "Tagged", ProtoName: "tag"}}}}
+	enums := []EnumAssignment{
+		{Name: "Canada", FuncName: "Country"},
+		{Name: "Mexico", FuncName: "Country"},
+		{Name: "Borgir", FuncName: "Food", ProtoName: "BURGER"},
+	}
+	ApplyNaming(structs, enums, NamingStyle)
+	assert.Equal(t, "created_at", structs[0].Fields[0].ProtoFieldName())
+	assert.Equal(t, "id", structs[0].Fields[1].ProtoFieldName())
+	assert.Equal(t, "tag", structs[0].Fields[2].ProtoFieldName())
+	assert.Equal(t, "COUNTRY_CANADA", enums[0].ProtoValueName())
+	assert.Equal(t, "COUNTRY_MEXICO", enums[1].ProtoValueName())
+	assert.Equal(t, "BURGER", enums[2].ProtoValueName())
+	// the go names are kept for the converters
+	assert.Equal(t, "CreatedAt", structs[0].Fields[0].Name)
+	assert.Equal(t, "Canada", enums[0].Name)
+
+	structs = []Struct{{Name: "User", Fields: []*Field{{Name: "CreatedAt"}}}}
+	enums = []EnumAssignment{{Name: "Canada", FuncName: "Country"}}
+	ApplyNaming(structs, enums, NamingGo)
+	assert.Equal(t, "CreatedAt", structs[0].Fields[0].ProtoFieldName())
+	assert.Equal(t, "Canada", enums[0].ProtoValueName())
+}
@@ -3,12 +3,17 @@ package internal
 import (
 	"fmt"
 	"go/ast"
-	"log"
+	"go/types"
+	"strings"
+
+	"code.justin.tv/safety/go2proto/internal/diag"
 )
 
-func ProcessFields(fields []*ast.Field, pkgName string, path Path) []*Field {
+// ProcessFields converts the fields of a struct or func, fields that can't be converted are reported to r and skipped
+func ProcessFields(fields []*ast.Field, pkgName string, path Path, r diag.Reporter) []*Field {
 	outFields := []*Field{}
 	for _, field := range fields {
+		start := len(outFields)
 		switch field.Type.(type) {
 		case *ast.Ident:
 			i := field.Type.(*ast.Ident)
@@ -17,9 +22,10 @@ func ProcessFields(fields []*ast.Field, pkgName string, path Path) []*Field {
 			// If there are no names then we just use a default field an assume a name that is the type
 			if len(field.Names) == 0 {
 				outFields = append(outFields, &Field{
-					Path: path,
-					Name: fieldType,
-					Type: fieldType,
+					Path:     path,
+					Name:     fieldType,
+					Type:     fieldType,
+					Embedded: true,
 				})
 			}
 
@@ -33,164 +39,272 @@ func ProcessFields(fields []*ast.Field, pkgName string, path Path) []*Field {
 		case *ast.ArrayType:
 			i := field.Type.(*ast.ArrayType)
 			if si, ok := i.Elt.(*ast.Ident); ok {
-				name := si.Name
-				if len(field.Names) > 0 {
-					name = field.Names[0].Name
-				}
-				outFields = append(outFields, &Field{
-					Path:     path,
-					Name:     name,
-					Type:     si.Name,
-					Repeated: true,
-				})
-			} else if si, ok := i.Elt.(*ast.SelectorExpr); ok {
-				if si2, ok := si.X.(*ast.Ident); ok {
-					fieldType := si.Sel.Name
+				for _, name := range fieldNames(field, si.Name) {
 					outFields = append(outFields, &Field{
 						Path:     path,
+						Name:     name,
+						Type:     si.Name,
 						Repeated: true,
-						Selector: true,
-						Package:  si2.Name,
-						Name:     field.Names[0].Name,
-						Type:     si2.Name + "." + fieldType,
 					})
+				}
+			} else if si, ok := i.Elt.(*ast.SelectorExpr); ok {
+				if si2, ok := si.X.(*ast.Ident); ok {
+					fieldType := si.Sel.Name
+					for _, name := range fieldNames(field, fieldType) {
+						outFields = append(outFields, &Field{
+							Path:     path,
+							Repeated: true,
+							Selector: true,
+							Package:  si2.Name,
+							Name:     name,
+							Type:     si2.Name + "." + fieldType,
+						})
+					}
 				} else {
-					panic("missing parser for array of selector")
+					r.Warnf(field, "skipping field %s: unsupported type %s", fieldName(field, "unknown_name"), types.ExprString(field.Type))
 				}
 			} else if i, ok := i.Elt.(*ast.StarExpr); ok {
 				if si, ok := i.X.(*ast.Ident); ok {
 					fieldType := si.Name
-					name := "unknown_name"
-					if len(field.Names) > 0 {
-						name = field.Names[0].Name
-					}
-					outFields = append(outFields, &Field{
-						Path:     path,
-						Repeated: true,
-						Optional: true,
-						Name:     name,
-						Type:     fieldType,
-					})
-				} else if si, ok := i.X.(*ast.SelectorExpr); ok {
-					if si2, ok := si.X.(*ast.Ident); ok {
-						fieldType := si.Sel.Name
-						name := si2.Name // package prefix selector
-						if len(field.Names) > 0 {
-							name = field.Names[0].Name
-						}
+					for _, name := range fieldNames(field, "unknown_name") {
 						outFields = append(outFields, &Field{
 							Path:     path,
 							Repeated: true,
-							Selector: true,
-							Package:  si2.Name,
 							Optional: true,
 							Name:     name,
-							Type:     si2.Name + "." + fieldType,
+							Type:     fieldType,
 						})
-					} else if _, ok := si.X.(*ast.SelectorExpr); ok {
-						// array of non ptr type
-						panic("WTF")
-
+					}
+				} else if si, ok := i.X.(*ast.SelectorExpr); ok {
+					if si2, ok := si.X.(*ast.Ident); ok {
+						fieldType := si.Sel.Name
+						// package prefix selector
+						for _, name := range fieldNames(field, si2.Name) {
+							outFields = append(outFields, &Field{
+								Path:     path,
+								Repeated: true,
+								Selector: true,
+								Package:  si2.Name,
+								Optional: true,
+								Name:     name,
+								Type:     si2.Name + "." + fieldType,
+							})
+						}
 					} else {
-						panic("missing selector")
+						r.Warnf(field, "skipping field %s: unsupported selector %s", fieldName(field, "unknown_name"), types.ExprString(si))
 					}
-				} else if _, ok := i.X.(*ast.MapType); !ok {
-					panic("not a map")
+				} else if m, ok := i.X.(*ast.MapType); ok {
+					outFields = appendMapField(outFields, field, m, true, path, r)
+				} else {
+					r.Warnf(field, "skipping field %s: unsupported type %s", fieldName(field, "unknown_name"), types.ExprString(field.Type))
 				}
+			} else if m, ok := field.Type.(*ast.ArrayType).Elt.(*ast.MapType); ok {
+				outFields = appendMapField(outFields, field, m, true, path, r)
 			} else {
-				panic("missing")
+				r.Warnf(field, "skipping field %s: unsupported type %s", fieldName(field, "unknown_name"), types.ExprString(field.Type))
 			}
 		case *ast.SelectorExpr:
 			selector := field.Type.(*ast.SelectorExpr)
 			if pkgtag, ok := selector.X.(*ast.Ident); ok {
-				//pkgtag.Name
-				outFields = append(outFields, &Field{
-					Path:     path,
-					Selector: true,
-					Name:     field.Names[0].Name,
-					Type:     fmt.Sprintf("%s.%s", pkgtag.Name, selector.Sel.Name),
-				})
+				for _, name := range fieldNames(field, selector.Sel.Name) {
+					outFields = append(outFields, &Field{
+						Path:     path,
+						Selector: true,
+						Embedded: len(field.Names) == 0,
+						Name:     name,
+						Type:     fmt.Sprintf("%s.%s", pkgtag.Name, selector.Sel.Name),
+					})
+				}
 			} else {
-				panic("not valid selector expr")
+				r.Warnf(field, "skipping field %s: unsupported selector %s", fieldName(field, "unknown_name"), types.ExprString(selector))
 			}
 
 		case *ast.StarExpr:
 			i := field.Type.(*ast.StarExpr)
 			if si, ok := i.X.(*ast.Ident); ok {
 				fieldType := si.Name
-				outField := &Field{
-					Path:     path,
-					Optional: true,
-					Name:     "",
-					Type:     fieldType,
-				}
-
-				if len(field.Names) > 0 {
-					outField.Name = field.Names[0].Name
+				for _, name := range fieldNames(field, fieldType) {
+					outFields = append(outFields, &Field{
+						Path:     path,
+						Optional: true,
+						Embedded: len(field.Names) == 0,
+						Name:     name,
+						Type:     fieldType,
+					})
 				}
-				outFields = append(outFields, outField)
 			} else if si, ok := i.X.(*ast.SelectorExpr); ok {
 				if si2, ok := si.X.(*ast.Ident); ok {
 					fieldType := si.Sel.Name
-					name := si2.Name
-					if len(field.Names) > 0 {
-						name = field.Names[0].Name
+					for _, name := range fieldNames(field, fieldType) {
+						outFields = append(outFields, &Field{
+							Path:     path,
+							Package:  si2.Name,
+							Selector: true,
+							Optional: true,
+							Embedded: len(field.Names) == 0,
+							Name:     name,
+							Type:     si2.Name + "." + fieldType,
+						})
 					}
+				} else {
+					r.Warnf(field, "skipping field %s: unsupported selector %s", fieldName(field, "unknown_name"), types.ExprString(si))
+				}
+			} else if m, ok := i.X.(*ast.MapType); ok {
+				// proto maps can't be optional, a nil *map is the same as an empty map
+				outFields = appendMapField(outFields, field, m, false, path, r)
+			} else {
+				// The only thing we can't parse in ChatEntry.Key
+				for _, name := range fieldNames(field, "unknown_name") {
+					r.Warnf(field, "field %s: unsupported pointer type %s, transpiled as unknown", name, types.ExprString(i.X))
 					outFields = append(outFields, &Field{
 						Path:     path,
-						Package:  si2.Name,
-						Selector: true,
+						Package:  pkgName,
 						Optional: true,
 						Name:     name,
-						Type:     si2.Name + "." + fieldType,
+						Type:     "unknown",
 					})
-				} else {
-					panic("missing x")
-				}
-			} else if _, ok := i.X.(*ast.MapType); ok {
-				/*outFields = append(outFields, Field{
-					FilePath: filePath,
-					Path:     path,
-					Package:  pkgName,
-					Optional: true,
-					Name:     field.Names[0].Name,
-					Type:     "unknown_map",
-				})*/
-				log.Println("Ignoring map", path, pkgName, field.Names[0].Name)
-			} else {
-				// The only thing we can't parse in ChatEntry.Key
-				log.Println("Missing parser for this", fields)
-				name := "unknown_name"
-				if len(field.Names) > 0 {
-					name = field.Names[0].Name
 				}
+			}
+		case *ast.InterfaceType:
+			for _, name := range fieldNames(field, "unknown_name") {
 				outFields = append(outFields, &Field{
 					Path:     path,
+					Optional: false,
 					Package:  pkgName,
-					Optional: true,
 					Name:     name,
-					Type:     "unknown",
+					Type:     "interface",
 				})
 			}
-		case *ast.InterfaceType:
-			name := "unknown_name"
-			if len(field.Names) > 0 {
-				name = field.Names[0].Name
-			}
-			outFields = append(outFields, &Field{
-				Path:     path,
-				Optional: false,
-				Package:  pkgName,
-				Name:     name,
-				Type:     "interface",
-			})
+		case *ast.MapType:
+			outFields = appendMapField(outFields, field, field.Type.(*ast.MapType), false, path, r)
 		default:
-			outFields = append(outFields, &Field{
-				Path: path,
-				Name: field.Names[0].Name,
-				Type: field.Names[0].Name,
-			})
+			if streamed, ok := streamFields(field, path); ok {
+				outFields = append(outFields, streamed...)
+				break
+			}
+			for _, name := range fieldNames(field, "unknown_name") {
+				r.Warnf(field, "field %s: unsupported type %s, transpiled as %s", name, types.ExprString(field.Type), name)
+				outFields = append(outFields, &Field{
+					Path: path,
+					Name: name,
+					Type: name,
+				})
+			}
+		}
+
+		for _, outField := range outFields[start:] {
+			outField.Pos = r.Position(field)
+			// unnamed parameters and results are anonymous too
+			outField.Embedded = outField.Embedded || len(field.Names) == 0
+			// like the type checked frontend the package of unqualified types is the package of the field
+			if outField.Package == "" {
+				outField.Package = pkgName
+			}
+		}
+		outFields = append(outFields[:start], ApplyFieldTag(field, ApplyFieldDoc(field, outFields[start:]), r)...)
+	}
+	return outFields
+}
+
+// appendMapField appends a map field for every name of field, repeated is set for a slice of maps
+func appendMapField(outFields []*Field, field *ast.Field, m *ast.MapType, repeated bool, path Path, r diag.Reporter) []*Field {
+	for _, name := range fieldNames(field, "unknown_name") {
+		mapField, ok := exprField(m, path)
+		if !ok {
+			r.Warnf(field, "skipping field %s: unsupported map %s", name, types.ExprString(m))
+			continue
 		}
+		mapField.Name = name
+		mapField.Repeated = repeated
+		outFields = append(outFields, mapField)
 	}
 	return outFields
 }
+
+// streamFields converts a field that is a channel, callback or iterator into a field for every name of it with the
+// type of the values it streams, whether the field actually streams is checked once the config is known
+func streamFields(field *ast.Field, path Path) ([]*Field, bool) {
+	kind, iterator, elem, ok := StreamElem(field.Type)
+	if !ok {
+		return nil, false
+	}
+	elemField, ok := exprField(elem, path)
+	if !ok {
+		return nil, false
+	}
+
+	out := []*Field{}
+	for _, name := range fieldNames(field, elemField.Type[strings.LastIndex(elemField.Type, ".")+1:]) {
+		f := elemField.Copy()
+		f.Name = name
+		f.Stream = kind
+		f.Iterator = iterator
+		out = append(out, f)
+	}
+	return out, true
+}
+
+// exprField converts the type expression of a map key or value, false for unsupported types
+func exprField(expr ast.Expr, path Path) (*Field, bool) {
+	switch e := expr.(type) {
+	case *ast.Ident:
+		return &Field{Path: path, Type: e.Name}, true
+	case *ast.SelectorExpr:
+		pkgtag, ok := e.X.(*ast.Ident)
+		if !ok {
+			return nil, false
+		}
+		return &Field{
+			Path:     path,
+			Selector: true,
+			Package:  pkgtag.Name,
+			Type:     pkgtag.Name + "." + e.Sel.Name,
+		}, true
+	case *ast.StarExpr:
+		f, ok := exprField(e.X, path)
+		if ok {
+			f.Optional = true
+		}
+		return f, ok
+	case *ast.ArrayType:
+		if ident, ok := e.Elt.(*ast.Ident); ok && ident.Name == "byte" {
+			return &Field{Path: path, Type: "bytes"}, true
+		}
+		f, ok := exprField(e.Elt, path)
+		if !ok || f.Repeated {
+			return nil, false
+		}
+		f.Repeated = true
+		return f, true
+	case *ast.InterfaceType:
+		return &Field{Path: path, Type: "interface"}, true
+	case *ast.MapType:
+		key, ok := exprField(e.Key, path)
+		if !ok {
+			return nil, false
+		}
+		value, ok := exprField(e.Value, path)
+		if !ok {
+			return nil, false
+		}
+		return &Field{Path: path, Type: "map", MapKey: key, MapValue: value}, true
+	}
+	return nil, false
+}
+
+// fieldNames returns the names of a field or def for an unnamed field
+func fieldNames(field *ast.Field, def string) []string {
+	names := []string{}
+	for _, name := range field.Names {
+		names = append(names, name.Name)
+	}
+	if len(names) == 0 {
+		names = append(names, def)
+	}
+	return names
+}
+
+// fieldName returns the names of a field joined for a diagnostic or def for an unnamed field
+func fieldName(field *ast.Field, def string) string {
+	return strings.Join(fieldNames(field, def), ", ")
+}
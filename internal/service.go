@@ -0,0 +1,193 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"code.justin.tv/safety/go2proto/internal/diag"
+)
+
+var ErrDuplicateService = errors.New("duplicate service")
+
+// Service is a go interface transpiled to a proto service, its request and response messages are in its own package
+type Service struct {
+	Name      string
+	Interface string
+	Package   string // proto package of the service and its request and response messages
+	GoPackage string
+	File      string // path of the .proto file in the output directory
+	Doc       string // doc comment of the interface
+	Funcs     []Function
+}
+
+// BuildServices groups funcs into a service per interface. The interfaces listed in cfg.Services or annotated with
+// a //dumptruck:service comment are services, when there are neither every interface is a service named after itself.
+// A configured service that matches no interface is reported to diags
+func BuildServices(funcs []Function, cfg TranspilerConfig, diags *diag.Diagnostics) ([]Service, error) {
+	configured := map[string]int{} // interface -> index in cfg.Services
+	for idx, svc := range cfg.Services {
+		configured[svc.Interface] = idx
+	}
+	annotated := false
+	for _, f := range funcs {
+		annotated = annotated || f.Service != ""
+	}
+
+	// interfaces of different packages can have the same name, configured services name them with or without it
+	byInterface := map[string]*Service{}
+	configs := map[*Service]ServiceConfig{}
+	matched := map[int]struct{}{}
+	services := []*Service{}
+	for _, f := range funcs {
+		key := f.Package + "." + f.Interface
+		svc, ok := byInterface[key]
+		if !ok {
+			cfgIdx, isConfigured := configured[key]
+			if !isConfigured {
+				cfgIdx, isConfigured = configured[f.Interface]
+			}
+			var svcCfg ServiceConfig
+			switch {
+			case isConfigured:
+				svcCfg = cfg.Services[cfgIdx]
+				svcCfg.Interface = f.Interface
+				matched[cfgIdx] = struct{}{}
+			case f.Service != "":
+				svcCfg = ServiceConfig{Interface: f.Interface, Name: f.Service}
+			case len(configured) == 0 && !annotated:
+				svcCfg = ServiceConfig{Interface: f.Interface}
+			default:
+				continue
+			}
+			svc = cfg.newService(svcCfg)
+			svc.Doc = f.InterfaceDoc
+			byInterface[key] = svc
+			configs[svc] = svcCfg
+			services = append(services, svc)
+		}
+		svc.Funcs = append(svc.Funcs, f)
+	}
+	for idx, svc := range cfg.Services {
+		if _, ok := matched[idx]; !ok {
+			diags.Add(diag.Warning, cfg.source.position("services"), svc.Interface, "service %s matches no interface", svc.Interface)
+		}
+	}
+
+	sort.Slice(services, func(i, j int) bool {
+		return services[i].Name < services[j].Name
+	})
+	out := []Service{}
+	names := map[string]string{}
+	files := map[string]string{}
+	for _, svc := range services {
+		fullName := svc.Package + "." + svc.Name
+		if other, ok := names[fullName]; ok {
+			return nil, fmt.Errorf("%w: interfaces %s and %s are both service %s", ErrDuplicateService, other, svc.Interface, fullName)
+		}
+		if other, ok := files[svc.File]; ok {
+			return nil, fmt.Errorf("%w: interfaces %s and %s are both written to %s", ErrDuplicateService, other, svc.Interface, svc.File)
+		}
+		names[fullName], files[svc.File] = svc.Interface, svc.Interface
+
+		methods := configs[svc].Methods
+		declared := map[string]struct{}{}
+		for _, f := range svc.Funcs {
+			declared[f.Name] = struct{}{}
+			if err := nameFields(f, methods[f.Name]); err != nil {
+				return nil, fmt.Errorf("%w: %s.%s: %s", ErrInvalidConfig, svc.Interface, f.Name, err)
+			}
+		}
+		for name := range methods {
+			if _, ok := declared[name]; !ok {
+				return nil, fmt.Errorf("%w: service %s has no method %s", ErrInvalidConfig, svc.Name, name)
+			}
+		}
+		out = append(out, *svc)
+	}
+	return out, nil
+}
+
+// nameFields sets the proto names of the request and response fields of a method. Parameters and results are
+// named after themselves in snake_case, unnamed ones after their type and results can be renamed by method
+func nameFields(f Function, method MethodConfig) error {
+	request, response := []*Field{}, []*Field{}
+	for _, param := range f.Fields {
+		param.ProtoName = paramFieldName(param)
+		if param.Stream == StreamCallback {
+			response = append(response, param)
+		} else {
+			request = append(request, param)
+		}
+	}
+
+	results := []*Field{}
+	for _, result := range f.ReturnTypes {
+		if result.Type != "error" {
+			result.ProtoName = paramFieldName(result)
+			results = append(results, result)
+		}
+	}
+	if len(method.Results) > len(results) {
+		return fmt.Errorf("%d result names for %d results", len(method.Results), len(results))
+	}
+	for idx, name := range method.Results {
+		if name != "" {
+			results[idx].ProtoName = name
+		}
+	}
+
+	dedupe(request)
+	dedupe(append(results, response...))
+	return nil
+}
+
+// paramFieldName is the proto name of a parameter or result
+func paramFieldName(f *Field) string {
+	if f.Embedded {
+		return TypeFieldName(f)
+	}
+	return SnakeCase(f.Name)
+}
+
+// dedupe numbers the proto names that are already taken by an earlier field e.g. strings and strings_2
+func dedupe(fields []*Field) {
+	taken := map[string]struct{}{}
+	for _, f := range fields {
+		taken[f.ProtoName] = struct{}{}
+	}
+	seen := map[string]struct{}{}
+	for _, f := range fields {
+		if _, ok := seen[f.ProtoName]; ok {
+			name := f.ProtoName
+			for n := 2; ; n++ {
+				if _, ok := taken[fmt.Sprintf("%s_%d", name, n)]; !ok {
+					f.ProtoName = fmt.Sprintf("%s_%d", name, n)
+					break
+				}
+			}
+			taken[f.ProtoName] = struct{}{}
+		}
+		seen[f.ProtoName] = struct{}{}
+	}
+}
+
+// newService applies the defaults of every setting svc leaves empty
+func (c TranspilerConfig) newService(svc ServiceConfig) *Service {
+	out := &Service{Name: svc.Name, Interface: svc.Interface, Package: svc.Package, GoPackage: svc.GoPackage, File: svc.File}
+	if out.Name == "" {
+		out.Name = svc.Interface
+	}
+	pkg := svc.Package
+	if pkg == "" {
+		pkg = c.RootPkgName + "." + SnakeCase(out.Name)
+		out.Package = c.ProtoPackage(pkg)
+	}
+	if out.GoPackage == "" {
+		out.GoPackage = fmt.Sprintf("%s/%s", c.PkgPrefixSlash, pkg)
+	}
+	if out.File == "" {
+		out.File = SnakeCase(out.Name) + ".proto"
+	}
+	return out
+}
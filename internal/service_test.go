@@ -0,0 +1,126 @@
+package internal
+
+import (
+	"errors"
+	"testing"
+
+	"code.justin.tv/safety/go2proto/internal/diag"
+	"github.com/stretchr/testify/assert"
+)
+
+func serviceNames(services []Service) []string {
+	out := []string{}
+	for _, svc := range services {
+		out = append(out, svc.Package+"."+svc.Name+" "+svc.File)
+	}
+	return out
+}
+
+func TestBuildServices(t *testing.T) {
+	cfg := DefaultTranspilerConfig()
+	cfg.PkgPrefixSlash = "example.com/gen"
+	funcs := []Function{
+		{Interface: "Users", Name: "Get"},
+		{Interface: "Orders", Name: "List"},
+		{Interface: "Users", Name: "Delete"},
+	}
+
+	// every interface is a service named after itself
+	services, err := BuildServices(funcs, cfg, &diag.Diagnostics{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"root.orders.Orders orders.proto", "root.users.Users users.proto"}, serviceNames(services))
+	assert.Equal(t, 2, len(services[1].Funcs))
+	assert.Equal(t, "example.com/gen/root.users", services[1].GoPackage)
+
+	// only annotated interfaces are services once one of them is
+	annotated := append([]Function{}, funcs...)
+	annotated[1].Service = "OrderService"
+	services, err = BuildServices(annotated, cfg, &diag.Diagnostics{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"root.order_service.OrderService order_service.proto"}, serviceNames(services))
+
+	// configured interfaces are services too
+	cfg.Services = []ServiceConfig{{Interface: "Users", Package: "users.v1", File: "users/v1/service.proto"}}
+	services, err = BuildServices(annotated, cfg, &diag.Diagnostics{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"root.order_service.OrderService order_service.proto", "users.v1.Users users/v1/service.proto"}, serviceNames(services))
+	assert.Equal(t, "example.com/gen/users.v1", services[1].GoPackage)
+
+	// and the only ones without annotations
+	services, err = BuildServices(funcs, cfg, &diag.Diagnostics{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"users.v1.Users users/v1/service.proto"}, serviceNames(services))
+
+	cfg.Services = []ServiceConfig{{Interface: "Users", File: "api.proto"}, {Interface: "Orders", File: "api.proto"}}
+	_, err = BuildServices(funcs, cfg, &diag.Diagnostics{})
+	assert.True(t, errors.Is(err, ErrDuplicateService))
+}
+
+func TestBuildServicesByPackage(t *testing.T) {
+	cfg := DefaultTranspilerConfig()
+	funcs := []Function{
+		{Package: "api", Interface: "Users", Name: "Get"},
+		{Package: "admin", Interface: "Users", Name: "Ban"},
+		{Package: "api", Interface: "Users", Name: "List"},
+	}
+
+	// interfaces with the same name in different packages are different services
+	cfg.Services = []ServiceConfig{
+		{Interface: "api.Users", Name: "UserService"},
+		{Interface: "admin.Users", Name: "AdminService"},
+		{Interface: "Orders"},
+	}
+	diags := diag.Diagnostics{}
+	services, err := BuildServices(funcs, cfg, &diags)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"root.admin_service.AdminService admin_service.proto", "root.user_service.UserService user_service.proto"}, serviceNames(services))
+	assert.Equal(t, "Users", services[0].Interface)
+	assert.Equal(t, 1, len(services[0].Funcs))
+	assert.Equal(t, 2, len(services[1].Funcs))
+
+	// a configured service that matches no interface is reported
+	assert.Equal(t, 1, len(diags))
+	assert.Equal(t, "service Orders matches no interface", diags[0].Msg)
+}
+
+func protoNames(fields []*Field) []string {
+	out := []string{}
+	for _, f := range fields {
+		out = append(out, f.ProtoFieldName())
+	}
+	return out
+}
+
+func TestBuildServicesNamesFields(t *testing.T) {
+	f := Function{
+		Interface: "Users",
+		Name:      "List",
+		Fields:    []*Field{{Name: "ctx", Type: "context.Context", Selector: true}, {Name: "pageSize", Type: "int64"}, {Name: "UserID", Type: "string"}},
+		ReturnTypes: []*Field{
+			{Name: "string", Type: "string", Repeated: true, Embedded: true},
+			{Name: "string", Type: "string", Repeated: true, Embedded: true},
+			{Name: "A", Type: "pkg1.A", Optional: true, Embedded: true},
+			{Name: "nextPage", Type: "string"},
+			{Name: "error", Type: "error", Embedded: true},
+		},
+	}
+	services, err := BuildServices([]Function{f}, DefaultTranspilerConfig(), &diag.Diagnostics{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"ctx", "page_size", "user_id"}, protoNames(services[0].Funcs[0].Fields))
+	assert.Equal(t, []string{"strings", "strings_2", "a", "next_page", "error"}, protoNames(services[0].Funcs[0].ReturnTypes))
+
+	// configured names replace the derived ones by position, empty ones are kept
+	cfg := DefaultTranspilerConfig()
+	cfg.Services = []ServiceConfig{{Interface: "Users", Methods: map[string]MethodConfig{"List": {Results: []string{"names", "", "first"}}}}}
+	services, err = BuildServices([]Function{f}, cfg, &diag.Diagnostics{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"names", "strings", "first", "next_page", "error"}, protoNames(services[0].Funcs[0].ReturnTypes))
+
+	cfg.Services[0].Methods["List"] = MethodConfig{Results: []string{"a", "b", "c", "d", "e"}}
+	_, err = BuildServices([]Function{f}, cfg, &diag.Diagnostics{})
+	assert.True(t, errors.Is(err, ErrInvalidConfig))
+
+	cfg.Services[0].Methods = map[string]MethodConfig{"Get": {}}
+	_, err = BuildServices([]Function{f}, cfg, &diag.Diagnostics{})
+	assert.True(t, errors.Is(err, ErrInvalidConfig))
+}
@@ -0,0 +1,78 @@
+package internal
+
+import (
+	"go/ast"
+	"go/types"
+)
+
+const (
+	StreamChan     = "chan"     // <-chan T, a parameter streams the requests and a result streams the responses
+	StreamIterator = "iterator" // a configured iterator type e.g. iter.Seq[T], streams like a channel
+	StreamCallback = "callback" // func(T) error parameter, streams the responses the method calls it with
+)
+
+// StreamConfig configures the go types besides receive only channels that stream the values of an rpc
+type StreamConfig struct {
+	Iterators []string // generic types with a single type argument that range over it, as written in the source
+	Callbacks bool     // func(T) error parameters are server streams
+}
+
+// IsIterator returns true if name is one of the configured iterator types
+func (c StreamConfig) IsIterator(name string) bool {
+	for _, iterator := range c.Iterators {
+		if iterator == name {
+			return true
+		}
+	}
+	return false
+}
+
+// StreamElem returns the stream kind and the element type of a receive only channel, a callback func(T) error
+// or a generic type with a single type argument, iterator is the generic type as written for StreamIterator.
+// Whether a callback or generic type streams depends on the StreamConfig, ok is false for any other type
+func StreamElem(expr ast.Expr) (kind string, iterator string, elem ast.Expr, ok bool) {
+	switch e := expr.(type) {
+	case *ast.ChanType:
+		if e.Dir == ast.RECV {
+			return StreamChan, "", e.Value, true
+		}
+	case *ast.FuncType:
+		params, results := e.Params.List, []*ast.Field{}
+		if e.Results != nil {
+			results = e.Results.List
+		}
+		if len(params) == 1 && len(params[0].Names) <= 1 && len(results) == 1 && len(results[0].Names) <= 1 {
+			if ident, isIdent := results[0].Type.(*ast.Ident); isIdent && ident.Name == "error" {
+				return StreamCallback, "", params[0].Type, true
+			}
+		}
+	case *ast.IndexExpr:
+		return StreamIterator, types.ExprString(e.X), e.Index, true
+	}
+	return "", "", nil, false
+}
+
+// ClientStream returns the parameter that streams the requests of the function, nil if they aren't streamed
+func (f *Function) ClientStream() *Field {
+	for _, field := range f.Fields {
+		if field.Stream == StreamChan || field.Stream == StreamIterator {
+			return field
+		}
+	}
+	return nil
+}
+
+// ServerStream returns the result or callback parameter that streams the responses of the function, nil if they aren't streamed
+func (f *Function) ServerStream() *Field {
+	for _, field := range f.Fields {
+		if field.Stream == StreamCallback {
+			return field
+		}
+	}
+	for _, field := range f.ReturnTypes {
+		if field.Stream != "" {
+			return field
+		}
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"code.justin.tv/safety/go2proto/internal/diag"
+)
+
+var ErrInvalidTag = errors.New("invalid struct tag")
+
+// MaxFieldNumber is the largest field number protobuf allows
+const MaxFieldNumber = 1<<29 - 1
+
+var protoIdentifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// FieldTag is what dumptruck reads from the struct tag of a field
+// proto:"name,number,optional" wins over json:"name", either of proto:"-" and json:"-" skips the field
+type FieldTag struct {
+	Name     string // proto name of the field, the go name when empty
+	Number   int    // proto field number, positional when 0
+	Optional bool
+	Skip     bool
+}
+
+// ParseFieldTag parses a raw struct tag without the surrounding backquotes
+func ParseFieldTag(tag string) (FieldTag, error) {
+	out := FieldTag{}
+	structTag := reflect.StructTag(tag)
+
+	proto, hasProto := structTag.Lookup("proto")
+	if hasProto {
+		if proto == "-" {
+			out.Skip = true
+			return out, nil
+		}
+
+		parts := strings.Split(proto, ",")
+		out.Name = parts[0]
+		if len(parts) > 1 && parts[1] != "" {
+			number, err := strconv.Atoi(parts[1])
+			if err != nil || number < 1 || number > MaxFieldNumber {
+				return out, fmt.Errorf("%w: proto field number %q must be between 1 and %d", ErrInvalidTag, parts[1], MaxFieldNumber)
+			}
+			if number >= 19000 && number <= 19999 {
+				return out, fmt.Errorf("%w: proto field number %d is reserved by protobuf", ErrInvalidTag, number)
+			}
+			out.Number = number
+		}
+		for idx := 2; idx < len(parts); idx++ {
+			switch parts[idx] {
+			case "optional":
+				out.Optional = true
+			case "":
+			default:
+				return out, fmt.Errorf("%w: unknown proto option %q", ErrInvalidTag, parts[idx])
+			}
+		}
+	}
+
+	// an explicit proto tag includes a field json skips
+	if json, ok := structTag.Lookup("json"); ok {
+		name := strings.Split(json, ",")[0]
+		if json == "-" && !hasProto {
+			out.Skip = true
+			return out, nil
+		}
+		if out.Name == "" && name != "-" {
+			out.Name = name
+		}
+	}
+
+	if out.Name != "" && !protoIdentifier.MatchString(out.Name) {
+		return out, fmt.Errorf("%w: %q is not a valid proto field name", ErrInvalidTag, out.Name)
+	}
+	return out, nil
+}
+
+// ApplyFieldTag applies the struct tag of field to the fields converted from it, nil if the tag skips the field
+// invalid tags are reported to r and ignored
+func ApplyFieldTag(field *ast.Field, fields []*Field, r diag.Reporter) []*Field {
+	if field.Tag == nil {
+		return fields
+	}
+
+	raw, err := strconv.Unquote(field.Tag.Value)
+	if err != nil {
+		r.Warnf(field.Tag, "ignoring struct tag %s: %s", field.Tag.Value, err)
+		return fields
+	}
+	tag, err := ParseFieldTag(raw)
+	if err != nil {
+		r.Warnf(field.Tag, "ignoring struct tag of field %s: %s", fieldName(field, "unknown_name"), err)
+		return fields
+	}
+	if tag.Skip {
+		return nil
+	}
+
+	if len(fields) > 1 && (tag.Name != "" || tag.Number != 0) {
+		r.Warnf(field.Tag, "struct tag of fields %s names or numbers more than one field", strings.Join(fieldNames(field, "unknown_name"), ", "))
+	}
+	for _, f := range fields {
+		f.ProtoName = tag.Name
+		f.Number = tag.Number
+		f.FixedNumber = tag.Number != 0
+		if tag.Optional && !f.Repeated && !f.IsMap() {
+			f.Optional = true
+		}
+	}
+	return fields
+}
@@ -0,0 +1,69 @@
+package internal
+
+import (
+	"errors"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"testing"
+
+	"code.justin.tv/safety/go2proto/internal/diag"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseFieldTag(t *testing.T) {
+	for _, test := range []struct {
+		tag string
+		out FieldTag
+	}{
+		{``, FieldTag{}},
+		{`json:"user_id,omitempty"`, FieldTag{Name: "user_id"}},
+		{`json:",omitempty"`, FieldTag{}},
+		{`json:"-"`, FieldTag{Skip: true}},
+		{`json:"-,"`, FieldTag{}},
+		{`proto:"-" json:"id"`, FieldTag{Skip: true}},
+		{`proto:"id,3,optional" json:"user_id"`, FieldTag{Name: "id", Number: 3, Optional: true}},
+		{`proto:",7" json:"user_id"`, FieldTag{Name: "user_id", Number: 7}},
+		{`proto:"id" json:"-"`, FieldTag{Name: "id"}}, // an explicit proto tag wins
+	} {
+		out, err := ParseFieldTag(test.tag)
+		assert.NoError(t, err, test.tag)
+		assert.Equal(t, test.out, out, test.tag)
+	}
+
+	for _, tag := range []string{`proto:"id,zero"`, `proto:"id,19500"`, `proto:"id,1,required"`, `json:"user-id"`} {
+		_, err := ParseFieldTag(tag)
+		assert.True(t, errors.Is(err, ErrInvalidTag), tag)
+	}
+}
+
+func TestProcessFieldsTags(t *testing.T) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "model.go", `package model
+
+type Model struct {
+	ID       string `+"`json:\"id\"`"+`
+	Secret   string `+"`json:\"-\"`"+`
+	Internal string `+"`proto:\"-\"`"+`
+	Count    int    `+"`proto:\"count,9,optional\"`"+`
+	Bad      int    `+"`proto:\"bad,x\"`"+`
+}
+`, 0)
+	assert.NoError(t, err)
+
+	structType := file.Decls[0].(*ast.GenDecl).Specs[0].(*ast.TypeSpec).Type.(*ast.StructType)
+	diags := diag.Diagnostics{}
+	fields := ProcessFields(structType.Fields.List, "model", Path{}, diag.Reporter{Fset: fset, Diags: &diags})
+
+	names := []string{}
+	for _, f := range fields {
+		names = append(names, f.Name+" "+f.ProtoFieldName())
+	}
+	assert.Equal(t, []string{"ID id", "Count count", "Bad Bad"}, names)
+	assert.Equal(t, 9, fields[1].Number)
+	assert.True(t, fields[1].Optional)
+
+	// the invalid tag is ignored
+	assert.Equal(t, 1, len(diags))
+	assert.Equal(t, 8, diags[0].Pos.Line)
+}
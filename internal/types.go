@@ -1,7 +1,7 @@
 package internal
 
 import (
-	"go/ast"
+	"go/token"
 	"path/filepath"
 	"strings"
 )
@@ -18,8 +18,9 @@ type Path struct {
 }
 
 // ToProtoFilePath uses the global path to make the equivalent collapsed proto file path
-func (p *Path) ToProtoFilePath() (string, error) {
-	r, err := filepath.Rel("code.justin.tv/safety/go2proto", *p.Path)
+// relative to the root project path
+func (p *Path) ToProtoFilePath(rootPath string) (string, error) {
+	r, err := filepath.Rel(rootPath, *p.Path)
 	if err != nil {
 		return "", err
 	}
@@ -27,8 +28,8 @@ func (p *Path) ToProtoFilePath() (string, error) {
 	return r, nil
 }
 
-func (p *Path) ToProtoPackageFilePath() (string, error) {
-	r, err := filepath.Rel("code.justin.tv/safety/go2proto", *p.Path)
+func (p *Path) ToProtoPackageFilePath(rootPath string) (string, error) {
+	r, err := filepath.Rel(rootPath, *p.Path)
 	if err != nil {
 		return "", err
 	}
@@ -41,25 +42,139 @@ type PodTypedef struct {
 	Package string
 	Name    string
 	Type    string
+	Alias   bool   // true for type A = B, false for type A B
+	Doc     string // doc comment of the type without comment markers
 }
 
 type EnumAssignment struct {
 	Package        string
 	Path           Path
 	Name           string
-	FuncName       string       // eg for A = B("C") this would be B
-	Decl           *ast.GenDecl // use this to determine which block each assignment belongs to
-	UnderlyingType string       // int or string
+	ProtoName      string         // name of the value in its proto enum, Name when empty
+	FuncName       string         // the named type of the constant, eg for A B = "C" or A = B("C") this would be B
+	UnderlyingType string         // the basic type B is declared with e.g. int, uint8 or string
+	Number         int            // proto value, the values of an enum are numbered by position when all of them are 0
+	Value          *int           // value of the go constant of an integer enum, nil when it isn't known
+	StringValue    *string        // value of the go constant of a string enum, nil when it isn't known
+	Reserved       Reserved       // of the enum the value belongs to, the same for every value of the enum
+	Doc            string         // doc comment of the value
+	TypeDoc        string         // doc comment of the FuncName type, the same for every value of the enum
+	Pos            token.Position // of the go constant, the values of an enum are in the order they are declared in
+}
+
+// EnumType returns the go type the value belongs to e.g. example.com/api.Status, every value of a type is one enum
+func (e *EnumAssignment) EnumType() string {
+	if e.Path.Path == nil {
+		return e.Package + "." + e.FuncName
+	}
+	return *e.Path.Path + "." + e.FuncName
+}
+
+// GroupEnums returns the indexes of the values of every enum in enums, the enums are in the order their first value
+// is in and the values are grouped by their type wherever they were declared
+func GroupEnums(enums []EnumAssignment) [][]int {
+	groups := [][]int{}
+	byType := map[string]int{}
+	for idx := range enums {
+		key := enums[idx].EnumType()
+		group, ok := byType[key]
+		if !ok {
+			group = len(groups)
+			byType[key] = group
+			groups = append(groups, nil)
+		}
+		groups[group] = append(groups[group], idx)
+	}
+	return groups
+}
+
+// Reserved are the numbers and names of a message or enum that belonged to removed fields or values
+type Reserved struct {
+	Numbers []int
+	Names   []string
 }
 
 type Field struct {
-	Repeated bool
-	Path     Path
-	Package  string
-	Name     string
-	Type     string // either a POD type or some other struct type
-	Optional bool
-	Selector bool // needed to know if this field contains a reference to another package
+	Repeated  bool
+	Path      Path
+	Package   string
+	Name      string
+	Type      string // either a POD type or some other struct type
+	Optional  bool
+	Selector  bool   // needed to know if this field contains a reference to another package
+	Embedded  bool   // anonymous field e.g. an embedded struct or an unnamed result, Name is the name of the type
+	ProtoName string // name of the field in its message when a struct tag names it or for parameters and results, Name when empty
+	Number    int    // proto field number, the position of the field in its message when 0
+	// Number comes from a struct tag and wins over the lock file, other numbers (e.g. of flattened fields) are preferred
+	FixedNumber bool
+	Pos         token.Position
+	Doc         string // doc comment of the field, or its line comment when it has none
+	Stream      string // StreamChan, StreamIterator or StreamCallback for a parameter or result that streams values of Type
+	Iterator    string // generic type of a StreamIterator field as written e.g. iter.Seq
+	Variadic    bool   // ...T parameter, Repeated is set as well
+
+	// Only set for the fields a flattened embedded struct promotes, the embedded fields of the parent struct
+	// the field is promoted through (outermost first) with their types relative to the parent struct
+	Promoted []*Field
+
+	// Only set for map[K]V fields, Type is "map" and Repeated is set for a slice of maps
+	MapKey   *Field
+	MapValue *Field
+
+	// Only set by the type checked frontend and for the types of flattened fields
+	ImportPath string // import path of the package the (selector) type is declared in
+	Underlying string // underlying type of a named or alias type e.g. string for type Country = string
+}
+
+// ProtoFieldName returns the name of the field in its proto message
+func (f *Field) ProtoFieldName() string {
+	if f.ProtoName != "" {
+		return f.ProtoName
+	}
+	return f.Name
+}
+
+// IsMap returns true if the field is a map or a slice of maps
+func (f *Field) IsMap() bool {
+	return f.MapKey != nil && f.MapValue != nil
+}
+
+// MapKeyProtoType returns the proto type of the key of a map field, false if the key type can't be a proto map key
+// named key types (e.g. type UserID string) need their Underlying type set
+func (f *Field) MapKeyProtoType() (string, bool) {
+	keyType := f.MapKey.Type
+	if f.MapKey.Underlying != "" {
+		keyType = f.MapKey.Underlying
+	}
+	if f.MapKey.Repeated || f.MapKey.Optional || f.MapKey.IsMap() {
+		return "", false
+	}
+
+	switch keyType {
+	case "string", "bool", "int32", "int64", "uint32", "uint64":
+		return keyType, true
+	case "int", "int8", "int16", "rune":
+		return "int32", true
+	case "uint", "uint8", "uint16", "byte":
+		return "uint32", true
+	}
+	return "", false
+}
+
+// Copy returns a copy of the field that shares no map key or value with f
+func (f *Field) Copy() *Field {
+	c := *f
+	if f.IsMap() {
+		c.MapKey = f.MapKey.Copy()
+		c.MapValue = f.MapValue.Copy()
+	}
+	c.Promoted = append([]*Field(nil), f.Promoted...)
+	return &c
+}
+
+// MapValueNeedsWrapper returns true if the value of a map field can't be a proto3 map value (lists and maps)
+func (f *Field) MapValueNeedsWrapper() bool {
+	return f.MapValue.Repeated || f.MapValue.IsMap()
 }
 
 func (f *Field) ProtoType(protoPackageFilePath *string) string {
@@ -86,33 +201,60 @@ func (f *Field) ProtoType(protoPackageFilePath *string) string {
 
 // A selector on a field
 type Selector struct {
-	Package string
-	Name    string
+	Package    string
+	Name       string
+	ImportPath string // only known when the field was type checked
 }
 
 type Struct struct {
-	Path    Path
+	Path     Path
+	Package  string
+	Name     string
+	Fields   []*Field
+	Reserved Reserved
+	Doc      string
+	Wrapper  bool // a named map or slice type (e.g. type Tags []string), its only field (Entries or Elements) is the type itself
+	Sealed   bool // a sealed interface, its fields are a oneof of the structs implementing it (Optional when only *T does)
+}
+
+// GoError is an exported sentinel error variable (e.g. var ErrNotFound = errors.New("not found")) or error type
+// of a go package, the adapters map them to the codes rpcs fail with
+type GoError struct {
 	Package string
+	Path    Path
 	Name    string
-	Fields  []*Field
+	Type    bool // an error type that errors.As finds rather than a sentinel that errors.Is finds
+	Pointer bool // only the pointer to the error type implements error
 }
 
 type Function struct {
-	Name        string
-	Fields      []*Field
-	ReturnTypes []*Field
+	Interface        string // name of the interface the function was declared in
+	Service          string // name from the //dumptruck:service annotation of the interface, empty without one
+	Name             string
+	Doc              string
+	InterfaceDoc     string // doc comment of the interface, the same for every function of the interface
+	Package          string // go package name of the interface
+	Path             Path   // go package and file of the interface
+	Fields           []*Field
+	ReturnTypes      []*Field
+	Incomplete       bool // a parameter or result was skipped so the go method can't be called with Fields
+	Number           int  // position of the rpc in its service, ordered by name when 0
+	RequestReserved  Reserved
+	ResponseReserved Reserved
 }
 
 // Takes in a field and returns true if it overrode the type
 // Used for applying type aliases
 type FieldTypeOverride func(f *Field, parentFunc *Function, parentStruct *Struct) bool
-type EnumOverride func(e *EnumAssignment) bool
 
 func applyOverrides(fields []*Field, overrides []FieldTypeOverride, parentFunc *Function, parentStruct *Struct) {
 	for _, f := range fields {
 		for _, override := range overrides {
 			override(f, parentFunc, parentStruct)
 		}
+		if f.IsMap() {
+			applyOverrides([]*Field{f.MapKey, f.MapValue}, overrides, parentFunc, parentStruct)
+		}
 	}
 }
 
@@ -125,12 +267,30 @@ func (f *Function) ApplyOverrides(overrides []FieldTypeOverride) {
 	applyOverrides(f.ReturnTypes, overrides, f, nil)
 }
 
+// IsContext returns true if the field is a context.Context, the context of a method isn't part of its request
+func (f *Field) IsContext() bool {
+	selector := f.ComputeSelector()
+	if selector == nil || selector.Name != "Context" {
+		return false
+	}
+	return selector.ImportPath == "context" || (selector.ImportPath == "" && selector.Package == "context")
+}
+
 // Returns the raw selector type from the field type
 func (f *Field) ComputeSelector() *Selector {
 	if !f.Selector {
 		return nil
 	}
 
+	// type checked fields know exactly where their type is declared
+	if f.ImportPath != "" {
+		return &Selector{
+			Package:    f.Package,
+			Name:       strings.TrimPrefix(f.Type, f.Package+"."),
+			ImportPath: f.ImportPath,
+		}
+	}
+
 	if strings.Contains(f.Type, ".") { // generic way of prepending protobuf package prefix
 		s := strings.Split(f.Type, ".")
 		return &Selector{
@@ -141,8 +301,10 @@ func (f *Field) ComputeSelector() *Selector {
 	return nil
 }
 
-func (e *EnumAssignment) ApplyOverrides(overrides []EnumOverride) {
-	for _, override := range overrides {
-		override(e)
+// ProtoValueName returns the name of the value in its proto enum
+func (e *EnumAssignment) ProtoValueName() string {
+	if e.ProtoName != "" {
+		return e.ProtoName
 	}
+	return e.Name
 }
@@ -0,0 +1,242 @@
+package writers
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"code.justin.tv/safety/go2proto/internal"
+	astt "code.justin.tv/safety/go2proto/internal/ast"
+)
+
+// WriteClientAdapters writes the client adapter of every service next to its server adapter
+func WriteClientAdapters(parentNode *astt.GoNode, services []internal.Service, structs []internal.Struct, enums []internal.EnumAssignment, cfg internal.TranspilerConfig) error {
+	for _, svc := range services {
+		src, err := ClientAdapter(parentNode, svc, structs, enums, cfg)
+		if err != nil {
+			return err
+		}
+		if err := WriteFile(filepath.Join(cfg.AdaptersDir, AdapterPackage(svc), "client.go"), src); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ClientAdapter returns the go source of the type that implements the go interface of a service by calling its
+// rpcs with the grpc client. The parameters and results are converted with the converters, methods that can't be
+// adapted (e.g. without an error to fail with) call the interface the client embeds. It is rendered with client.tmpl
+func ClientAdapter(parentNode *astt.GoNode, svc internal.Service, structs []internal.Struct, enums []internal.EnumAssignment, cfg internal.TranspilerConfig) ([]byte, error) {
+	if len(svc.Funcs) == 0 || svc.Funcs[0].Path.Path == nil {
+		return nil, fmt.Errorf("client adapter of %s: the package of interface %s is unknown", svc.Name, svc.Interface)
+	}
+	a := newAdapterTypes(newGoFile("client adapter of "+svc.Name, AdapterPackage(svc), cfg), parentNode, structs, enums, cfg)
+	for _, name := range []string{"context", "io", "grpc"} {
+		a.use(name, wellKnownImports[name])
+	}
+	a.use("pb", svc.GoPackage)
+	iface := a.use(svc.Funcs[0].Package, *svc.Funcs[0].Path.Path) + "." + svc.Interface
+
+	model := AdapterModel{Service: svc.Name, Interface: iface}
+	for _, f := range svc.Funcs {
+		// the imports of a method that can't be adapted aren't used, even when its comment names them
+		restore := a.snapshot()
+		method := &strings.Builder{}
+		if err := a.writeClientMethod(method, f); err != nil {
+			restore()
+			model.Methods = append(model.Methods, AdapterMethodModel{Name: f.Name, Skipped: err.Error()})
+			continue
+		}
+		model.Methods = append(model.Methods, AdapterMethodModel{Name: f.Name, Doc: f.Doc, Source: method.String()})
+	}
+
+	body, err := render(cfg, "client.tmpl", model)
+	if err != nil {
+		return nil, fmt.Errorf("client adapter of %s: %w", svc.Name, err)
+	}
+	return a.source(string(body))
+}
+
+// writeClientMethod writes the go method of f that converts its parameters to the request, calls the rpc and
+// converts the response to its results
+func (a *adapterTypes) writeClientMethod(sb *strings.Builder, f internal.Function) error {
+	if f.Incomplete {
+		return fmt.Errorf("a parameter or result was skipped")
+	}
+	if len(f.ReturnTypes) == 0 || f.ReturnTypes[len(f.ReturnTypes)-1].Type != "error" {
+		return fmt.Errorf("it has no error result to fail with")
+	}
+	client, server := f.ClientStream(), f.ServerStream()
+	request, response := "pb."+f.Name+"Request", "pb."+f.Name+"Response"
+
+	// the first context is passed to the rpc, the other parameters are numbered
+	params := []string{}
+	ctx := ""
+	var clientArg, callback string
+	var clientValue, streamedValue adapterValue
+	fields := []string{}
+	for _, param := range f.Fields {
+		if param.IsContext() && ctx == "" {
+			ctx = "ctx"
+			params = append(params, "ctx "+a.goType(a.parentNode, param))
+			continue
+		}
+		name := fmt.Sprintf("arg%d", len(params)+1)
+		if ctx != "" {
+			name = fmt.Sprintf("arg%d", len(params))
+		}
+		if param.IsContext() {
+			params = append(params, name+" "+a.goType(a.parentNode, param))
+			continue
+		}
+		value, err := a.value(param)
+		if err != nil {
+			return fmt.Errorf("parameter %s: %w", param.Name, err)
+		}
+		t, err := a.streamType(param, value.goType)
+		if err != nil {
+			return fmt.Errorf("parameter %s: %w", param.Name, err)
+		}
+		if param.Variadic {
+			t = "..." + strings.TrimPrefix(t, "[]")
+		}
+		params = append(params, name+" "+t)
+		switch param {
+		case client:
+			clientArg, clientValue = name, value
+		case server:
+			callback, streamedValue = name, value
+		default:
+			fields = append(fields, fmt.Sprintf("%s: %s,\n", pbFieldName(param), value.fromGo(name)))
+		}
+	}
+
+	results := []string{}
+	resultNames := []string{}
+	returns := []string{}
+	for idx, result := range f.ReturnTypes {
+		if result.Type == "error" {
+			if idx != len(f.ReturnTypes)-1 {
+				return fmt.Errorf("only the last result can be an error")
+			}
+			continue
+		}
+		value, err := a.value(result)
+		if err != nil {
+			return fmt.Errorf("result %s: %w", result.ProtoFieldName(), err)
+		}
+		t, err := a.streamType(result, value.goType)
+		if err != nil {
+			return fmt.Errorf("result %s: %w", result.ProtoFieldName(), err)
+		}
+		name := fmt.Sprintf("res%d", len(results)+1)
+		results = append(results, name+" "+t)
+		resultNames = append(resultNames, name)
+		if result == server {
+			streamedValue = value
+			returns = append(returns, "values")
+		} else {
+			returns = append(returns, value.fromPb("resp."+pbFieldName(result)))
+		}
+	}
+	if callback != "" && len(resultNames) > 0 {
+		return fmt.Errorf("the results of a method with a callback can't be sent")
+	}
+	results = append(results, "err error")
+	fail := func(err string) string {
+		return fmt.Sprintf("return %s\n", strings.Join(append(append([]string{}, resultNames...), "c.error("+err+")"), ", "))
+	}
+
+	sb.WriteString(fmt.Sprintf("func (c *Client) %s(%s) (%s) {\n", f.Name, strings.Join(params, ", "), strings.Join(results, ", ")))
+	if ctx == "" {
+		sb.WriteString("ctx := context.Background()\n")
+	}
+	// err is a named result, := needs a new variable on its left
+	recvResp := "resp, err :="
+	if len(resultNames) == 0 {
+		recvResp = "_, err ="
+	}
+	req := fmt.Sprintf("&%s{\n%s}", request, strings.Join(fields, ""))
+	switch {
+	case client == nil && server == nil:
+		sb.WriteString(fmt.Sprintf("%s c.RPC.%s(ctx, %s)\n", recvResp, f.Name, req))
+	case client == nil:
+		sb.WriteString(fmt.Sprintf("stream, err := c.RPC.%s(ctx, %s)\n", f.Name, req))
+	default:
+		sb.WriteString(fmt.Sprintf("stream, err := c.RPC.%s(ctx)\n", f.Name))
+	}
+	sb.WriteString("if err != nil {\n" + fail("err") + "}\n")
+
+	// the other parameters are sent with the first request of a client stream
+	if client != nil {
+		set := fmt.Sprintf("func(msg *%s, v %s) { msg.%s = %s }", request, clientValue.goType, pbFieldName(client), clientValue.fromGo("v"))
+		send := fmt.Sprintf("Send%sRequest(stream, %s, %s, %s)", f.Name, req, clientArg, set)
+		if client.Stream == internal.StreamChan {
+			send = fmt.Sprintf("Send%sRequest(ctx, stream, %s, %s, %s)", f.Name, req, clientArg, set)
+		}
+		if server == nil {
+			// Send fails with io.EOF when the server ended the stream, CloseAndRecv returns the error it failed with
+			sb.WriteString(fmt.Sprintf("if err := %s; err != nil && err != io.EOF {\n%s}\n", send, fail("err")))
+			sb.WriteString(recvResp + " stream.CloseAndRecv()\nif err != nil {\n" + fail("err") + "}\n")
+		} else {
+			// the error the stream fails with is received with the responses
+			sb.WriteString(fmt.Sprintf("go func() {\n%s\nstream.CloseSend()\n}()\n", send))
+		}
+	}
+
+	switch {
+	case callback != "":
+		get := fmt.Sprintf("func(msg *%s) %s { return %s }", response, streamedValue.goType, streamedValue.fromPb("msg."+pbFieldName(server)))
+		sb.WriteString(fmt.Sprintf("return c.error(Recv%sResponse(stream, %s, %s))\n}\n", f.Name, get, callback))
+		return nil
+	case server != nil:
+		// the other results are received with the first response of a server stream
+		first := "_"
+		if len(resultNames) > 1 {
+			first = "resp"
+		}
+		get := fmt.Sprintf("func(msg *%s) %s { return %s }", response, streamedValue.goType, streamedValue.fromPb("msg."+pbFieldName(server)))
+		if server.Stream == internal.StreamChan {
+			sb.WriteString(fmt.Sprintf("%s, values, errc := Recv%sResponse(ctx, stream, %s)\n", first, f.Name, get))
+			sb.WriteString("select {\ncase err := <-errc:\nif err != nil {\n" + fail("err") + "}\ndefault:\n}\n")
+		} else {
+			sb.WriteString("var recvErr error\n")
+			sb.WriteString(fmt.Sprintf("%s, values := Recv%sResponse(stream, %s, &recvErr)\n", first, f.Name, get))
+			sb.WriteString("if recvErr != nil {\n" + fail("recvErr") + "}\n")
+		}
+		if first == "resp" {
+			sb.WriteString(fmt.Sprintf("if resp == nil {\nresp = &%s{}\n}\n", response))
+		}
+	}
+	sb.WriteString(fmt.Sprintf("return %s\n", strings.Join(append(returns, "nil"), ", ")))
+	sb.WriteString("}\n")
+	return nil
+}
+
+// streamType returns the go type of a parameter or result that streams values of goType as it is declared
+func (a *adapterTypes) streamType(field *internal.Field, goType string) (string, error) {
+	switch field.Stream {
+	case internal.StreamChan:
+		return "<-chan " + goType, nil
+	case internal.StreamCallback:
+		return fmt.Sprintf("func(%s) error", goType), nil
+	case internal.StreamIterator:
+		iterator := field.Iterator
+		idx := strings.Index(iterator, ".")
+		if idx < 0 {
+			if field.Package == "" || field.Path.Path == nil {
+				return "", fmt.Errorf("the package of iterator %s is unknown", iterator)
+			}
+			return fmt.Sprintf("%s.%s[%s]", a.use(field.Package, *field.Path.Path), iterator, goType), nil
+		}
+		// the standard library isn't part of the go tree, its packages are imported by their name e.g. iter
+		path := iterator[:idx]
+		if a.parentNode != nil && field.Path.FilePath != nil {
+			if imp := astt.FindImport(iterator[:idx], a.parentNode.ImportsForPath(*field.Path.FilePath)); imp != nil {
+				path = *imp.GoNode.Path.Path
+			}
+		}
+		return fmt.Sprintf("%s.%s[%s]", a.use(iterator[:idx], path), iterator[idx+1:], goType), nil
+	}
+	return goType, nil
+}
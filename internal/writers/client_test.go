@@ -0,0 +1,61 @@
+package writers
+
+import (
+	"testing"
+
+	"code.justin.tv/safety/go2proto/internal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientAdapter(t *testing.T) {
+	path := "example.com/users"
+	ctx := &internal.Field{Name: "ctx", Type: "context.Context", Selector: true}
+	svc := internal.Service{Name: "UserService", Interface: "Users", GoPackage: "example.com/gen/root.user_service", Funcs: []internal.Function{
+		{
+			Name: "List", Package: "users", Path: internal.Path{Path: &path},
+			Fields:      []*internal.Field{ctx, {Name: "limit", Type: "int"}, {Name: "since", Type: "time.Time", Selector: true, Optional: true}},
+			ReturnTypes: []*internal.Field{{ProtoName: "names", Type: "string", Repeated: true, Optional: true}, {ProtoName: "next_page", Type: "string"}, {Type: "error"}},
+		},
+		// a method without an error can't fail when the rpc does
+		{Name: "Count", Fields: []*internal.Field{{Name: "prefix", Type: "string"}}, ReturnTypes: []*internal.Field{{ProtoName: "int64", Type: "int64"}}},
+		{Name: "Tail", Fields: []*internal.Field{ctx, {Name: "prefix", Type: "string"}}, ReturnTypes: []*internal.Field{{ProtoName: "string", Type: "string", Stream: internal.StreamIterator, Iterator: "iter.Seq"}, {Type: "error"}}},
+		{Name: "Import", Fields: []*internal.Field{ctx, {Name: "names", Type: "string", Stream: internal.StreamChan}}, ReturnTypes: []*internal.Field{{ProtoName: "int64", Type: "int64"}, {Type: "error"}}},
+		{Name: "Each", Fields: []*internal.Field{ctx, {Name: "fn", Type: "string", Stream: internal.StreamCallback}}, ReturnTypes: []*internal.Field{{Type: "error"}}},
+		{Name: "Delete", Fields: []*internal.Field{{Name: "ids", Type: "string", Repeated: true, Variadic: true}}, ReturnTypes: []*internal.Field{{Type: "error"}}},
+	}}
+
+	src, err := ClientAdapter(nil, svc, nil, nil, internal.DefaultTranspilerConfig())
+	assert.NoError(t, err)
+	out := string(src)
+	assert.Contains(t, out, "type Client struct {\n\t// the methods that aren't adapted call the embedded users.Users, they panic when it is nil\n\tusers.Users\n\tRPC pb.UserServiceClient\n\t// Error maps the errors the rpcs fail with to the errors of the methods, DefaultError when nil\n\tError func(error) error\n}\n\nvar _ users.Users = (*Client)(nil)\n")
+	assert.Contains(t, out, `func (c *Client) List(ctx context.Context, arg1 int, arg2 *time.Time) (res1 []*string, res2 string, err error) {
+	resp, err := c.RPC.List(ctx, &pb.ListRequest{
+		Limit: int32(arg1),
+		Since: convertOrZero(arg2, timestamppb.New),
+	})
+	if err != nil {
+		return res1, res2, c.error(err)
+	}
+	return convertSlice(resp.Names, func(v string) *string { return ref(v) }), resp.NextPage, nil
+}`)
+	assert.Contains(t, out, "// Count isn't adapted, it has no error result to fail with\n")
+	assert.Contains(t, out, `func (c *Client) Tail(ctx context.Context, arg1 string) (res1 iter.Seq[string], err error) {
+	stream, err := c.RPC.Tail(ctx, &pb.TailRequest{
+		Prefix: arg1,
+	})
+	if err != nil {
+		return res1, c.error(err)
+	}
+	var recvErr error
+	_, values := RecvTailResponse(stream, func(msg *pb.TailResponse) string { return msg.String_ }, &recvErr)
+	if recvErr != nil {
+		return res1, c.error(recvErr)
+	}
+	return values, nil
+}`)
+	assert.Contains(t, out, "\tif err := SendImportRequest(ctx, stream, &pb.ImportRequest{}, arg1, func(msg *pb.ImportRequest, v string) { msg.Names = v }); err != nil && err != io.EOF {\n")
+	assert.Contains(t, out, "\tresp, err := stream.CloseAndRecv()\n")
+	assert.Contains(t, out, "\treturn c.error(RecvEachResponse(stream, func(msg *pb.EachResponse) string { return msg.Fn }, arg1))\n")
+	assert.Contains(t, out, "func (c *Client) Delete(arg1 ...string) (err error) {\n\tctx := context.Background()\n\t_, err = c.RPC.Delete(ctx, &pb.DeleteRequest{\n\t\tIds: arg1,\n")
+	assert.Contains(t, out, "\t\"iter\"\n")
+}
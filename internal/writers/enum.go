@@ -2,118 +2,91 @@ package writers
 
 import (
 	"fmt"
-	"go/ast"
-	"os"
-	"strings"
+	"path/filepath"
+	"strconv"
 
 	"code.justin.tv/safety/go2proto/internal"
 )
 
-func WriteEnumConverters(assignments []internal.EnumAssignment, pods []internal.PodTypedef, pkgPrefixSlash string) {
-	pkgFiles := map[string]*strings.Builder{} // each converter is 1:1 with the package it belongs to
+// WriteEnumConverters writes the converters of the enums of every go package to <ConvertersDir>/<package name>/enum.go
+// rendered with enum_converters.tmpl
+func WriteEnumConverters(assignments []internal.EnumAssignment, cfg internal.TranspilerConfig) error {
+	pkgModels := map[string]*EnumConvertersModel{} // each converter is 1:1 with the package it belongs to
+	pkgGoFiles := map[string]*goFile{}
+	pkgAliases := map[string][2]string{} // package -> alias of the go package, alias of its protobuf package
+	pkgs := []string{}
 
-	// Write header of converter file
+	// Import the go package of the enums and its protobuf package
 	for _, enum := range assignments {
-		if _, ok := pkgFiles[enum.Package]; !ok {
-			pkgFiles[enum.Package] = &strings.Builder{}
-
-			sb := pkgFiles[enum.Package]
-			sb.WriteString(fmt.Sprintf("package %s\n\n", enum.Package))
-			sb.WriteString("import (\n")
-
-			pkg := enum.Package
-			sb.WriteString(fmt.Sprintf("    pb%s \"%s/%s\"\n", pkg, pkgPrefixSlash, pkg))
-			sb.WriteString(fmt.Sprintf("    %s \"code.justin.tv/safety/datastore/v5/%s\"\n", pkg, *enum.Path.Path))
-
-			sb.WriteString(")\n\n")
-		}
-	}
-
-	podGoTypes := map[string]internal.PodTypedef{}
-	for _, pod := range pods {
-		podGoTypes[fmt.Sprintf("%s.%s", pod.Package, pod.Name)] = pod
-	}
-
-	enumsByDecl := map[*ast.GenDecl][]internal.EnumAssignment{}
-	// Populate enums per decl block
-	for _, enum := range assignments {
-		if _, ok := enumsByDecl[enum.Decl]; !ok {
-			enumsByDecl[enum.Decl] = []internal.EnumAssignment{}
+		if _, ok := pkgModels[enum.Package]; !ok && enum.Path.Path != nil {
+			_, goPkg, err := protoPackageForPath(enum.Path, cfg)
+			if err != nil {
+				return err
+			}
+			f := newGoFile("enum converters of "+enum.Package, enum.Package, cfg)
+			f.use("fmt", "fmt")
+			pkgModels[enum.Package], pkgGoFiles[enum.Package] = &EnumConvertersModel{Package: enum.Package}, f
+			pkgAliases[enum.Package] = [2]string{f.use(enum.Package, *enum.Path.Path), f.use("pb"+enum.Package, goPkg)}
+			pkgs = append(pkgs, enum.Package)
 		}
-		enumsByDecl[enum.Decl] = append(enumsByDecl[enum.Decl], enum)
 	}
 
-	for _, enums := range enumsByDecl {
-		if len(enums) > 0 {
+	// in the order they were parsed so the converters are always written the same
+	for _, enums := range convertEnumsByType(assignments) {
+		if pkgModels[enums[0].Package] != nil {
 			e := enums[0]
 			funcName := e.FuncName
-			nullValue := "\"\""
-			if e.UnderlyingType == "int" || e.UnderlyingType == "int32" || e.UnderlyingType == "int64" {
-				nullValue = "-1"
+			zero := "0"
+			if e.UnderlyingType == "string" {
+				zero = "\"\""
 			}
-			sb := pkgFiles[e.Package]
-			goType := fmt.Sprintf("%s.%s", e.Package, funcName)
-			/*
-				// check if its a pod type
-				// if go type in a map of pkg + name then return that pod type
-				if pod, ok := podGoTypes[goType]; ok {
-					goType = pod.Type
-				}*/
+			goAlias, pbAlias := pkgAliases[e.Package][0], pkgAliases[e.Package][1]
+			goType := fmt.Sprintf("%s.%s", goAlias, funcName)
+			pbType := fmt.Sprintf("%s.%s", pbAlias, funcName)
 
-			sb.WriteString(fmt.Sprintf("func %sFromPb(e pb%s) %s {\n", funcName, goType, goType))
-			sb.WriteString("        switch e{\n")
+			// the value 0 is the added UNSPECIFIED value or the go constant that is it
+			unspecified := internal.UnspecifiedValueName(funcName, cfg.Naming)
+			converter := EnumConverterModel{Name: funcName, GoType: goType, PbType: pbType, Zero: zero, Unspecified: fmt.Sprintf("%s_%s", pbType, unspecified)}
+			// a go value converts to the first constant that has it, the value table maps every string to it too
+			seen := map[string]struct{}{}
 			for _, e := range enums {
-				sb.WriteString(fmt.Sprintf("            case pb%s_%s:\n", goType, e.Name))
-				sb.WriteString(fmt.Sprintf("                return %s.%s\n", e.Package, e.Name))
+				value := EnumConverterValue{
+					Go: fmt.Sprintf("%s.%s", goAlias, e.Name),
+					Pb: fmt.Sprintf("%s_%s", pbType, e.ProtoValueName()),
+				}
+				goValue := ""
+				if e.StringValue != nil {
+					goValue = strconv.Quote(*e.StringValue)
+				} else if e.Value != nil {
+					goValue = strconv.Itoa(*e.Value)
+				}
+				if _, ok := seen[goValue]; ok && goValue != "" {
+					value.Alias = true
+				} else {
+					seen[goValue] = struct{}{}
+					if e.StringValue != nil {
+						value.String = goValue
+						converter.Strings = true
+					}
+				}
+				converter.Values = append(converter.Values, value)
 			}
-			sb.WriteString("        }\n")
-			sb.WriteString(fmt.Sprintf("        return %s(%s)\n", goType, nullValue))
-			sb.WriteString("}\n\n")
-
-			sb.WriteString(fmt.Sprintf("func %sFromPbPtr(e *pb%s) *%s {\n", funcName, goType, goType))
-			sb.WriteString("        if e == nil{\n")
-			sb.WriteString("            return nil\n")
-			sb.WriteString("        }\n")
-			sb.WriteString("        switch *e{\n")
-			for _, e := range enums {
-				sb.WriteString(fmt.Sprintf("            case pb%s.%s_%s:\n", e.Package, funcName, e.Name))
-				sb.WriteString(fmt.Sprintf("                var ret %s = %s.%s\n", goType, e.Package, e.Name))
-				sb.WriteString("                return &ret\n")
-			}
-			sb.WriteString("        }\n")
-			sb.WriteString("        return nil\n")
-			sb.WriteString("}\n\n")
-
-			sb.WriteString(fmt.Sprintf("func %sFromGo(e %s) pb%s {\n", funcName, goType, goType))
-			sb.WriteString("        switch e{\n")
-			for _, e := range enums {
-				sb.WriteString(fmt.Sprintf("            case %s.%s:\n", e.Package, e.Name))
-				sb.WriteString(fmt.Sprintf("                return pb%s_%s\n", goType, e.Name))
-			}
-			sb.WriteString("        }\n")
-			sb.WriteString(fmt.Sprintf("        return pb%s(%s)\n", goType, "-1"))
-			sb.WriteString("}\n\n")
-
-			sb.WriteString(fmt.Sprintf("func %sFromGoPtr(e *%s) *pb%s {\n", funcName, goType, goType))
-			sb.WriteString("        if e == nil{\n")
-			sb.WriteString("            return nil\n")
-			sb.WriteString("        }\n")
-			sb.WriteString("        switch *e{\n")
-			for _, e := range enums {
-				sb.WriteString(fmt.Sprintf("            case %s.%s:\n", e.Package, e.Name))
-				sb.WriteString(fmt.Sprintf("                var ret pb%s = pb%s_%s\n", goType, goType, e.Name))
-				sb.WriteString("                return &ret\n")
-			}
-			sb.WriteString("        }\n")
-			sb.WriteString("        return nil\n")
-			sb.WriteString("}\n\n")
+			pkgModels[e.Package].Enums = append(pkgModels[e.Package].Enums, converter)
 		}
 	}
 
-	for pkg, sb := range pkgFiles {
-		if _, err := os.Stat(fmt.Sprintf("converters/%s", pkg)); os.IsNotExist(err) {
-			os.Mkdir(fmt.Sprintf("converters/%s", pkg), 0755)
+	for _, pkg := range pkgs {
+		body, err := render(cfg, "enum_converters.tmpl", pkgModels[pkg])
+		if err != nil {
+			return fmt.Errorf("enum converters of %s: %w", pkg, err)
+		}
+		src, err := pkgGoFiles[pkg].source(string(body))
+		if err != nil {
+			return err
+		}
+		if err := WriteFile(filepath.Join(cfg.ConvertersDir, pkg, "enum.go"), src); err != nil {
+			return err
 		}
-		WriteFile(fmt.Sprintf("converters/%s/enum.go", pkg), []byte(sb.String()))
 	}
+	return nil
 }
@@ -0,0 +1,43 @@
+package writers
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"code.justin.tv/safety/go2proto/internal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnumConverters(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dumptruck")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := "example.com/models"
+	str := func(s string) *string { return &s }
+	enum := func(name string, value *string) internal.EnumAssignment {
+		return internal.EnumAssignment{Path: internal.Path{Path: &path}, Package: "models", FuncName: "Food", Name: name, UnderlyingType: "string", StringValue: value}
+	}
+	enums := []internal.EnumAssignment{enum("Borgir", str("Borgir")), enum("Burger", str("Borgir")), enum("Pitza", str("Pit\"za")), enum("Other", nil)}
+	internal.ApplyNaming(nil, enums, internal.NamingStyle)
+	cfg := internal.DefaultTranspilerConfig()
+	cfg.GoProjectPath, cfg.PkgPrefixSlash, cfg.ConvertersDir = "example.com", "example.com/gen", dir
+
+	assert.NoError(t, WriteEnumConverters(enums, cfg))
+	src, err := ioutil.ReadFile(filepath.Join(dir, "models", "enum.go"))
+	assert.NoError(t, err)
+	out := string(src)
+
+	// every string parses to the first constant that has it, unknown strings are the unspecified value and an error
+	assert.Contains(t, out, `var FoodValues = map[string]pbmodels.Food{
+	"Borgir":  pbmodels.Food_FOOD_BORGIR,
+	"Pit\"za": pbmodels.Food_FOOD_PITZA,
+}`)
+	assert.Contains(t, out, "\treturn pbmodels.Food_FOOD_UNSPECIFIED, fmt.Errorf(\"unknown Food %q\", s)\n")
+	assert.Contains(t, out, "\tcase pbmodels.Food_FOOD_PITZA:\n\t\treturn \"Pit\\\"za\"\n")
+	assert.NotContains(t, out, "\tcase models.Burger:\n")
+	assert.Contains(t, out, "\tcase pbmodels.Food_FOOD_BURGER:\n\t\treturn models.Burger\n")
+	assert.Contains(t, out, "\t\"fmt\"\n")
+}
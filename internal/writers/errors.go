@@ -0,0 +1,259 @@
+package writers
+
+import (
+	"fmt"
+	"strings"
+
+	"code.justin.tv/safety/go2proto/internal"
+)
+
+const (
+	errdetailsImport = "google.golang.org/genproto/googleapis/rpc/errdetails"
+	twirpImport      = "github.com/twitchtv/twirp"
+)
+
+// ErrorAdapter returns the go source of the functions the adapters of a service translate errors with. The sentinel
+// errors and error types of the go packages are mapped to the codes cfg.ErrorCode returns for them, a sentinel error
+// is identified by an error info (twirp: meta) with its package and name so the client returns the sentinel again
+func ErrorAdapter(svc internal.Service, goErrors []internal.GoError, cfg internal.TranspilerConfig) ([]byte, error) {
+	twirp := cfg.ErrorCodes == internal.ErrorCodesTwirp
+	f := newGoFile("error adapter of "+svc.Name, AdapterPackage(svc), cfg)
+	for _, name := range []string{"context", "errors", "codes", "status", "errdetails", "twirp"} {
+		f.use(name, wellKnownImports[name])
+	}
+
+	entries := &strings.Builder{}
+	for _, goError := range goErrors {
+		if goError.Path.Path == nil {
+			continue
+		}
+		alias := f.use(goError.Package, *goError.Path.Path)
+		code := cfg.ErrorCode(goError)
+		entry := fmt.Sprintf("{domain: %q, reason: %q, ", *goError.Path.Path, goError.Name)
+		if goError.Type {
+			target := alias + "." + goError.Name
+			if goError.Pointer {
+				target = "*" + target
+			}
+			entry += fmt.Sprintf("is: func(err error) bool { var target %s; return errors.As(err, &target) }, ", target)
+		} else {
+			entry += fmt.Sprintf("sentinel: %s.%s, ", alias, goError.Name)
+		}
+		entry += fmt.Sprintf("code: codes.%s", internal.GRPCCode(code))
+		if twirp {
+			entry += fmt.Sprintf(", twirpCode: twirp.%s", code)
+		}
+		entries.WriteString(entry + "},\n")
+	}
+
+	body := &strings.Builder{}
+	twirpField := ""
+	if twirp {
+		twirpField = "\n\ttwirpCode twirp.ErrorCode"
+	}
+	body.WriteString(fmt.Sprintf(`
+// goError is a sentinel error or an error type of the go packages and the code an rpc fails with when its method
+// returns it, the domain (package) and reason (name) identify the error to the client
+type goError struct {
+	domain   string
+	reason   string
+	sentinel error
+	is       func(error) bool
+	code     codes.Code%s
+}
+
+// goErrors are the errors of the go packages in the order they are checked in
+var goErrors = []goError{
+%s}
+
+// errorOf returns the go error err is or wraps, nil when it is none of them
+func errorOf(err error) *goError {
+	for idx, e := range goErrors {
+		if (e.sentinel != nil && errors.Is(err, e.sentinel)) || (e.is != nil && e.is(err)) {
+			return &goErrors[idx]
+		}
+	}
+	return nil
+}
+
+// sentinelOf returns the sentinel error of a domain and reason, nil when there is none
+func sentinelOf(domain string, reason string) error {
+	for _, e := range goErrors {
+		if e.domain == domain && e.reason == reason {
+			return e.sentinel
+		}
+	}
+	return nil
+}
+
+// onlySentinel returns the sentinel error of the only go error that matches, nil when none or more than one do
+func onlySentinel(match func(goError) bool) error {
+	var sentinel error
+	for _, e := range goErrors {
+		if e.sentinel == nil || !match(e) {
+			continue
+		}
+		if sentinel != nil {
+			return nil
+		}
+		sentinel = e.sentinel
+	}
+	return sentinel
+}
+
+// DefaultStatus returns err when it is a status already, the status of a context error or the status with the code
+// of the go error err is or wraps, an unknown status for any other error
+func DefaultStatus(err error) error {
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return status.FromContextError(err).Err()
+	}
+	e := errorOf(err)
+	if e == nil {
+		return status.Error(codes.Unknown, err.Error())
+	}
+	st := status.New(e.code, err.Error())
+	if withInfo, detailErr := st.WithDetails(&errdetails.ErrorInfo{Domain: e.domain, Reason: e.reason}); detailErr == nil {
+		st = withInfo
+	}
+	return st.Err()
+}
+
+// DefaultError returns the go error of the status an rpc failed with: the sentinel error its error info names, else
+// the only sentinel error of its code or the context error of a canceled or timed out rpc, wrapped with the status
+// so errors.Is finds the sentinel. Any other error is returned as it is
+func DefaultError(err error) error {
+	st, ok := status.FromError(err)
+	if err == nil || !ok {
+		return err
+	}
+	for _, detail := range st.Details() {
+		if info, ok := detail.(*errdetails.ErrorInfo); ok {
+			if sentinel := sentinelOf(info.Domain, info.Reason); sentinel != nil {
+				return &statusError{status: st, err: sentinel}
+			}
+		}
+	}
+	// unknown is the code of every unmapped error, it doesn't tell which one it was
+	if st.Code() != codes.Unknown {
+		if sentinel := onlySentinel(func(e goError) bool { return e.code == st.Code() }); sentinel != nil {
+			return &statusError{status: st, err: sentinel}
+		}
+	}
+	switch st.Code() {
+	case codes.Canceled:
+		return &statusError{status: st, err: context.Canceled}
+	case codes.DeadlineExceeded:
+		return &statusError{status: st, err: context.DeadlineExceeded}
+	}
+	return err
+}
+
+// statusError is the error of a failed rpc that wraps the go error of its status
+type statusError struct {
+	status *status.Status
+	err    error
+}
+
+func (e *statusError) Error() string {
+	return e.status.Err().Error()
+}
+
+func (e *statusError) Unwrap() error {
+	return e.err
+}
+
+// GRPCStatus returns the status of the rpc e.g. for status.FromError
+func (e *statusError) GRPCStatus() *status.Status {
+	return e.status
+}
+`, twirpField, entries.String()))
+	if twirp {
+		body.WriteString(twirpErrorHelpers)
+	}
+
+	return f.source(body.String())
+}
+
+// twirpErrorHelpers translate errors like DefaultStatus and DefaultError for twirp servers and clients
+const twirpErrorHelpers = `
+// TwirpError returns err when it is a twirp error already, the twirp error of a context error or the twirp error with
+// the code of the go error err is or wraps, an unknown twirp error for any other error
+func TwirpError(err error) twirp.Error {
+	var twerr twirp.Error
+	if errors.As(err, &twerr) {
+		return twerr
+	}
+	switch {
+	case errors.Is(err, context.Canceled):
+		return twirp.NewError(twirp.Canceled, err.Error())
+	case errors.Is(err, context.DeadlineExceeded):
+		return twirp.NewError(twirp.DeadlineExceeded, err.Error())
+	}
+	e := errorOf(err)
+	if e == nil {
+		return twirp.NewError(twirp.Unknown, err.Error())
+	}
+	return twirp.NewError(e.twirpCode, err.Error()).WithMeta("domain", e.domain).WithMeta("reason", e.reason)
+}
+
+// FromTwirpError returns the go error of a twirp error like DefaultError does for a status, the domain and reason
+// meta name the sentinel error
+func FromTwirpError(err error) error {
+	var twerr twirp.Error
+	if err == nil || !errors.As(err, &twerr) {
+		return err
+	}
+	if sentinel := sentinelOf(twerr.Meta("domain"), twerr.Meta("reason")); sentinel != nil {
+		return &twirpError{twerr: twerr, err: sentinel}
+	}
+	if twerr.Code() != twirp.Unknown {
+		if sentinel := onlySentinel(func(e goError) bool { return e.twirpCode == twerr.Code() }); sentinel != nil {
+			return &twirpError{twerr: twerr, err: sentinel}
+		}
+	}
+	switch twerr.Code() {
+	case twirp.Canceled:
+		return &twirpError{twerr: twerr, err: context.Canceled}
+	case twirp.DeadlineExceeded:
+		return &twirpError{twerr: twerr, err: context.DeadlineExceeded}
+	}
+	return err
+}
+
+// twirpError is a twirp error that wraps the go error of its code and meta
+type twirpError struct {
+	twerr twirp.Error
+	err   error
+}
+
+func (e *twirpError) Code() twirp.ErrorCode {
+	return e.twerr.Code()
+}
+
+func (e *twirpError) Msg() string {
+	return e.twerr.Msg()
+}
+
+func (e *twirpError) WithMeta(key string, val string) twirp.Error {
+	return &twirpError{twerr: e.twerr.WithMeta(key, val), err: e.err}
+}
+
+func (e *twirpError) Meta(key string) string {
+	return e.twerr.Meta(key)
+}
+
+func (e *twirpError) MetaMap() map[string]string {
+	return e.twerr.MetaMap()
+}
+
+func (e *twirpError) Error() string {
+	return e.twerr.Error()
+}
+
+func (e *twirpError) Unwrap() error {
+	return e.err
+}
+`
@@ -0,0 +1,41 @@
+package writers
+
+import (
+	"testing"
+
+	"code.justin.tv/safety/go2proto/internal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorAdapter(t *testing.T) {
+	users, errs := "example.com/users", "example.com/errors"
+	svc := internal.Service{Name: "UserService", GoPackage: "example.com/gen/root.user_service"}
+	goErrors := []internal.GoError{
+		{Package: "users", Path: internal.Path{Path: &users}, Name: "ErrNotFound"},
+		{Package: "users", Path: internal.Path{Path: &users}, Name: "ValidationError", Type: true, Pointer: true},
+		// the package name is taken by the errors of the standard library
+		{Package: "errors", Path: internal.Path{Path: &errs}, Name: "ErrBadName"},
+	}
+	cfg := internal.DefaultTranspilerConfig()
+	cfg.Errors = map[string]string{"ErrNotFound": "NotFound", "ValidationError": "Malformed"}
+	cfg.Packages = map[string]internal.PackageConfig{users: {Errors: map[string]string{"ErrNotFound": "FailedPrecondition"}}}
+
+	src, err := ErrorAdapter(svc, goErrors, cfg)
+	assert.NoError(t, err)
+	out := string(src)
+	assert.Contains(t, out, "\terrors2 \"example.com/errors\"\n")
+	// the errors of a package are mapped before the errors of every package
+	assert.Contains(t, out, "\t{domain: \"example.com/users\", reason: \"ErrNotFound\", sentinel: users.ErrNotFound, code: codes.FailedPrecondition},\n")
+	assert.Contains(t, out, "is: func(err error) bool { var target *users.ValidationError; return errors.As(err, &target) }, code: codes.InvalidArgument},\n")
+	assert.Contains(t, out, "sentinel: errors2.ErrBadName, code: codes.Unknown},\n")
+	assert.Contains(t, out, "func DefaultError(err error) error {")
+	assert.NotContains(t, out, "twirp")
+
+	cfg.ErrorCodes = internal.ErrorCodesTwirp
+	src, err = ErrorAdapter(svc, goErrors, cfg)
+	assert.NoError(t, err)
+	out = string(src)
+	assert.Contains(t, out, "code: codes.InvalidArgument, twirpCode: twirp.Malformed},\n")
+	assert.Contains(t, out, "func TwirpError(err error) twirp.Error {")
+	assert.Contains(t, out, "func FromTwirpError(err error) error {")
+}
@@ -0,0 +1,231 @@
+package writers
+
+import (
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"sort"
+	"strings"
+
+	"code.justin.tv/safety/go2proto/internal"
+	astt "code.justin.tv/safety/go2proto/internal/ast"
+)
+
+// wellKnownImports are the packages the generators write code for by name, any other package with one of these
+// names gets a numbered alias
+var wellKnownImports = map[string]string{
+	"context":     "context",
+	"errors":      "errors",
+	"fmt":         "fmt",
+	"io":          "io",
+	"iter":        "iter",
+	"time":        "time",
+	"grpc":        "google.golang.org/grpc",
+	"codes":       "google.golang.org/grpc/codes",
+	"status":      "google.golang.org/grpc/status",
+	"errdetails":  errdetailsImport,
+	"twirp":       twirpImport,
+	"timestamppb": timestamppbImport,
+	"durationpb":  durationpbImport,
+	"structpb":    structpbImport,
+}
+
+// generatedLocals are the identifiers the generated functions declare, no package is imported as one of them
+var generatedLocals = map[string]struct{}{
+	"c": {}, "s": {}, "e": {}, "k": {}, "m": {}, "v": {}, "in": {}, "msg": {}, "out": {}, "items": {}, "ctx": {},
+	"err": {}, "req": {}, "resp": {}, "stream": {}, "values": {}, "errc": {}, "st": {}, "idx": {}, "ret": {},
+	"target": {}, "sentinel": {},
+}
+
+// goFile is a generated go file of package pkg. Packages are imported while its body is written and get an alias
+// no other package of the file has, only the imports the body uses are written
+type goFile struct {
+	generator string                    // names the generator in errors e.g. server adapter of Leviathan
+	pkg       string                    // package clause
+	cfg       internal.TranspilerConfig // the templates the file is rendered with
+	aliases   map[string]string         // alias -> import path
+	paths     map[string]string         // import path -> alias
+}
+
+func newGoFile(generator string, pkg string, cfg internal.TranspilerConfig) *goFile {
+	return &goFile{generator: generator, pkg: pkg, cfg: cfg, aliases: map[string]string{}, paths: map[string]string{}}
+}
+
+// use imports the package at path and returns its alias: name unless it is taken by another package, a well known
+// package or a local of the generated code, then name is numbered
+func (f *goFile) use(name string, path string) string {
+	if alias, ok := f.paths[path]; ok {
+		return alias
+	}
+	alias := name
+	for idx := 2; ; idx++ {
+		_, taken := f.aliases[alias]
+		wellKnown, ok := wellKnownImports[alias]
+		_, local := generatedLocals[alias]
+		if !taken && !local && (!ok || wellKnown == path) {
+			break
+		}
+		alias = fmt.Sprintf("%s%d", name, idx)
+	}
+	f.aliases[alias] = path
+	f.paths[path] = alias
+	return alias
+}
+
+// snapshot returns a function that drops the imports added after it was taken e.g. by code that isn't written
+func (f *goFile) snapshot() func() {
+	aliases, paths := map[string]string{}, map[string]string{}
+	for alias, path := range f.aliases {
+		aliases[alias], paths[path] = path, alias
+	}
+	return func() {
+		f.aliases, f.paths = aliases, paths
+	}
+}
+
+// goType returns the go type of field and imports the packages it names, with the aliases of this file. Types
+// without a package are declared in the package of field
+func (f *goFile) goType(parentNode *astt.GoNode, field *internal.Field) string {
+	t := ""
+	switch {
+	case field.IsMap():
+		t = fmt.Sprintf("map[%s]%s", f.goType(parentNode, field.MapKey), f.goType(parentNode, field.MapValue))
+	case field.Type == "bytes":
+		t = "[]byte"
+	case field.Type == "interface":
+		t = "interface{}"
+	case (field.Type == "time.Time" || field.Type == "time.Duration") && field.ComputeSelector() == nil:
+		t = f.use("time", "time") + strings.TrimPrefix(field.Type, "time")
+	case isGoBuiltin(field.Type) || (isPodType(field.Type) && field.ComputeSelector() == nil):
+		t = field.Type
+	default:
+		t = f.qualified(parentNode, field)
+	}
+
+	if field.Optional && !field.IsMap() {
+		t = "*" + t
+	}
+	if field.Repeated {
+		t = "[]" + t
+	}
+	return t
+}
+
+// qualified returns the name of the (non map) type of field qualified with the alias of its package
+func (f *goFile) qualified(parentNode *astt.GoNode, field *internal.Field) string {
+	if selector := field.ComputeSelector(); selector != nil {
+		// the standard library isn't part of the go tree, its packages are imported by their name e.g. time
+		path := selector.Package
+		if selector.ImportPath != "" {
+			path = selector.ImportPath
+		} else if parentNode != nil && field.Path.FilePath != nil {
+			if imp := astt.FindImport(selector.Package, parentNode.ImportsForPath(*field.Path.FilePath)); imp != nil {
+				path = *imp.GoNode.Path.Path
+			}
+		}
+		return f.use(selector.Package, path) + "." + selector.Name
+	}
+
+	var pkgNode *astt.GoNode
+	if parentNode != nil && field.Path.Path != nil {
+		pkgNode = parentNode.FindPackage(*field.Path.Path)
+	}
+	// the package name of unqualified types is the name the package declares, not its directory
+	pkg := field.Package
+	if pkg == "" && pkgNode != nil {
+		pkg = pkgNode.PackageName
+	}
+	switch {
+	case pkgNode != nil:
+		return f.use(pkg, *pkgNode.Path.Path) + "." + field.Type
+	case pkg != "":
+		return pkg + "." + field.Type
+	}
+	return field.Type
+}
+
+// source returns the formatted source of the file with body rendered with go_file.tmpl. The imports are the
+// packages the code refers to, the standard library first like goimports does, and code that isn't valid go is a
+// SourceError
+func (f *goFile) source(body string) ([]byte, error) {
+	clause := fmt.Sprintf("package %s\n", f.pkg)
+	file, err := parser.ParseFile(token.NewFileSet(), "", clause+body, 0)
+	if err != nil {
+		return nil, newSourceError(f.generator, clause+body, err)
+	}
+	// selectors of identifiers that aren't declared in the file are the packages it uses
+	used := map[string]struct{}{}
+	ast.Inspect(file, func(n ast.Node) bool {
+		if sel, ok := n.(*ast.SelectorExpr); ok {
+			if ident, ok := sel.X.(*ast.Ident); ok && ident.Obj == nil {
+				used[ident.Name] = struct{}{}
+			}
+		}
+		return true
+	})
+
+	model := GoFileModel{Generator: f.generator, Package: f.pkg, Body: body}
+	for alias, path := range f.aliases {
+		if _, ok := used[alias]; !ok {
+			continue
+		}
+		imp := GoImport{Name: alias, Path: path}
+		if alias == path || strings.HasSuffix(path, "/"+alias) {
+			imp.Name = ""
+		}
+		if strings.Contains(strings.Split(path, "/")[0], ".") {
+			model.OtherImports = append(model.OtherImports, imp)
+		} else {
+			model.StdImports = append(model.StdImports, imp)
+		}
+	}
+	for _, imports := range [][]GoImport{model.StdImports, model.OtherImports} {
+		sort.Slice(imports, func(i, j int) bool {
+			return imports[i].Path < imports[j].Path
+		})
+	}
+
+	src, err := render(f.cfg, "go_file.tmpl", model)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", f.generator, err)
+	}
+	formatted, err := format.Source(src)
+	if err != nil {
+		return nil, newSourceError(f.generator, string(src), err)
+	}
+	return formatted, nil
+}
+
+// SourceError is generated go code that isn't valid go, a bug of the generator that wrote it rather than of the
+// go packages it was generated from
+type SourceError struct {
+	Generator string // e.g. server adapter of Leviathan
+	Line      string // the line of the generated code the error is on, empty when it is unknown
+	Err       error
+}
+
+func newSourceError(generator string, src string, err error) *SourceError {
+	e := &SourceError{Generator: generator, Err: err}
+	// go/scanner errors start with the line:column of the generated source
+	var line, column int
+	if _, scanErr := fmt.Sscanf(err.Error(), "%d:%d", &line, &column); scanErr == nil {
+		if lines := strings.Split(src, "\n"); line > 0 && line <= len(lines) {
+			e.Line = strings.TrimSpace(lines[line-1])
+		}
+	}
+	return e
+}
+
+func (e *SourceError) Error() string {
+	msg := fmt.Sprintf("the %s generated invalid go: %v", e.Generator, e.Err)
+	if e.Line != "" {
+		msg += fmt.Sprintf(" in %q", e.Line)
+	}
+	return msg
+}
+
+func (e *SourceError) Unwrap() error {
+	return e.Err
+}
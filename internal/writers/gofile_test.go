@@ -0,0 +1,48 @@
+package writers
+
+import (
+	"errors"
+	"testing"
+
+	"code.justin.tv/safety/go2proto/internal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGoFile(t *testing.T) {
+	f := newGoFile("server adapter of UserService", "userservice", internal.DefaultTranspilerConfig())
+	assert.Equal(t, "context", f.use("context", "context"))
+	assert.Equal(t, "users", f.use("users", "example.com/users"))
+	assert.Equal(t, "users", f.use("users", "example.com/users"))
+	// the names of other packages, well known packages and locals of the generated code are taken
+	assert.Equal(t, "users2", f.use("users", "example.com/v2/users"))
+	assert.Equal(t, "time2", f.use("time", "example.com/time"))
+	assert.Equal(t, "msg2", f.use("msg", "example.com/msg"))
+
+	restore := f.snapshot()
+	assert.Equal(t, "models", f.use("models", "example.com/models"))
+	restore()
+	assert.Equal(t, "models2", f.use("models2", "example.com/models"))
+
+	// only the packages the code refers to are imported, a comment naming a package doesn't use it
+	src, err := f.source(`
+// List calls users.List
+func List(ctx context.Context) []users2.User {
+	var time int
+	_ = time
+	return nil
+}
+`)
+	assert.NoError(t, err)
+	out := string(src)
+	assert.Contains(t, out, "package userservice\n\nimport (\n\t\"context\"\n\n\tusers2 \"example.com/v2/users\"\n)\n")
+	assert.NotContains(t, out, "\"example.com/users\"")
+	assert.NotContains(t, out, "time2")
+
+	// invalid go is an error of the generator that wrote it
+	_, err = f.source("\nfunc List( {\n}\n")
+	var sourceErr *SourceError
+	assert.True(t, errors.As(err, &sourceErr))
+	assert.Equal(t, "server adapter of UserService", sourceErr.Generator)
+	assert.Equal(t, "func List( {", sourceErr.Line)
+	assert.Contains(t, err.Error(), "the server adapter of UserService generated invalid go")
+}
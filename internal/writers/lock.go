@@ -0,0 +1,263 @@
+package writers
+
+import (
+	"fmt"
+	"go/token"
+	"strings"
+
+	"code.justin.tv/safety/go2proto/internal"
+	"code.justin.tv/safety/go2proto/internal/diag"
+	"code.justin.tv/safety/go2proto/internal/lock"
+)
+
+// requestFields returns the fields of the request message of a function, every parameter but the context
+// a callback parameter streams the responses so it is a response field
+func requestFields(f internal.Function) []*internal.Field {
+	out := []*internal.Field{}
+	for _, e := range f.Fields {
+		if !e.IsContext() && e.Stream != internal.StreamCallback {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// responseFields returns the results of a function in the response message followed by the callback parameter
+// that streams the responses, their names are set by internal.BuildServices
+func responseFields(f internal.Function) []*internal.Field {
+	out := []*internal.Field{}
+	for _, e := range f.ReturnTypes {
+		if e.Type != "error" {
+			out = append(out, e)
+		}
+	}
+	for _, e := range f.Fields {
+		if e.Stream == internal.StreamCallback {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// ApplyLock numbers every message field, enum value and rpc with the numbers recorded in the lock file
+// new ones get a fresh number that is added to it and the ones that are gone are reserved
+func ApplyLock(l *lock.File, structs []internal.Struct, assignments []internal.EnumAssignment, services []internal.Service, cfg internal.TranspilerConfig, diags *diag.Diagnostics) {
+	for idx := range structs {
+		s := &structs[idx]
+		decl := s.Package + "." + s.Name
+		protoPkg, _, err := protoPackageForPath(s.Path, cfg)
+		if err != nil {
+			diags.Add(diag.Error, token.Position{}, decl, "%s", err)
+			continue
+		}
+		numbers := l.Message(protoPkg + "." + s.Name)
+		renameGoNames(numbers, s.Fields)
+		s.Reserved = lockFields(numbers, s.Fields, decl, diags)
+	}
+
+	// enums are grouped by index so the numbers end up in assignments
+	for _, values := range internal.GroupEnums(assignments) {
+		first := assignments[values[0]]
+		protoPkg, _, err := protoPackageForPath(first.Path, cfg)
+		if err != nil {
+			diags.Add(diag.Error, token.Position{}, first.Package+"."+first.FuncName, "%s", err)
+			continue
+		}
+
+		enums := make([]internal.EnumAssignment, len(values))
+		for idx, value := range values {
+			enums[idx] = assignments[value]
+		}
+		entries, unspecified := enumEntries(enums, cfg)
+
+		numbers := l.Enum(protoPkg + "." + first.FuncName)
+		renameEnumValues(numbers, enums)
+		if unspecified != "" {
+			lockUnspecified(numbers, first, unspecified, diags)
+		}
+		assigned := numbers.Assign(entries, 0)[len(entries)-len(values):]
+		for idx, value := range values {
+			assignments[value].Number = assigned[idx]
+			assignments[value].Reserved = internal.Reserved{Numbers: numbers.ReservedNumbers, Names: numbers.ReservedNames}
+		}
+	}
+
+	for _, svc := range services {
+		funcs := svc.Funcs
+		rpcs := make([]lock.Entry, len(funcs))
+		for idx := range funcs {
+			f := &funcs[idx]
+			decl := f.Interface + "." + f.Name
+			request, response := l.Message(svc.Package+"."+f.Name+"Request"), l.Message(svc.Package+"."+f.Name+"Response")
+			renameLegacyFields(request, response, *f)
+			f.RequestReserved = lockFields(request, requestFields(*f), decl, diags)
+			f.ResponseReserved = lockFields(response, responseFields(*f), decl, diags)
+			rpcs[idx] = lock.Entry{Name: f.Name}
+		}
+		for idx, number := range l.Service(svc.Package+"."+svc.Name).Assign(rpcs, 1) {
+			funcs[idx].Number = number
+		}
+	}
+}
+
+// enumEntries returns the lock entries of the values of an enum, preceded by the value 0 when it has to be added,
+// and the name of that value, see enumNumbers
+func enumEntries(enums []internal.EnumAssignment, cfg internal.TranspilerConfig) ([]lock.Entry, string) {
+	preferred, unspecified := enumNumbers(enums, cfg)
+	entries := []lock.Entry{}
+	if unspecified != "" {
+		entries = append(entries, lock.Entry{Name: unspecified, Number: 0, Fixed: true})
+	}
+	for idx, enum := range enums {
+		entries = append(entries, lock.Entry{Name: enum.ProtoValueName(), Number: preferred[idx], Fixed: preferred[idx] == 0, Preferred: true})
+	}
+	return entries, unspecified
+}
+
+// renameLegacyFields keeps the numbers of fields locked before request fields were named in snake_case and
+// response fields after their results, they were the go parameter names and Field1, Field2... by result position
+func renameLegacyFields(request *lock.Numbers, response *lock.Numbers, f internal.Function) {
+	rename := func(numbers *lock.Numbers, fields []*internal.Field, legacy func(idx int, field *internal.Field) string) {
+		current := map[string]struct{}{}
+		for _, field := range fields {
+			current[field.ProtoFieldName()] = struct{}{}
+		}
+		for idx, field := range fields {
+			// a legacy name that is still the name of a field keeps its number
+			if _, ok := current[legacy(idx, field)]; !ok {
+				numbers.Rename(legacy(idx, field), field.ProtoFieldName())
+			}
+		}
+	}
+
+	rename(request, requestFields(f), func(_ int, field *internal.Field) string {
+		return field.Name
+	})
+	positions := map[*internal.Field]int{}
+	for idx, result := range f.ReturnTypes {
+		positions[result] = idx + 1
+	}
+	rename(response, responseFields(f), func(_ int, field *internal.Field) string {
+		if position, ok := positions[field]; ok {
+			return fmt.Sprintf("Field%d", position)
+		}
+		return field.Name
+	})
+}
+
+// renameEnumValues keeps the numbers of enum values locked by their go name before they were named after the
+// naming policy or by the name of the other naming policy
+func renameEnumValues(numbers *lock.Numbers, enums []internal.EnumAssignment) {
+	current := map[string]struct{}{}
+	for _, e := range enums {
+		current[e.ProtoValueName()] = struct{}{}
+	}
+	for _, e := range enums {
+		for _, old := range []string{e.Name, internal.EnumValueName(e.FuncName, e.Name)} {
+			// a name that is still the name of a value keeps its number
+			if _, ok := current[old]; !ok {
+				numbers.Rename(old, e.ProtoValueName())
+			}
+		}
+	}
+}
+
+// lockUnspecified keeps the numbers of an enum locked without its UNSPECIFIED value, the one locked by the other
+// naming policy is renamed. A value locked as 0 before enums had an UNSPECIFIED value is the only one that gets a
+// new number, old messages with 0 still convert to its go value as it's the zero value
+func lockUnspecified(numbers *lock.Numbers, enum internal.EnumAssignment, unspecified string, diags *diag.Diagnostics) {
+	if _, ok := numbers.Numbers[unspecified]; ok {
+		return
+	}
+	for _, naming := range []string{internal.NamingStyle, internal.NamingGo} {
+		if numbers.Rename(internal.UnspecifiedValueName(enum.FuncName, naming), unspecified) {
+			return
+		}
+	}
+	for name, number := range numbers.Numbers {
+		if number == 0 {
+			diags.Add(diag.Warning, token.Position{}, enum.Package+"."+enum.FuncName, "%s was locked as 0, it is renumbered so 0 can be %s", name, unspecified)
+		}
+	}
+}
+
+// renameGoNames keeps the numbers of struct fields locked by their go name before they were named after the
+// naming policy
+func renameGoNames(numbers *lock.Numbers, fields []*internal.Field) {
+	current := map[string]struct{}{}
+	for _, field := range fields {
+		current[field.ProtoFieldName()] = struct{}{}
+	}
+	for _, field := range fields {
+		// a go name that is still the name of a field keeps its number
+		if _, ok := current[field.Name]; !ok {
+			numbers.Rename(field.Name, field.ProtoFieldName())
+		}
+	}
+}
+
+// lockFields numbers the fields of a message and returns what the message has to reserve
+func lockFields(numbers *lock.Numbers, fields []*internal.Field, decl string, diags *diag.Diagnostics) internal.Reserved {
+	for _, f := range fields {
+		if f.FixedNumber && numbers.IsReserved(f.Number) {
+			diags.Add(diag.Error, f.Pos, decl, "field %s has the number %d of a removed field, it is reserved in the lock file", f.Name, f.Number)
+		}
+	}
+	for idx, number := range numbers.Assign(fieldEntries(fields), 1) {
+		fields[idx].Number = number
+	}
+	return internal.Reserved{Numbers: numbers.ReservedNumbers, Names: numbers.ReservedNames}
+}
+
+// unlockedFieldNumbers returns the numbers of the fields of a message that was never locked, the ones an empty lock
+// file assigns so a message is numbered the same with and without one
+func unlockedFieldNumbers(fields []*internal.Field) []int {
+	return (&lock.Numbers{}).Assign(fieldEntries(fields), 1)
+}
+
+// fieldEntries returns the lock entries of the fields of a message, numbers of struct tags are fixed and the
+// others (e.g. of flattened fields) are preferred
+func fieldEntries(fields []*internal.Field) []lock.Entry {
+	entries := make([]lock.Entry, len(fields))
+	for idx, f := range fields {
+		entries[idx] = lock.Entry{
+			Name:      f.ProtoFieldName(),
+			Number:    f.Number,
+			Fixed:     f.FixedNumber,
+			Preferred: f.Number != 0 && !f.FixedNumber,
+		}
+	}
+	return entries
+}
+
+// reservedStatements returns the reserved statements of a message or enum, consecutive numbers are collapsed into
+// ranges
+func reservedStatements(reserved internal.Reserved) []string {
+	out := []string{}
+	numbers := reserved.Numbers
+	if len(numbers) > 0 {
+		ranges := []string{}
+		for start := 0; start < len(numbers); {
+			end := start
+			for end+1 < len(numbers) && numbers[end+1] == numbers[end]+1 {
+				end++
+			}
+			if start == end {
+				ranges = append(ranges, fmt.Sprintf("%d", numbers[start]))
+			} else {
+				ranges = append(ranges, fmt.Sprintf("%d to %d", numbers[start], numbers[end]))
+			}
+			start = end + 1
+		}
+		out = append(out, fmt.Sprintf("reserved %s;", strings.Join(ranges, ", ")))
+	}
+
+	if len(reserved.Names) > 0 {
+		names := make([]string, len(reserved.Names))
+		for idx, name := range reserved.Names {
+			names[idx] = fmt.Sprintf("%q", name)
+		}
+		out = append(out, fmt.Sprintf("reserved %s;", strings.Join(names, ", ")))
+	}
+	return out
+}
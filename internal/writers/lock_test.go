@@ -0,0 +1,199 @@
+package writers
+
+import (
+	"testing"
+
+	"code.justin.tv/safety/go2proto/internal"
+	"code.justin.tv/safety/go2proto/internal/diag"
+	"code.justin.tv/safety/go2proto/internal/lock"
+	"github.com/stretchr/testify/assert"
+)
+
+func fieldNumbers(s internal.Struct) []int {
+	out := []int{}
+	for _, f := range s.Fields {
+		out = append(out, f.Number)
+	}
+	return out
+}
+
+func TestApplyLock(t *testing.T) {
+	cfg := internal.DefaultTranspilerConfig()
+	cfg.GoProjectPath = "example.com"
+	path := "example.com/api"
+	structs := func(fields ...*internal.Field) []internal.Struct {
+		return []internal.Struct{{Package: "api", Name: "Model", Path: internal.Path{Path: &path}, Fields: fields}}
+	}
+	services := []internal.Service{{Name: "API", Package: "root.api", Funcs: []internal.Function{
+		{Name: "Get", Fields: []*internal.Field{{Name: "ctx", Type: "context.Context", Selector: true}, {Name: "id", Type: "string"}}, ReturnTypes: []*internal.Field{{Type: "Model"}, {Type: "error"}}},
+		{Name: "Delete", Fields: []*internal.Field{{Name: "ctx", Type: "context.Context", Selector: true}}},
+	}}}
+	funcs := services[0].Funcs
+
+	l := lock.New()
+	diags := diag.Diagnostics{}
+	first := structs(&internal.Field{Name: "ID"}, &internal.Field{Name: "Name"}, &internal.Field{Name: "Age", Number: 7, FixedNumber: true})
+	ApplyLock(l, first, nil, services, cfg, &diags)
+	assert.Empty(t, diags)
+	assert.Equal(t, []int{1, 2, 7}, fieldNumbers(first[0]))
+	assert.Equal(t, 1, funcs[0].Number)
+	assert.Equal(t, 2, funcs[1].Number)
+
+	// Name is removed and Email is added in its place
+	second := structs(&internal.Field{Name: "ID"}, &internal.Field{Name: "Email"}, &internal.Field{Name: "Age", Number: 7, FixedNumber: true})
+	ApplyLock(l, second, nil, services, cfg, &diags)
+	assert.Empty(t, diags)
+	assert.Equal(t, []int{1, 8, 7}, fieldNumbers(second[0]))
+	assert.Equal(t, internal.Reserved{Numbers: []int{2}, Names: []string{"Name"}}, second[0].Reserved)
+
+	assert.Equal(t, []string{"reserved 2, 4 to 6, 9;", "reserved \"Name\", \"Old\";"}, reservedStatements(internal.Reserved{Numbers: []int{2, 4, 5, 6, 9}, Names: []string{"Name", "Old"}}))
+
+	// a struct tag can't take the number of a removed field
+	third := structs(&internal.Field{Name: "ID"}, &internal.Field{Name: "Email"}, &internal.Field{Name: "Age", Number: 2, FixedNumber: true})
+	ApplyLock(l, third, nil, services, cfg, &diags)
+	assert.Equal(t, 1, diags.Count(diag.Error))
+}
+
+func TestApplyLockRenamesLegacyFields(t *testing.T) {
+	cfg := internal.DefaultTranspilerConfig()
+	l := lock.New()
+	l.Message("root.api.ListRequest").Numbers["pageSize"] = 1
+	l.Message("root.api.ListResponse").Numbers["Field1"] = 1
+	l.Message("root.api.ListResponse").Numbers["Field3"] = 2
+	services := []internal.Service{{Name: "API", Package: "root.api", Funcs: []internal.Function{{
+		Name:        "List",
+		Fields:      []*internal.Field{{Name: "ctx", Type: "context.Context", Selector: true}, {Name: "pageSize", ProtoName: "page_size", Type: "int64"}},
+		ReturnTypes: []*internal.Field{{Type: "Model", ProtoName: "model"}, {Type: "error"}, {Type: "string", ProtoName: "next_page"}},
+	}}}}
+
+	// numbers locked by the go parameter names and result positions stay with the renamed fields
+	diags := diag.Diagnostics{}
+	ApplyLock(l, nil, nil, services, cfg, &diags)
+	assert.Empty(t, diags)
+	assert.Equal(t, map[string]int{"page_size": 1}, l.Message("root.api.ListRequest").Numbers)
+	assert.Equal(t, map[string]int{"model": 1, "next_page": 2}, l.Message("root.api.ListResponse").Numbers)
+	assert.Empty(t, services[0].Funcs[0].ResponseReserved.Numbers)
+	assert.Empty(t, services[0].Funcs[0].ResponseReserved.Names)
+}
+
+func TestApplyLockRenamesGoNames(t *testing.T) {
+	cfg := internal.DefaultTranspilerConfig()
+	cfg.GoProjectPath = "example.com"
+	path := "example.com/api"
+	l := lock.New()
+	l.Message("api.Model").Numbers["CreatedAt"] = 3
+	l.Enum("api.Country").Numbers["Canada"] = 2
+	l.Enum("api.Country").Numbers["COUNTRY_UNSPECIFIED"] = 0
+	structs := []internal.Struct{{Package: "api", Name: "Model", Path: internal.Path{Path: &path}, Fields: []*internal.Field{{Name: "CreatedAt"}}}}
+	enums := []internal.EnumAssignment{{Package: "api", Path: internal.Path{Path: &path}, Name: "Canada", FuncName: "Country"}}
+	internal.ApplyNaming(structs, enums, internal.NamingStyle)
+
+	// numbers locked by the go names stay with the names of the naming policy
+	diags := diag.Diagnostics{}
+	ApplyLock(l, structs, enums, nil, cfg, &diags)
+	assert.Empty(t, diags)
+	assert.Equal(t, map[string]int{"created_at": 3}, l.Message("api.Model").Numbers)
+	assert.Equal(t, map[string]int{"COUNTRY_UNSPECIFIED": 0, "COUNTRY_CANADA": 2}, l.Enum("api.Country").Numbers)
+	assert.Equal(t, []int{3}, fieldNumbers(structs[0]))
+	assert.Equal(t, 2, enums[0].Number)
+	assert.Empty(t, structs[0].Reserved.Names)
+}
+
+func TestApplyLockNumbersEnums(t *testing.T) {
+	cfg := internal.DefaultTranspilerConfig()
+	cfg.GoProjectPath = "example.com"
+	path := "example.com/api"
+	value := func(v int) *int { return &v }
+	enum := func(name string, goName string, v *int) internal.EnumAssignment {
+		return internal.EnumAssignment{Package: "api", Path: internal.Path{Path: &path}, Name: goName, FuncName: name, Value: v}
+	}
+	numbers := func(enums []internal.EnumAssignment) []int {
+		out := []int{}
+		for _, e := range enums {
+			out = append(out, e.Number)
+		}
+		return out
+	}
+
+	// the values are shifted past the added UNSPECIFIED value, iota offsets and gaps are kept
+	// the values of a type are one enum wherever they are declared
+	enums := []internal.EnumAssignment{
+		enum("Status", "Active", value(0)), enum("Status", "Inactive", value(1)),
+		enum("Level", "Low", value(1)), enum("Level", "High", value(2)),
+		enum("Kind", "KindUnspecified", value(0)), enum("Kind", "KindUser", value(1)),
+		enum("Status", "Banned", value(5)),
+	}
+	internal.ApplyNaming(nil, enums, internal.NamingStyle)
+	l := lock.New()
+	diags := diag.Diagnostics{}
+	ApplyLock(l, nil, enums, nil, cfg, &diags)
+	assert.Empty(t, diags)
+	assert.Equal(t, []int{1, 2, 1, 2, 0, 1, 6}, numbers(enums))
+	assert.Equal(t, map[string]int{"STATUS_UNSPECIFIED": 0, "STATUS_ACTIVE": 1, "STATUS_INACTIVE": 2, "STATUS_BANNED": 6}, l.Enum("api.Status").Numbers)
+	// a go constant that is the value 0 isn't added again
+	assert.Equal(t, map[string]int{"KIND_UNSPECIFIED": 0, "KIND_USER": 1}, l.Enum("api.Kind").Numbers)
+
+	// a lock written before enums had a value 0 keeps its numbers, only the value locked as 0 moves
+	l, err := lock.Parse("dumptruck.lock.json", []byte(`{"version": 1, "enums": {"api.Status": {"numbers": {"Active": 0, "Inactive": 1, "Banned": 5}}}}`))
+	assert.NoError(t, err)
+	status := []internal.EnumAssignment{enums[0], enums[1], enums[6]}
+	ApplyLock(l, nil, status, nil, cfg, &diags)
+	assert.Equal(t, 1, diags.Count(diag.Warning))
+	assert.Equal(t, "STATUS_ACTIVE was locked as 0, it is renumbered so 0 can be STATUS_UNSPECIFIED", diags[0].Msg)
+	assert.Equal(t, []int{6, 1, 5}, numbers(status))
+	assert.Equal(t, map[string]int{"STATUS_UNSPECIFIED": 0, "STATUS_ACTIVE": 6, "STATUS_INACTIVE": 1, "STATUS_BANNED": 5}, l.Enum("api.Status").Numbers)
+	assert.Empty(t, l.Enum("api.Status").ReservedNumbers)
+
+	// switching the naming policy renames every locked value, UNSPECIFIED included
+	cfg.Naming = internal.NamingGo
+	goEnums := []internal.EnumAssignment{enum("Status", "Active", value(0)), enum("Status", "Inactive", value(1)), enum("Status", "Banned", value(5))}
+	diags = diag.Diagnostics{}
+	ApplyLock(l, nil, goEnums, nil, cfg, &diags)
+	assert.Empty(t, diags)
+	assert.Equal(t, []int{6, 1, 5}, numbers(goEnums))
+	assert.Equal(t, map[string]int{"StatusUnspecified": 0, "Active": 6, "Inactive": 1, "Banned": 5}, l.Enum("api.Status").Numbers)
+}
+
+func TestApplyLockNumbersLikeNoLock(t *testing.T) {
+	cfg := internal.DefaultTranspilerConfig()
+	cfg.GoProjectPath = "example.com"
+	path := "example.com/api"
+
+	// the fields E promotes from its flattened embedded struct prefer their block, its own field is the first free number
+	fields := func() []*internal.Field {
+		return []*internal.Field{
+			{Name: "CreatedBy", Type: "string", Number: 1001},
+			{Name: "UpdatedAt", Type: "string", Number: 1005},
+			{Name: "Message", Type: "string", Number: 2001},
+			{Name: "Note", Type: "string"},
+		}
+	}
+	numbers := func(msg MessageModel) []int {
+		out := []int{}
+		for _, f := range msg.Fields {
+			out = append(out, f.Number)
+		}
+		return out
+	}
+	unlocked := protoMessage(nil, MessageModel{Name: "E"}, fields(), internal.DependencySet{}, cfg)[0]
+	s := internal.Struct{Package: "api", Path: internal.Path{Path: &path}, Name: "E", Fields: fields()}
+	structs := []internal.Struct{s}
+	ApplyLock(lock.New(), structs, nil, nil, cfg, &diag.Diagnostics{})
+	locked := protoMessage(nil, MessageModel{Name: "E"}, structs[0].Fields, internal.DependencySet{}, cfg)[0]
+	assert.Equal(t, []int{1001, 1005, 2001, 1}, numbers(unlocked))
+	assert.Equal(t, numbers(unlocked), numbers(locked))
+
+	// go constants with the same value are different proto values
+	value := func(v int) *int { return &v }
+	enums := []internal.EnumAssignment{
+		{Package: "api", Path: internal.Path{Path: &path}, FuncName: "Level", Name: "Low", Value: value(1)},
+		{Package: "api", Path: internal.Path{Path: &path}, FuncName: "Level", Name: "Default", Value: value(1)},
+		{Package: "api", Path: internal.Path{Path: &path}, FuncName: "Level", Name: "High", Value: value(2)},
+	}
+	internal.ApplyNaming(nil, enums, cfg.Naming)
+	preferred, _ := lockedEnumNumbers(enums, cfg)
+	ApplyLock(lock.New(), nil, enums, nil, cfg, &diag.Diagnostics{})
+	assigned, _ := lockedEnumNumbers(enums, cfg)
+	assert.Equal(t, []int{1, 2, 3}, preferred)
+	assert.Equal(t, preferred, assigned)
+}
@@ -0,0 +1,146 @@
+package writers
+
+import (
+	"fmt"
+
+	"code.justin.tv/safety/go2proto/internal"
+	astt "code.justin.tv/safety/go2proto/internal/ast"
+)
+
+// mapWrapper is a generated message holding a list or a map that proto3 doesn't allow to be nested directly
+// i.e. the values of map[K][]V and map[K1]map[K2]V or the elements of []map[K]V
+type mapWrapper struct {
+	name  string
+	field *internal.Field // the only field of the message, values for lists and entries for maps
+}
+
+// mapWrappers returns the wrappers a map field of message needs directly, wrappers of wrappers are not included
+func mapWrappers(message string, field *internal.Field) []mapWrapper {
+	if !field.IsMap() {
+		return nil
+	}
+
+	if field.Repeated {
+		entries := *field
+		entries.Name = "entries"
+		entries.ProtoName = ""
+		entries.Repeated = false
+		entries.Number = 0
+		return []mapWrapper{{name: wrapperName(message, field, "Item"), field: &entries}}
+	}
+
+	if field.MapValueNeedsWrapper() {
+		values := *field.MapValue
+		values.Name = "entries"
+		if values.Repeated {
+			values.Name = "values"
+		}
+		return []mapWrapper{{name: wrapperName(message, field, "Value"), field: &values}}
+	}
+	return nil
+}
+
+// wrapperName names the wrapper of a field after the message and field it belongs to e.g. ThingTagsValue
+func wrapperName(message string, field *internal.Field, suffix string) string {
+	return message + pbFieldName(field) + suffix
+}
+
+// mapProtoType returns the proto type of a map field of message, a slice of maps is a repeated wrapper
+func mapProtoType(parentNode *astt.GoNode, field *internal.Field, message string, cfg internal.TranspilerConfig) (string, internal.DependencySet) {
+	deps := internal.DependencySet{}
+	if field.Repeated {
+		wrapper := mapWrappers(message, field)[0]
+		_, wrapperDeps := fieldProtoType(parentNode, wrapper.field, wrapper.name, cfg)
+		return wrapper.name, addDependencies(wrapperDeps, deps)
+	}
+
+	// map keys are validated while parsing, anything that is left falls back to string keys
+	keyType, ok := field.MapKeyProtoType()
+	if !ok {
+		keyType = "string"
+	}
+
+	valueType := ""
+	if wrappers := mapWrappers(message, field); len(wrappers) > 0 {
+		valueType = wrappers[0].name
+		_, wrapperDeps := fieldProtoType(parentNode, wrappers[0].field, wrappers[0].name, cfg)
+		addDependencies(wrapperDeps, deps)
+	} else {
+		var valueDeps internal.DependencySet
+		valueType, valueDeps = fieldProtoType(parentNode, field.MapValue, message, cfg)
+		addDependencies(valueDeps, deps)
+	}
+	return fmt.Sprintf("map<%s, %s>", keyType, valueType), deps
+}
+
+// mapWrapperMessages returns every wrapper message the fields of message need, including wrappers of wrappers, the
+// proto files their fields depend on are added to deps
+func mapWrapperMessages(parentNode *astt.GoNode, message string, fields []*internal.Field, deps internal.DependencySet, cfg internal.TranspilerConfig) []MessageModel {
+	out := []MessageModel{}
+	for _, field := range fields {
+		for _, wrapper := range mapWrappers(message, field) {
+			out = append(out, protoMessage(parentNode, MessageModel{Name: wrapper.name, Wrapper: true}, []*internal.Field{wrapper.field}, deps, cfg)...)
+		}
+	}
+	return out
+}
+
+// pbElemType returns the type protoc-gen-go generates for a single (non repeated) value of a plain old data field
+func pbElemType(field *internal.Field) string {
+	switch field.Type {
+	case "time.Time":
+		return "*timestamppb.Timestamp"
+	case "time.Duration":
+		return "*durationpb.Duration"
+	case "interface":
+		return "*structpb.Value"
+	case "bytes":
+		return "[]byte"
+	case "int", "int8", "int16", "rune":
+		return "int32"
+	case "uint", "uint8", "uint16", "byte":
+		return "uint32"
+	}
+	return field.Type
+}
+
+func isGoBuiltin(t string) bool {
+	switch t {
+	case "string", "bool", "int", "int8", "int16", "int32", "int64", "uint", "uint8", "uint16", "uint32", "uint64",
+		"float32", "float64", "byte", "rune":
+		return true
+	}
+	return false
+}
+
+// podFromPb converts the protobuf value expr of a plain old data field to its (non pointer) go type
+func podFromPb(field *internal.Field, expr string) string {
+	switch field.Type {
+	case "time.Time":
+		return expr + ".AsTime()"
+	case "time.Duration":
+		return expr + ".AsDuration()"
+	case "interface":
+		return expr + ".AsInterface()"
+	}
+
+	if pbElem := pbElemType(field); pbElem != field.Type && field.Type != "bytes" {
+		return fmt.Sprintf("%s(%s)", field.Type, expr)
+	}
+	return expr
+}
+
+// podFromGo converts the go value expr of a plain old data field to its protobuf type
+func podFromGo(field *internal.Field, expr string) string {
+	switch field.Type {
+	case "time.Time":
+		return fmt.Sprintf("timestamppb.New(%s)", expr)
+	case "time.Duration":
+		return fmt.Sprintf("durationpb.New(%s)", expr)
+	}
+
+	if pbElem := pbElemType(field); pbElem != field.Type && field.Type != "bytes" {
+		return fmt.Sprintf("%s(%s)", pbElem, expr)
+	}
+	return expr
+}
@@ -0,0 +1,45 @@
+package writers
+
+import (
+	"fmt"
+	"testing"
+
+	"code.justin.tv/safety/go2proto/internal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMapFields(t *testing.T) {
+	cfg := internal.DefaultTranspilerConfig()
+	fields := []*internal.Field{
+		{Name: "Labels", Type: "map", MapKey: &internal.Field{Type: "string"}, MapValue: &internal.Field{Type: "int"}},
+		{Name: "ByUser", Type: "map", MapKey: &internal.Field{Type: "UserID", Underlying: "string"}, MapValue: &internal.Field{Type: "Thing", Optional: true, Repeated: true}},
+		{Name: "Nested", Type: "map", MapKey: &internal.Field{Type: "int64"}, MapValue: &internal.Field{
+			Type:     "map",
+			MapKey:   &internal.Field{Type: "string"},
+			MapValue: &internal.Field{Type: "time.Time"},
+		}},
+		{Name: "Pages", Type: "map", Repeated: true, MapKey: &internal.Field{Type: "string"}, MapValue: &internal.Field{Type: "string"}},
+	}
+
+	types := []string{}
+	for idx, f := range fields {
+		field, _ := protoField(nil, f, "Thing", idx+1, cfg)
+		types = append(types, fmt.Sprintf("%s %s %s = %d", field.Label, field.Type, field.Name, field.Number))
+	}
+	assert.Equal(t, []string{
+		" map<string, int32> Labels = 1",
+		" map<string, ThingByUserValue> ByUser = 2",
+		" map<int64, ThingNestedValue> Nested = 3",
+		"repeated ThingPagesItem Pages = 4",
+	}, types)
+
+	wrappers := mapWrapperMessages(nil, "Thing", fields, internal.DependencySet{}, cfg)
+	assert.Len(t, wrappers, 3)
+	for idx, name := range []string{"ThingByUserValue", "ThingNestedValue", "ThingPagesItem"} {
+		assert.Equal(t, name, wrappers[idx].Name)
+		assert.True(t, wrappers[idx].Wrapper)
+	}
+	assert.Equal(t, FieldModel{Name: "values", Type: "Thing", Label: "repeated", Number: 1, Go: wrappers[0].Fields[0].Go}, wrappers[0].Fields[0])
+	assert.Equal(t, "map<string, google.protobuf.Timestamp>", wrappers[1].Fields[0].Type)
+	assert.Equal(t, "map<string, string>", wrappers[2].Fields[0].Type)
+}
@@ -0,0 +1,163 @@
+package writers
+
+import "code.justin.tv/safety/go2proto/internal"
+
+// The models below are what the templates are executed with, they are the contract with the templates of a
+// templates directory. Docs are the doc comments of the go declarations without the comment markers, render them
+// with the comment function
+
+// ProtoFileModel is the model of proto.tmpl: the .proto file of a go package or of a service
+type ProtoFileModel struct {
+	Package   string         // proto package e.g. root.dummy.pkg1
+	GoPackage string         // go_package option
+	Imports   []string       // the .proto files of other go packages it imports, the well known types aren't listed
+	Options   string         // proto package of the options file the values of string enums refer to
+	Enums     []EnumModel    // in the order they are written
+	Messages  []MessageModel // in the order they are written, wrapper messages follow the message that needs them
+	Services  []ServiceModel // the service of a service file, none in the file of a go package
+}
+
+// EnumModel is an enum transpiled from a go type and its constants
+type EnumModel struct {
+	Name     string
+	Doc      string
+	Reserved []string         // reserved statements e.g. reserved 2, 4 to 6;
+	Values   []EnumValueModel // by number, the value 0 an unset field reads back as is first
+	GoType   string           // package qualified name of the go type e.g. nest.Country
+}
+
+// EnumValueModel is a value of an enum transpiled from a go constant
+type EnumValueModel struct {
+	Name    string // proto name after the naming policy e.g. COUNTRY_CANADA
+	GoName  string // name of the go constant e.g. Canada, empty for the UNSPECIFIED value 0 that is added to enums
+	GoValue string // proto string literal of the value of a go string constant e.g. "Canada", empty when it isn't known
+	Number  int
+	Doc     string
+}
+
+// OptionsModel is the model of options.tmpl: the options file that declares the custom options of the protos
+type OptionsModel struct {
+	Package   string // proto package e.g. dumptruck
+	GoPackage string // go_package option
+}
+
+// MessageModel is a message transpiled from a go struct, the request or response of a method or a wrapper
+type MessageModel struct {
+	Name     string
+	Doc      string
+	Reserved []string // reserved statements e.g. reserved "Name";
+	Fields   []FieldModel
+	Wrapper  bool   // a message holding a list or map that proto3 can't nest directly, it has no go type
+	GoType   string // package qualified name of the go struct, empty for requests, responses and wrappers
+	Oneof    string // name of the oneof every field is in, the message of a sealed interface, empty for other messages
+}
+
+// FieldModel is a field of a message
+type FieldModel struct {
+	Name   string // proto field name after the naming policy, Go.Name is the name of the go field
+	Type   string // proto type without the label e.g. int64, google.protobuf.Timestamp or map<string, Tags>
+	Label  string // repeated, optional or empty
+	Number int
+	Doc    string
+	Go     *internal.Field // the go field, parameter or result the field was transpiled from
+}
+
+// ServiceModel is a service transpiled from a go interface
+type ServiceModel struct {
+	Name      string
+	Doc       string
+	Interface string     // name of the go interface
+	RPCs      []RPCModel // in the order of their locked numbers
+}
+
+// RPCModel is an rpc of a service transpiled from a method of the go interface
+type RPCModel struct {
+	Name         string
+	Doc          string
+	Request      string // name of the request message
+	Response     string // name of the response message
+	ClientStream bool   // the requests are streamed
+	ServerStream bool   // the responses are streamed
+}
+
+// GoFileModel is the model of go_file.tmpl that every generated go file is rendered with, the result is formatted
+// with go/format
+type GoFileModel struct {
+	Generator    string     // what generated the file e.g. server adapter of Leviathan
+	Package      string     // package clause
+	StdImports   []GoImport // the standard library packages the body uses
+	OtherImports []GoImport // every other package the body uses
+	Body         string     // the declarations
+}
+
+// GoImport is an import of a generated go file
+type GoImport struct {
+	Name string // alias, empty when it is the name of the package
+	Path string
+}
+
+// AdapterModel is the model of server.tmpl and client.tmpl: the adapter between a service and its go interface
+type AdapterModel struct {
+	Service   string // name of the service, pb.<Service>Server and pb.<Service>Client are the generated grpc types
+	Interface string // package qualified name of the go interface
+	Methods   []AdapterMethodModel
+}
+
+// AdapterMethodModel is a method of the go interface and the code that adapts it
+type AdapterMethodModel struct {
+	Name    string
+	Doc     string
+	Source  string // the go method, empty when it isn't adapted
+	Skipped string // why it isn't adapted
+}
+
+// StructConvertersModel is the model of struct_converters.tmpl: the converters of the structs of a go package
+type StructConvertersModel struct {
+	Package string // name of the go package, the package of the converters too
+	Structs []StructConverterModel
+	Helpers []string // the functions converting map fields of the structs
+}
+
+// StructConverterModel is the conversion of a struct to and from its message
+type StructConverterModel struct {
+	Name     string
+	GoType   string // package qualified go type e.g. pkg4.D
+	PbType   string // package qualified protobuf go type e.g. pbpkg4.D
+	FromGo   string // statements of <Name>FromGoPtr after the nil check of in, they return the message
+	FromPb   string // statements of <Name>FromPbPtr after the nil check of msg, they return the struct
+	Sealed   bool   // a sealed interface, converted by <Name>FromGo and <Name>FromPb switching on its Variants instead
+	Variants []SealedVariantModel
+}
+
+// SealedVariantModel is a go type implementing a sealed interface and the member of the oneof that holds it
+type SealedVariantModel struct {
+	GoType string // the case of the go type switch e.g. *shapes.Circle
+	PbType string // the case of the protobuf type switch e.g. *pbshapes.Shape_Circle, empty for *T when T is a case too
+	FromGo string // the message of v, the go value of the case
+	FromPb string // the go value of v, the protobuf value of the case
+}
+
+// EnumConvertersModel is the model of enum_converters.tmpl: the converters of the enums of a go package
+type EnumConvertersModel struct {
+	Package string // name of the go package, the package of the converters too
+	Enums   []EnumConverterModel
+}
+
+// EnumConverterModel is the conversion of an enum to and from its protobuf enum
+type EnumConverterModel struct {
+	Name        string
+	GoType      string // package qualified go type e.g. nest.Country
+	PbType      string // package qualified protobuf go type e.g. pbnest.Country
+	Zero        string // the go zero value the value 0 and protobuf values without a constant convert to e.g. 0
+	Unspecified string // package qualified protobuf constant of the value 0 e.g. pbnest.Country_COUNTRY_UNSPECIFIED
+	Strings     bool   // the go values are strings, they are converted with a value table too
+	Values      []EnumConverterValue
+}
+
+// EnumConverterValue is a go constant and its protobuf constant
+type EnumConverterValue struct {
+	Go     string // package qualified e.g. nest.US
+	Pb     string // package qualified e.g. pbnest.Country_US
+	String string // go string literal of the value of a string constant e.g. "US", empty when it isn't known
+	Alias  bool   // an earlier constant has the same go value, the go value converts to the protobuf constant of that one
+}
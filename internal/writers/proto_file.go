@@ -8,7 +8,7 @@ import (
 )
 
 type ProtoFile struct {
-	packagePath string // the relative path of the package
+	packagePath string // the import path of the package
 	filePath    string
 	sb          *strings.Builder
 	deps        internal.DependencySet
@@ -0,0 +1,514 @@
+package writers
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"code.justin.tv/safety/go2proto/internal"
+	astt "code.justin.tv/safety/go2proto/internal/ast"
+)
+
+const (
+	timestamppbImport = "google.golang.org/protobuf/types/known/timestamppb"
+	durationpbImport  = "google.golang.org/protobuf/types/known/durationpb"
+)
+
+// WriteServerAdapters writes the server adapter of every service and the conversion and error helpers it uses
+func WriteServerAdapters(parentNode *astt.GoNode, services []internal.Service, structs []internal.Struct, enums []internal.EnumAssignment, goErrors []internal.GoError, cfg internal.TranspilerConfig) error {
+	for _, svc := range services {
+		src, err := ServerAdapter(parentNode, svc, structs, enums, cfg)
+		if err != nil {
+			return err
+		}
+		dir := filepath.Join(cfg.AdaptersDir, AdapterPackage(svc))
+		if err := WriteFile(filepath.Join(dir, "server.go"), src); err != nil {
+			return err
+		}
+		helpers, err := newGoFile("conversion helpers of "+svc.Name, AdapterPackage(svc), cfg).source(convertHelpers)
+		if err != nil {
+			return err
+		}
+		if err := WriteFile(filepath.Join(dir, "convert.go"), helpers); err != nil {
+			return err
+		}
+		errs, err := ErrorAdapter(svc, goErrors, cfg)
+		if err != nil {
+			return err
+		}
+		if err := WriteFile(filepath.Join(dir, "errors.go"), errs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// convertHelpers are the generic functions the adapters of a service convert parameters and results with
+const convertHelpers = `
+// convertSlice converts every value of values, nil stays nil
+func convertSlice[From, To any](values []From, convert func(From) To) []To {
+	if values == nil {
+		return nil
+	}
+	out := make([]To, len(values))
+	for idx, v := range values {
+		out[idx] = convert(v)
+	}
+	return out
+}
+
+// convertPtr converts the value v points to, nil stays nil
+func convertPtr[From, To any](v *From, convert func(From) To) *To {
+	if v == nil {
+		return nil
+	}
+	out := convert(*v)
+	return &out
+}
+
+// convertOrZero converts the value v points to, the zero value of To (e.g. a nil message) when v is nil
+func convertOrZero[From, To any](v *From, convert func(From) To) To {
+	var out To
+	if v != nil {
+		out = convert(*v)
+	}
+	return out
+}
+
+// convertMessage converts the message v, nil stays nil
+func convertMessage[From, To any](v *From, convert func(*From) To) *To {
+	if v == nil {
+		return nil
+	}
+	out := convert(v)
+	return &out
+}
+
+// deref returns the value v points to, the zero value when v is nil
+func deref[T any](v *T) T {
+	var out T
+	if v != nil {
+		out = *v
+	}
+	return out
+}
+
+// ref returns a pointer to v
+func ref[T any](v T) *T {
+	return &v
+}
+`
+
+// ServerAdapter returns the go source of the type that implements the grpc server of a service by calling the
+// go interface it was generated from. The parameters and results are converted with the converters, methods
+// with a parameter or result that can't be converted are left to the embedded unimplemented server. It is rendered
+// with server.tmpl
+func ServerAdapter(parentNode *astt.GoNode, svc internal.Service, structs []internal.Struct, enums []internal.EnumAssignment, cfg internal.TranspilerConfig) ([]byte, error) {
+	if len(svc.Funcs) == 0 || svc.Funcs[0].Path.Path == nil {
+		return nil, fmt.Errorf("server adapter of %s: the package of interface %s is unknown", svc.Name, svc.Interface)
+	}
+	a := newAdapterTypes(newGoFile("server adapter of "+svc.Name, AdapterPackage(svc), cfg), parentNode, structs, enums, cfg)
+	a.use("context", "context")
+	a.use("pb", svc.GoPackage)
+	iface := a.use(svc.Funcs[0].Package, *svc.Funcs[0].Path.Path) + "." + svc.Interface
+
+	model := AdapterModel{Service: svc.Name, Interface: iface}
+	for _, f := range svc.Funcs {
+		// the imports of a method that can't be adapted aren't used, even when its comment names them
+		restore := a.snapshot()
+		method := &strings.Builder{}
+		if err := a.writeServerMethod(method, svc, f); err != nil {
+			restore()
+			model.Methods = append(model.Methods, AdapterMethodModel{Name: f.Name, Skipped: err.Error()})
+			continue
+		}
+		model.Methods = append(model.Methods, AdapterMethodModel{Name: f.Name, Doc: f.Doc, Source: method.String()})
+	}
+
+	body, err := render(cfg, "server.tmpl", model)
+	if err != nil {
+		return nil, fmt.Errorf("server adapter of %s: %w", svc.Name, err)
+	}
+	return a.source(string(body))
+}
+
+// writeServerMethod writes the grpc method of f that converts its request, calls f and converts its results
+func (a *adapterTypes) writeServerMethod(sb *strings.Builder, svc internal.Service, f internal.Function) error {
+	if f.Incomplete {
+		return fmt.Errorf("a parameter or result was skipped")
+	}
+	client, server := f.ClientStream(), f.ServerStream()
+	request, response := "pb."+f.Name+"Request", "pb."+f.Name+"Response"
+	stream := fmt.Sprintf("pb.%s_%sServer", svc.Name, f.Name)
+
+	needsCtx := (client != nil && client.Stream == internal.StreamChan) || (server != nil && server.Stream == internal.StreamChan)
+	for _, param := range f.Fields {
+		needsCtx = needsCtx || param.IsContext()
+	}
+
+	body := &strings.Builder{}
+	switch {
+	case client == nil && server == nil:
+		sb.WriteString(fmt.Sprintf("func (s *Server) %s(ctx context.Context, req *%s) (*%s, error) {\n", f.Name, request, response))
+	case client == nil:
+		sb.WriteString(fmt.Sprintf("func (s *Server) %s(req *%s, stream %s) error {\n", f.Name, request, stream))
+	default:
+		sb.WriteString(fmt.Sprintf("func (s *Server) %s(stream %s) error {\n", f.Name, stream))
+	}
+	if (client != nil || server != nil) && needsCtx {
+		body.WriteString("ctx := stream.Context()\n")
+	}
+
+	// the other parameters are sent with the first request of a client stream
+	if client != nil {
+		value, err := a.value(client)
+		if err != nil {
+			return fmt.Errorf("parameter %s: %w", client.Name, err)
+		}
+		first := "_"
+		if len(requestFields(f)) > 1 {
+			first = "req"
+		}
+		get := fmt.Sprintf("func(msg *%s) %s { return %s }", request, value.goType, value.fromPb("msg."+pbFieldName(client)))
+		if client.Stream == internal.StreamChan {
+			body.WriteString(fmt.Sprintf("%s, values, errc := Recv%sRequest(ctx, stream, %s)\n", first, f.Name, get))
+		} else {
+			body.WriteString("var recvErr error\n")
+			body.WriteString(fmt.Sprintf("%s, values := Recv%sRequest(stream, %s, &recvErr)\n", first, f.Name, get))
+		}
+		if first == "req" {
+			body.WriteString(fmt.Sprintf("if req == nil {\nreq = &%s{}\n}\n", request))
+		}
+	}
+
+	args := []string{}
+	for _, param := range f.Fields {
+		switch {
+		case param.IsContext():
+			args = append(args, "ctx")
+		case param == client:
+			args = append(args, "values")
+		default:
+			value, err := a.value(param)
+			if err != nil {
+				return fmt.Errorf("parameter %s: %w", param.Name, err)
+			}
+			if param.Stream == internal.StreamCallback {
+				args = append(args, fmt.Sprintf("Send%sResponse(stream, func(msg *%s, v %s) { msg.%s = %s })", f.Name, response, value.goType, pbFieldName(param), value.fromGo("v")))
+			} else if param.Variadic {
+				args = append(args, value.fromPb("req."+pbFieldName(param))+"...")
+			} else {
+				args = append(args, value.fromPb("req."+pbFieldName(param)))
+			}
+		}
+	}
+
+	vars := []string{}
+	fields := []string{}
+	var streamed string
+	var streamedValue adapterValue
+	for idx, result := range f.ReturnTypes {
+		if result.Type == "error" {
+			if idx != len(f.ReturnTypes)-1 {
+				return fmt.Errorf("only the last result can be an error")
+			}
+			vars = append(vars, "err")
+			continue
+		}
+		value, err := a.value(result)
+		if err != nil {
+			return fmt.Errorf("result %s: %w", result.ProtoFieldName(), err)
+		}
+		name := fmt.Sprintf("res%d", len(vars)+1)
+		vars = append(vars, name)
+		if result == server {
+			streamed, streamedValue = name, value
+		} else {
+			fields = append(fields, fmt.Sprintf("%s: %s,\n", pbFieldName(result), value.fromGo(name)))
+		}
+	}
+
+	call := fmt.Sprintf("s.Impl.%s(%s)", f.Name, strings.Join(args, ", "))
+	if len(vars) == 0 {
+		body.WriteString(call + "\n")
+	} else {
+		body.WriteString(fmt.Sprintf("%s := %s\n", strings.Join(vars, ", "), call))
+	}
+	fail := "return %s\n"
+	if client == nil && server == nil {
+		fail = "return nil, %s\n"
+	}
+	if len(vars) > 0 && vars[len(vars)-1] == "err" {
+		body.WriteString("if err != nil {\n" + fmt.Sprintf(fail, "s.status(err)") + "}\n")
+	}
+
+	if streamed != "" {
+		set := fmt.Sprintf("func(msg *%s, v %s) { msg.%s = %s }", response, streamedValue.goType, pbFieldName(server), streamedValue.fromGo("v"))
+		if server.Stream == internal.StreamChan {
+			body.WriteString(fmt.Sprintf("if err := Send%sResponse(ctx, stream, nil, %s, %s); err != nil {\nreturn err\n}\n", f.Name, streamed, set))
+		} else {
+			body.WriteString(fmt.Sprintf("if err := Send%sResponse(stream, nil, %s, %s); err != nil {\nreturn err\n}\n", f.Name, streamed, set))
+		}
+	}
+	// the requests the handler didn't receive are drained so the error the stream failed with is sent on errc
+	// even when the handler returned before the stream ended, errc is closed once it is
+	if client != nil && client.Stream == internal.StreamChan {
+		body.WriteString("for range values {\n}\nif err := <-errc; err != nil {\nreturn err\n}\n")
+	} else if client != nil {
+		body.WriteString("if recvErr != nil {\nreturn recvErr\n}\n")
+	}
+
+	msg := fmt.Sprintf("&%s{\n%s}", response, strings.Join(fields, ""))
+	switch {
+	case client == nil && server == nil:
+		body.WriteString(fmt.Sprintf("return %s, nil\n", msg))
+	case server == nil:
+		body.WriteString(fmt.Sprintf("return stream.SendAndClose(%s)\n", msg))
+	default:
+		body.WriteString("return nil\n")
+	}
+	sb.WriteString(body.String())
+	sb.WriteString("}\n")
+	return nil
+}
+
+// adapterValue converts a parameter or result between its go type and the type of its protobuf field
+type adapterValue struct {
+	goType string
+	pbType string
+	fromGo func(expr string) string // expr is an identifier when it needs to be addressable
+	fromPb func(expr string) string
+}
+
+// adapterTypes resolves the go and protobuf types of the parameters and results of methods and imports the
+// packages they need into the file the code is generated into
+type adapterTypes struct {
+	*goFile
+	parentNode *astt.GoNode
+	cfg        internal.TranspilerConfig
+	enums      map[string]struct{} // import path + "." + name of every enum
+	messages   map[string]struct{} // import path + "." + name of every struct
+	sealed     map[string]struct{} // import path + "." + name of every sealed interface, they are in messages too
+	pkgNames   map[string]string   // import path -> package name of the packages with an enum or struct
+	converters string              // import path of the converters the code is generated into, they aren't imported
+}
+
+func newAdapterTypes(file *goFile, parentNode *astt.GoNode, structs []internal.Struct, enums []internal.EnumAssignment, cfg internal.TranspilerConfig) *adapterTypes {
+	a := &adapterTypes{
+		goFile:     file,
+		parentNode: parentNode,
+		cfg:        cfg,
+		enums:      map[string]struct{}{},
+		messages:   map[string]struct{}{},
+		sealed:     map[string]struct{}{},
+		pkgNames:   map[string]string{},
+	}
+	for _, enum := range enums {
+		if enum.Path.Path != nil {
+			a.enums[*enum.Path.Path+"."+enum.FuncName] = struct{}{}
+			a.pkgNames[*enum.Path.Path] = enum.Package
+		}
+	}
+	for _, s := range structs {
+		if s.Path.Path != nil {
+			a.messages[*s.Path.Path+"."+s.Name] = struct{}{}
+			a.pkgNames[*s.Path.Path] = s.Package
+			if s.Sealed {
+				a.sealed[*s.Path.Path+"."+s.Name] = struct{}{}
+			}
+		}
+	}
+	return a
+}
+
+// typeNode returns the go package the (non map) type of field is declared in, nil when it isn't part of the go tree
+func (a *adapterTypes) typeNode(field *internal.Field) *astt.GoNode {
+	if a.parentNode == nil {
+		return nil
+	}
+	selector := field.ComputeSelector()
+	switch {
+	case selector != nil && selector.ImportPath != "":
+		return a.parentNode.FindPackage(selector.ImportPath)
+	case selector != nil && field.Path.FilePath != nil:
+		if imp := astt.FindImport(selector.Package, a.parentNode.ImportsForPath(*field.Path.FilePath)); imp != nil {
+			return imp.GoNode
+		}
+		return nil
+	case selector == nil && field.Path.Path != nil:
+		return a.parentNode.FindPackage(*field.Path.Path)
+	}
+	return nil
+}
+
+// value returns the conversion of a parameter or result and adds the imports it needs
+func (a *adapterTypes) value(field *internal.Field) (adapterValue, error) {
+	if field.IsMap() {
+		return adapterValue{}, fmt.Errorf("map parameters and results can't be converted by the adapters")
+	}
+	if !field.Repeated {
+		return a.elem(field)
+	}
+
+	elem := *field
+	elem.Repeated = false
+	value, err := a.listElem(&elem)
+	if err != nil {
+		return adapterValue{}, err
+	}
+
+	out := adapterValue{goType: "[]" + value.goType, pbType: "[]" + value.pbType}
+	if value.goType == value.pbType && value.fromGo("v") == "v" && value.fromPb("v") == "v" {
+		out.fromGo = func(expr string) string { return expr }
+		out.fromPb = func(expr string) string { return expr }
+		return out, nil
+	}
+	out.fromGo = func(expr string) string {
+		return fmt.Sprintf("convertSlice(%s, func(v %s) %s { return %s })", expr, value.goType, value.pbType, value.fromGo("v"))
+	}
+	out.fromPb = func(expr string) string {
+		return fmt.Sprintf("convertSlice(%s, func(v %s) %s { return %s })", expr, value.pbType, value.goType, value.fromPb("v"))
+	}
+	return out, nil
+}
+
+// listElem returns the conversion of an element of a repeated field or a value of a map, they can't be optional
+// in protobuf so only messages are pointers
+func (a *adapterTypes) listElem(field *internal.Field) (adapterValue, error) {
+	value, err := a.elem(field)
+	if err != nil || !field.Optional {
+		return value, err
+	}
+	nonOptional := *field
+	nonOptional.Optional = false
+	inner, err := a.elem(&nonOptional)
+	if err != nil {
+		return adapterValue{}, err
+	}
+	if strings.HasPrefix(inner.pbType, "*") {
+		return value, nil
+	}
+	return adapterValue{
+		goType: value.goType,
+		pbType: inner.pbType,
+		fromGo: func(expr string) string { return inner.fromGo(fmt.Sprintf("deref(%s)", expr)) },
+		fromPb: func(expr string) string { return fmt.Sprintf("ref(%s)", inner.fromPb(expr)) },
+	}, nil
+}
+
+// elem returns the conversion of a single (not repeated) value of field
+func (a *adapterTypes) elem(field *internal.Field) (adapterValue, error) {
+	identity := func(expr string) string { return expr }
+	nonOptional := *field
+	nonOptional.Optional = false
+
+	if field.Type == "interface" {
+		return adapterValue{}, fmt.Errorf("interface{} parameters and results can't be converted by the adapters")
+	}
+	if isPodType(field.Type) || isGoBuiltin(field.Type) || field.Type == "bytes" {
+		value := adapterValue{
+			goType: a.goType(a.parentNode, field),
+			pbType: pbElemType(&nonOptional),
+			fromGo: func(expr string) string { return podFromGo(&nonOptional, expr) },
+			fromPb: func(expr string) string { return podFromPb(&nonOptional, expr) },
+		}
+		switch field.Type {
+		case "time.Time":
+			a.use("timestamppb", timestamppbImport)
+			if field.Optional {
+				value.fromGo = func(expr string) string { return fmt.Sprintf("convertOrZero(%s, timestamppb.New)", expr) }
+				value.fromPb = func(expr string) string {
+					return fmt.Sprintf("convertMessage(%s, (*timestamppb.Timestamp).AsTime)", expr)
+				}
+			}
+			return value, nil
+		case "time.Duration":
+			a.use("durationpb", durationpbImport)
+			if field.Optional {
+				value.fromGo = func(expr string) string { return fmt.Sprintf("convertOrZero(%s, durationpb.New)", expr) }
+				value.fromPb = func(expr string) string {
+					return fmt.Sprintf("convertMessage(%s, (*durationpb.Duration).AsDuration)", expr)
+				}
+			}
+			return value, nil
+		}
+		if !field.Optional {
+			return value, nil
+		}
+
+		// optional scalars are pointers on both sides
+		value.pbType = "*" + value.pbType
+		goElem := a.goType(a.parentNode, &nonOptional)
+		pbElem := pbElemType(&nonOptional)
+		if goElem == pbElem {
+			value.fromGo, value.fromPb = identity, identity
+			return value, nil
+		}
+		value.fromGo = func(expr string) string {
+			return fmt.Sprintf("convertPtr(%s, func(v %s) %s { return %s })", expr, goElem, pbElem, podFromGo(&nonOptional, "v"))
+		}
+		value.fromPb = func(expr string) string {
+			return fmt.Sprintf("convertPtr(%s, func(v %s) %s { return %s })", expr, pbElem, goElem, podFromPb(&nonOptional, "v"))
+		}
+		return value, nil
+	}
+
+	node := a.typeNode(field)
+	if node == nil || node.Path.Path == nil {
+		return adapterValue{}, fmt.Errorf("the package of %s isn't part of the go tree", field.Type)
+	}
+	name := field.Type
+	if selector := field.ComputeSelector(); selector != nil {
+		name = selector.Name
+	}
+	key := *node.Path.Path + "." + name
+	pkgName, ok := a.pkgNames[*node.Path.Path]
+	if !ok {
+		return adapterValue{}, fmt.Errorf("%s has no converters", field.Type)
+	}
+	_, goPkg, err := protoPackageForPath(node.Path, a.cfg)
+	if err != nil {
+		return adapterValue{}, err
+	}
+	converter := name
+	if converters := a.cfg.ConvertersImportPath(pkgName); converters != a.converters {
+		converter = a.use("converter"+pkgName, converters) + "." + name
+	}
+	pbType := a.use("pb"+pkgName, goPkg) + "." + name
+
+	value := adapterValue{goType: a.goType(a.parentNode, field)}
+	if _, ok := a.enums[key]; ok {
+		value.pbType = pbType
+		if field.Optional {
+			value.pbType = "*" + pbType
+			value.fromGo = func(expr string) string { return fmt.Sprintf("%sFromGoPtr(%s)", converter, expr) }
+			value.fromPb = func(expr string) string { return fmt.Sprintf("%sFromPbPtr(%s)", converter, expr) }
+		} else {
+			value.fromGo = func(expr string) string { return fmt.Sprintf("%sFromGo(%s)", converter, expr) }
+			value.fromPb = func(expr string) string { return fmt.Sprintf("%sFromPb(%s)", converter, expr) }
+		}
+		return value, nil
+	}
+	if _, ok := a.sealed[key]; ok {
+		// the go value is an interface that is nil already, a pointer to it isn't
+		if field.Optional {
+			return adapterValue{}, fmt.Errorf("a pointer to the sealed interface %s can't be converted", field.Type)
+		}
+		value.pbType = "*" + pbType
+		value.fromGo = func(expr string) string { return fmt.Sprintf("%sFromGo(%s)", converter, expr) }
+		value.fromPb = func(expr string) string { return fmt.Sprintf("%sFromPb(%s)", converter, expr) }
+		return value, nil
+	}
+	if _, ok := a.messages[key]; ok {
+		value.pbType = "*" + pbType
+		if field.Optional {
+			value.fromGo = func(expr string) string { return fmt.Sprintf("%sFromGoPtr(%s)", converter, expr) }
+			value.fromPb = func(expr string) string { return fmt.Sprintf("%sFromPbPtr(%s)", converter, expr) }
+		} else {
+			value.fromGo = func(expr string) string { return fmt.Sprintf("%sFromGoPtr(&%s)", converter, expr) }
+			value.fromPb = func(expr string) string { return fmt.Sprintf("deref(%sFromPbPtr(%s))", converter, expr) }
+		}
+		return value, nil
+	}
+	return adapterValue{}, fmt.Errorf("%s is neither a struct nor an enum", field.Type)
+}
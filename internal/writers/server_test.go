@@ -0,0 +1,79 @@
+package writers
+
+import (
+	"testing"
+
+	"code.justin.tv/safety/go2proto/internal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServerAdapter(t *testing.T) {
+	path := "example.com/users"
+	ctx := &internal.Field{Name: "ctx", Type: "context.Context", Selector: true}
+	svc := internal.Service{Name: "UserService", Interface: "Users", GoPackage: "example.com/gen/root.user_service", Funcs: []internal.Function{
+		{
+			Name: "List", Package: "users", Path: internal.Path{Path: &path},
+			Fields:      []*internal.Field{ctx, {Name: "limit", Type: "int"}, {Name: "since", Type: "time.Time", Selector: true, Optional: true}},
+			ReturnTypes: []*internal.Field{{ProtoName: "names", Type: "string", Repeated: true, Optional: true}, {ProtoName: "next_page", Type: "string"}, {Type: "error"}},
+		},
+		// a method without a context and without an error
+		{Name: "Count", Fields: []*internal.Field{{Name: "prefix", Type: "string"}}, ReturnTypes: []*internal.Field{{ProtoName: "int64", Type: "int64"}}},
+		{Name: "Tail", Fields: []*internal.Field{ctx, {Name: "prefix", Type: "string"}}, ReturnTypes: []*internal.Field{{ProtoName: "string", Type: "string", Stream: internal.StreamIterator}, {Type: "error"}}},
+		{Name: "Import", Fields: []*internal.Field{ctx, {Name: "names", Type: "string", Stream: internal.StreamChan}}, ReturnTypes: []*internal.Field{{ProtoName: "int64", Type: "int64"}, {Type: "error"}}},
+		// types of other packages need the go tree to be converted
+		{Name: "Get", Fields: []*internal.Field{ctx, {Name: "id", Type: "string"}}, ReturnTypes: []*internal.Field{{ProtoName: "user", Type: "models.User", Selector: true, Optional: true}, {Type: "error"}}},
+		{Name: "Delete", Fields: []*internal.Field{ctx}, ReturnTypes: []*internal.Field{{Type: "error"}}, Incomplete: true},
+		{Name: "Tag", Fields: []*internal.Field{ctx, {Name: "tags", Type: "string", Repeated: true, Variadic: true}}, ReturnTypes: []*internal.Field{{Type: "error"}}},
+	}}
+
+	src, err := ServerAdapter(nil, svc, nil, nil, internal.DefaultTranspilerConfig())
+	assert.NoError(t, err)
+	out := string(src)
+	assert.Contains(t, out, "import (\n\t\"context\"\n\n\tpb \"example.com/gen/root.user_service\"\n\t\"example.com/users\"\n")
+	assert.Contains(t, out, "type Server struct {\n\tpb.UnimplementedUserServiceServer\n\tImpl users.Users\n")
+	assert.Contains(t, out, `func (s *Server) List(ctx context.Context, req *pb.ListRequest) (*pb.ListResponse, error) {
+	res1, res2, err := s.Impl.List(ctx, int(req.Limit), convertMessage(req.Since, (*timestamppb.Timestamp).AsTime))
+	if err != nil {
+		return nil, s.status(err)
+	}
+	return &pb.ListResponse{
+		Names:    convertSlice(res1, func(v *string) string { return deref(v) }),
+		NextPage: res2,
+	}, nil
+}`)
+	assert.Contains(t, out, "\tres1 := s.Impl.Count(req.Prefix)\n\treturn &pb.CountResponse{\n\t\tInt64: res1,\n\t}, nil\n")
+	assert.Contains(t, out, `func (s *Server) Tail(req *pb.TailRequest, stream pb.UserService_TailServer) error {
+	ctx := stream.Context()
+	res1, err := s.Impl.Tail(ctx, req.Prefix)
+	if err != nil {
+		return s.status(err)
+	}
+	if err := SendTailResponse(stream, nil, res1, func(msg *pb.TailResponse, v string) { msg.String_ = v }); err != nil {
+		return err
+	}
+	return nil
+}`)
+	assert.Contains(t, out, `func (s *Server) Import(stream pb.UserService_ImportServer) error {
+	ctx := stream.Context()
+	_, values, errc := RecvImportRequest(ctx, stream, func(msg *pb.ImportRequest) string { return msg.Names })
+	res1, err := s.Impl.Import(ctx, values)`)
+	// a receive error after the handler returned isn't dropped
+	assert.Contains(t, out, "\tfor range values {\n\t}\n\tif err := <-errc; err != nil {\n\t\treturn err\n\t}\n\treturn stream.SendAndClose(&pb.ImportResponse{\n")
+	assert.Contains(t, out, "// Get isn't adapted, result user: the package of models.User isn't part of the go tree\n")
+	assert.Contains(t, out, "// Delete isn't adapted, a parameter or result was skipped\n")
+	assert.Contains(t, out, "\terr := s.Impl.Tag(ctx, req.Tags...)\n")
+	// the imports of methods that aren't adapted are dropped
+	assert.NotContains(t, out, "\"models\"")
+}
+
+func TestRequestFields(t *testing.T) {
+	ctx := &internal.Field{Name: "ctx", Type: "context.Context", Selector: true}
+	typed := &internal.Field{Name: "ctx", Type: "context.Context", Selector: true, Package: "context", ImportPath: "context"}
+	id := &internal.Field{Name: "id", Type: "string"}
+	other := &internal.Field{Name: "c", Type: "nest.Context", Selector: true}
+
+	assert.Equal(t, []*internal.Field{id}, requestFields(internal.Function{Fields: []*internal.Field{ctx, id}}))
+	assert.Equal(t, []*internal.Field{id}, requestFields(internal.Function{Fields: []*internal.Field{id, typed}}))
+	// a parameter that isn't a context is part of the request even when it comes first
+	assert.Equal(t, []*internal.Field{other, id}, requestFields(internal.Function{Fields: []*internal.Field{other, id}}))
+}
@@ -0,0 +1,231 @@
+package writers
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"code.justin.tv/safety/go2proto/internal"
+	astt "code.justin.tv/safety/go2proto/internal/ast"
+)
+
+// WriteStreamAdapters writes the stream adapters of every service with a streaming rpc
+func WriteStreamAdapters(parentNode *astt.GoNode, services []internal.Service, cfg internal.TranspilerConfig) error {
+	for _, svc := range services {
+		src, err := StreamAdapters(parentNode, svc, cfg)
+		if err != nil {
+			return err
+		}
+		if src == nil {
+			continue
+		}
+		if err := WriteFile(filepath.Join(cfg.AdaptersDir, AdapterPackage(svc), "stream.go"), src); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AdapterPackage returns the name of the go package the adapters of a service are written to
+func AdapterPackage(svc internal.Service) string {
+	return strings.ReplaceAll(internal.SnakeCase(svc.Name), "_", "")
+}
+
+// streamMessage is a request or response message that is streamed with the values of field
+type streamMessage struct {
+	name  string
+	field *internal.Field
+}
+
+// StreamAdapters returns the go source of the functions that pump values between the channels, iterators and
+// callbacks of a service's streaming methods and their grpc streams, nil when no rpc of the service streams.
+// There is a Send and a Recv function per streamed message so servers and clients use the same adapters, the
+// values are converted to and from the messages by the caller
+func StreamAdapters(parentNode *astt.GoNode, svc internal.Service, cfg internal.TranspilerConfig) ([]byte, error) {
+	messages := []streamMessage{}
+	for _, f := range svc.Funcs {
+		if field := f.ClientStream(); field != nil {
+			messages = append(messages, streamMessage{name: f.Name + "Request", field: field})
+		}
+		if field := f.ServerStream(); field != nil {
+			messages = append(messages, streamMessage{name: f.Name + "Response", field: field})
+		}
+	}
+	if len(messages) == 0 {
+		return nil, nil
+	}
+
+	f := newGoFile("stream adapters of "+svc.Name, AdapterPackage(svc), cfg)
+	for _, name := range []string{"context", "io"} {
+		f.use(name, wellKnownImports[name])
+	}
+	f.use("pb", svc.GoPackage)
+	body := &strings.Builder{}
+	for _, msg := range messages {
+		goElem := f.goType(parentNode, msg.field)
+		pbMsg := "pb." + msg.name
+		body.WriteString(fmt.Sprintf(`
+// %[1]sSender is the stream %[1]ss are sent on e.g. the server stream of a server or the client stream of a client
+type %[1]sSender interface {
+	Send(*%[2]s) error
+}
+
+// %[1]sReceiver is the stream %[1]ss are received from
+type %[1]sReceiver interface {
+	Recv() (*%[2]s, error)
+}
+`, msg.name, pbMsg))
+		switch msg.field.Stream {
+		case internal.StreamChan:
+			writeChanAdapters(body, msg.name, pbMsg, goElem)
+		case internal.StreamIterator:
+			writeIteratorAdapters(body, msg.name, pbMsg, goElem)
+		case internal.StreamCallback:
+			writeCallbackAdapters(body, msg.name, pbMsg, goElem)
+		}
+	}
+
+	return f.source(body.String())
+}
+
+func writeChanAdapters(sb *strings.Builder, name string, pbMsg string, goElem string) {
+	sb.WriteString(fmt.Sprintf(`
+// Send%[1]s sends a %[1]s for every value received from values until it is closed or ctx is done,
+// set sets the value in the message and first is the message of the first value e.g. with the other fields set
+func Send%[1]s(ctx context.Context, stream %[1]sSender, first *%[2]s, values <-chan %[3]s, set func(*%[2]s, %[3]s)) error {
+	msg := first
+	if msg == nil {
+		msg = &%[2]s{}
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case v, ok := <-values:
+			if !ok {
+				return nil
+			}
+			set(msg, v)
+			if err := stream.Send(msg); err != nil {
+				return err
+			}
+			msg = &%[2]s{}
+		}
+	}
+}
+
+// Recv%[1]s receives every %[1]s of stream and sends the value get returns for it on the returned channel until
+// the stream ends or ctx is done. The first message is returned for its other fields, nil when the stream is empty,
+// and the error the stream failed with is sent on the error channel before it is closed
+func Recv%[1]s(ctx context.Context, stream %[1]sReceiver, get func(*%[2]s) %[3]s) (*%[2]s, <-chan %[3]s, <-chan error) {
+	values := make(chan %[3]s)
+	errc := make(chan error, 1)
+	first, err := stream.Recv()
+	if err != nil {
+		if err != io.EOF {
+			errc <- err
+		}
+		close(values)
+		close(errc)
+		return nil, values, errc
+	}
+
+	go func() {
+		defer close(errc)
+		defer close(values)
+		for msg := first; ; {
+			select {
+			case values <- get(msg):
+			case <-ctx.Done():
+				errc <- ctx.Err()
+				return
+			}
+			var err error
+			if msg, err = stream.Recv(); err == io.EOF {
+				return
+			} else if err != nil {
+				errc <- err
+				return
+			}
+		}
+	}()
+	return first, values, errc
+}
+`, name, pbMsg, goElem))
+}
+
+func writeIteratorAdapters(sb *strings.Builder, name string, pbMsg string, goElem string) {
+	sb.WriteString(fmt.Sprintf(`
+// Send%[1]s sends a %[1]s for every value of values, set sets the value in the message and first is the
+// message of the first value e.g. with the other fields set
+func Send%[1]s(stream %[1]sSender, first *%[2]s, values func(yield func(%[3]s) bool), set func(*%[2]s, %[3]s)) error {
+	msg := first
+	if msg == nil {
+		msg = &%[2]s{}
+	}
+	for v := range values {
+		set(msg, v)
+		if err := stream.Send(msg); err != nil {
+			return err
+		}
+		msg = &%[2]s{}
+	}
+	return nil
+}
+
+// Recv%[1]s returns the first %[1]s of stream for its other fields, nil when the stream is empty, and an iterator
+// over the value get returns for every message. err is set to the error the stream failed with
+func Recv%[1]s(stream %[1]sReceiver, get func(*%[2]s) %[3]s, err *error) (*%[2]s, func(yield func(%[3]s) bool)) {
+	first, recvErr := stream.Recv()
+	if recvErr != nil {
+		if recvErr != io.EOF {
+			*err = recvErr
+		}
+		return nil, func(yield func(%[3]s) bool) {}
+	}
+
+	return first, func(yield func(%[3]s) bool) {
+		for msg := first; ; {
+			if !yield(get(msg)) {
+				return
+			}
+			var recvErr error
+			if msg, recvErr = stream.Recv(); recvErr == io.EOF {
+				return
+			} else if recvErr != nil {
+				*err = recvErr
+				return
+			}
+		}
+	}
+}
+`, name, pbMsg, goElem))
+}
+
+func writeCallbackAdapters(sb *strings.Builder, name string, pbMsg string, goElem string) {
+	sb.WriteString(fmt.Sprintf(`
+// Send%[1]s returns the callback that sends a %[1]s for every value it is called with, set sets the value in the message
+func Send%[1]s(stream %[1]sSender, set func(*%[2]s, %[3]s)) func(%[3]s) error {
+	return func(v %[3]s) error {
+		msg := &%[2]s{}
+		set(msg, v)
+		return stream.Send(msg)
+	}
+}
+
+// Recv%[1]s calls fn with the value get returns for every %[1]s of stream until the stream ends or fn fails
+func Recv%[1]s(stream %[1]sReceiver, get func(*%[2]s) %[3]s, fn func(%[3]s) error) error {
+	for {
+		msg, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if err := fn(get(msg)); err != nil {
+			return err
+		}
+	}
+}
+`, name, pbMsg, goElem))
+}
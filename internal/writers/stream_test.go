@@ -0,0 +1,57 @@
+package writers
+
+import (
+	"strings"
+	"testing"
+
+	"code.justin.tv/safety/go2proto/internal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStreamAdapters(t *testing.T) {
+	ctx := &internal.Field{Name: "ctx", Type: "context.Context", Selector: true}
+	event := &internal.Field{Name: "events", Type: "events.Event", Selector: true, Package: "events", ImportPath: "example.com/events", Stream: internal.StreamChan}
+	svc := internal.Service{Name: "EventService", Package: "root.event_service", GoPackage: "example.com/gen/root.event_service", Funcs: []internal.Function{
+		{Name: "Get", Fields: []*internal.Field{ctx, {Name: "id", Type: "string"}}, ReturnTypes: []*internal.Field{{Type: "string"}, {Type: "error"}}},
+		{Name: "Upload", Fields: []*internal.Field{ctx, event}, ReturnTypes: []*internal.Field{{Type: "int64"}, {Type: "error"}}},
+		{Name: "Chat", Fields: []*internal.Field{ctx, {Name: "in", Type: "string", Stream: internal.StreamIterator, Iterator: "iter.Seq"}}, ReturnTypes: []*internal.Field{{Type: "string", Stream: internal.StreamIterator, Iterator: "iter.Seq"}, {Type: "error"}}},
+		{Name: "Each", Fields: []*internal.Field{ctx, {Name: "limit", Type: "int64"}, {Name: "fn", Type: "string", Optional: true, Stream: internal.StreamCallback}}, ReturnTypes: []*internal.Field{{Type: "error"}}},
+	}}
+
+	// selectors need a go tree to be written in a proto
+	protoSvc := svc
+	protoSvc.Funcs = append([]internal.Function{}, svc.Funcs...)
+	protoSvc.Funcs[1].Fields = []*internal.Field{ctx, {Name: "events", Type: "string", Stream: internal.StreamChan}}
+	proto, err := ServiceProto(nil, protoSvc, internal.DefaultTranspilerConfig())
+	assert.NoError(t, err)
+	assert.Contains(t, proto, "rpc Get(GetRequest) returns (GetResponse);")
+	assert.Contains(t, proto, "rpc Upload(stream UploadRequest) returns (UploadResponse);")
+	assert.Contains(t, proto, "rpc Chat(stream ChatRequest) returns (stream ChatResponse);")
+	assert.Contains(t, proto, "rpc Each(EachRequest) returns (stream EachResponse);")
+	// the callback is streamed in the responses
+	assert.Contains(t, proto, "message EachRequest {\n    int64 limit = 1;\n}")
+	assert.Contains(t, proto, "message EachResponse {\n    optional string fn = 1;\n}")
+
+	src, err := StreamAdapters(nil, svc, internal.DefaultTranspilerConfig())
+	assert.NoError(t, err)
+	out := string(src)
+	assert.True(t, strings.HasPrefix(out, "// Code generated by dumptruck. DO NOT EDIT.\n\npackage eventservice\n"))
+	assert.Contains(t, out, "import (\n\t\"context\"\n\t\"io\"\n\n\t\"example.com/events\"\n\tpb \"example.com/gen/root.event_service\"\n)")
+	for _, fn := range []string{
+		"func SendUploadRequest(ctx context.Context, stream UploadRequestSender, first *pb.UploadRequest, values <-chan events.Event, set func(*pb.UploadRequest, events.Event)) error",
+		"func RecvUploadRequest(ctx context.Context, stream UploadRequestReceiver, get func(*pb.UploadRequest) events.Event) (*pb.UploadRequest, <-chan events.Event, <-chan error)",
+		"func SendChatResponse(stream ChatResponseSender, first *pb.ChatResponse, values func(yield func(string) bool), set func(*pb.ChatResponse, string)) error",
+		"func RecvChatRequest(stream ChatRequestReceiver, get func(*pb.ChatRequest) string, err *error) (*pb.ChatRequest, func(yield func(string) bool))",
+		"func SendEachResponse(stream EachResponseSender, set func(*pb.EachResponse, *string)) func(*string) error",
+		"func RecvEachResponse(stream EachResponseReceiver, get func(*pb.EachResponse) *string, fn func(*string) error) error",
+	} {
+		assert.Contains(t, out, fn)
+	}
+	assert.NotContains(t, out, "GetRequest")
+
+	// services without a streaming rpc have no adapters
+	svc.Funcs = svc.Funcs[:1]
+	src, err = StreamAdapters(nil, svc, internal.DefaultTranspilerConfig())
+	assert.NoError(t, err)
+	assert.Nil(t, src)
+}
@@ -2,226 +2,446 @@ package writers
 
 import (
 	"fmt"
-	"os"
+	"path/filepath"
+	"sort"
 	"strings"
 
 	"code.justin.tv/safety/go2proto/internal"
+	astt "code.justin.tv/safety/go2proto/internal/ast"
 )
 
-func WriteStructConverters(structs []internal.Struct, deps map[string]internal.DependencySet, pkgPrefixSlash string) {
-	pkgFiles := map[string]*strings.Builder{} // each converter is 1:1 with the package it belongs to
+const structpbImport = "google.golang.org/protobuf/types/known/structpb"
 
-	// Write header of converter file
-	for _, structImpl := range structs {
-		if _, ok := pkgFiles[structImpl.Package]; !ok {
-			pkgFiles[structImpl.Package] = &strings.Builder{}
+// WriteStructConverters writes the converters of the structs of every go package to
+// <ConvertersDir>/<package name>/struct.go and the generic helpers they use to convert.go
+func WriteStructConverters(parentNode *astt.GoNode, structs []internal.Struct, enums []internal.EnumAssignment, cfg internal.TranspilerConfig) error {
+	byPath := map[string][]internal.Struct{}
+	for _, s := range structs {
+		if s.Path.Path != nil {
+			byPath[*s.Path.Path] = append(byPath[*s.Path.Path], s)
+		}
+	}
+	paths := []string{}
+	for path := range byPath {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
 
-			sb := pkgFiles[structImpl.Package]
-			sb.WriteString(fmt.Sprintf("package %s\n\n", structImpl.Package))
-			sb.WriteString("import (\n")
+	for _, path := range paths {
+		pkgStructs := byPath[path]
+		src, err := StructConverters(parentNode, pkgStructs, structs, enums, cfg)
+		if err != nil {
+			return err
+		}
+		dir := filepath.Join(cfg.ConvertersDir, pkgStructs[0].Package)
+		if err := WriteFile(filepath.Join(dir, "struct.go"), src); err != nil {
+			return err
+		}
+		f := newGoFile("conversion helpers of "+pkgStructs[0].Package, pkgStructs[0].Package, cfg)
+		f.use("structpb", structpbImport)
+		helpers, err := f.source(convertHelpers + valueHelpers)
+		if err != nil {
+			return err
+		}
+		if err := WriteFile(filepath.Join(dir, "convert.go"), helpers); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-			pkg := structImpl.Package
-			sb.WriteString(fmt.Sprintf("    pb%s \"%s/%s\"\n", pkg, pkgPrefixSlash, pkg))
-			sb.WriteString(fmt.Sprintf("    %s \"code.justin.tv/safety/datastore/v5/%s\"\n", pkg, *structImpl.Path.Path))
+// valueHelpers convert interface{} fields, they are only part of the converters
+const valueHelpers = `
+// valueOf returns the google.protobuf.Value of v, nil (like an unset field) when v can't be represented e.g. a struct
+func valueOf(v interface{}) *structpb.Value {
+	value, err := structpb.NewValue(v)
+	if err != nil {
+		return nil
+	}
+	return value
+}
+`
 
-			// import the converters
-			for pkg := range deps[structImpl.Package] {
-				sb.WriteString(fmt.Sprintf("    converter%s \"code.justin.tv/safety/gateway/testserver/rpc/testserver/gen/converters/%s\"\n", pkg, pkg))
-			}
-			sb.WriteString("	\"google.golang.org/protobuf/types/known/timestamppb\"")
+// StructConverters returns the go source of the converters of the structs of a go package, <Name>FromGoPtr and
+// <Name>FromPbPtr convert a struct to and from its message and keep nil. Every package is imported as the go tree
+// resolves it and the types of other packages are converted by their converters, a field that can't be converted
+// is left unset and the reason is written in its place. It is rendered with struct_converters.tmpl
+func StructConverters(parentNode *astt.GoNode, pkgStructs []internal.Struct, structs []internal.Struct, enums []internal.EnumAssignment, cfg internal.TranspilerConfig) ([]byte, error) {
+	if len(pkgStructs) == 0 || pkgStructs[0].Path.Path == nil {
+		return nil, fmt.Errorf("struct converters: the package of the structs is unknown")
+	}
+	pkg := pkgStructs[0].Package
+	_, goPkg, err := protoPackageForPath(pkgStructs[0].Path, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("struct converters of %s: %w", pkg, err)
+	}
+
+	file := newGoFile("struct converters of "+pkg, pkg, cfg)
+	c := &structConverters{adapterTypes: newAdapterTypes(file, parentNode, structs, enums, cfg)}
+	c.converters = cfg.ConvertersImportPath(pkg)
+	c.goAlias = c.use(pkg, *pkgStructs[0].Path.Path)
+	c.pbAlias = c.use("pb"+pkg, goPkg)
+
+	model := StructConvertersModel{Package: pkg}
+	for _, s := range pkgStructs {
+		model.Structs = append(model.Structs, c.structModel(s))
+	}
+	model.Helpers = c.helpers
+
+	body, err := render(cfg, "struct_converters.tmpl", model)
+	if err != nil {
+		return nil, fmt.Errorf("struct converters of %s: %w", pkg, err)
+	}
+	return c.source(string(body))
+}
+
+// structConverters writes the converters of the structs of one go package
+type structConverters struct {
+	*adapterTypes
+	goAlias string   // alias of the go package
+	pbAlias string   // alias of its protobuf package
+	helpers []string // converters of the map fields, written after the structs
+}
+
+// structModel returns the statements of <Name>FromGoPtr and <Name>FromPbPtr of s
+func (c *structConverters) structModel(s internal.Struct) StructConverterModel {
+	goType := fmt.Sprintf("%s.%s", c.goAlias, s.Name)
+	pbType := fmt.Sprintf("%s.%s", c.pbAlias, s.Name)
+	if s.Sealed {
+		return c.sealedModel(s, goType, pbType)
+	}
 
-			sb.WriteString(")\n\n")
+	values := map[*internal.Field]adapterValue{}
+	skipped := map[*internal.Field]error{}
+	for _, field := range s.Fields {
+		value, err := c.field(s.Name, field)
+		if err != nil {
+			skipped[field] = err
+			continue
 		}
+		values[field] = value
 	}
 
-	// Write all of the structs
-	for _, structImpl := range structs {
-		sb := pkgFiles[structImpl.Package]
-		goType := fmt.Sprintf("%s.%s", structImpl.Package, structImpl.Name)
-		sb.WriteString(fmt.Sprintf("func %sFromPb(ent pb%s) (%s) {\n", structImpl.Name, goType, goType))
-		sb.WriteString(fmt.Sprintf("     return %s.%s {\n", structImpl.Package, structImpl.Name))
-		for _, field := range structImpl.Fields {
-			convert := ""
-			if field.Type == "time.Time" {
-				convert = ".AsTime()"
-			} else if field.Type == "interface" { // interfaces are encoded as google.Protobuf.Value
-				convert = ".AsInterface()"
-			}
+	fromGo, fromPb := &strings.Builder{}, &strings.Builder{}
+	if s.Wrapper && len(s.Fields) == 1 {
+		c.writeWrapperFromGo(fromGo, s, pbType, values, skipped)
+		c.writeWrapperFromPb(fromPb, s, goType, values, skipped)
+	} else {
+		c.writeLiteral(fromGo, s, pbType, values, skipped, false)
+		c.writeLiteral(fromPb, s, goType, values, skipped, true)
+	}
+	return StructConverterModel{Name: s.Name, GoType: goType, PbType: pbType, FromGo: fromGo.String(), FromPb: fromPb.String()}
+}
+
+// sealedModel returns the type switches of <Name>FromGo and <Name>FromPb of a sealed interface, every struct
+// implementing it is converted by its own converters. A struct that only implements it as a pointer is a pointer
+// on both sides, one that implements it as a value converts back to a value
+func (c *structConverters) sealedModel(s internal.Struct, goType, pbType string) StructConverterModel {
+	model := StructConverterModel{Name: s.Name, GoType: goType, PbType: pbType, Sealed: true}
+	for _, field := range s.Fields {
+		member := fmt.Sprintf("%s_%s", pbType, pbFieldName(field))
+		fromGo := func(expr string) string {
+			return fmt.Sprintf("&%s{%s: &%s{%s: %sFromGoPtr(%s)}}", pbType, goCamelCase(sealedOneof), member, pbFieldName(field), field.Type, expr)
+		}
+		fromPb := fmt.Sprintf("%sFromPbPtr(v.%s)", field.Type, pbFieldName(field))
+		variant := fmt.Sprintf("%s.%s", c.goAlias, field.Type)
+		if field.Optional {
+			model.Variants = append(model.Variants, SealedVariantModel{GoType: "*" + variant, PbType: "*" + member, FromGo: fromGo("v"), FromPb: fromPb})
+			continue
+		}
+		// both the struct and a pointer to it implement the interface
+		model.Variants = append(model.Variants,
+			SealedVariantModel{GoType: variant, PbType: "*" + member, FromGo: fromGo("&v"), FromPb: fmt.Sprintf("deref(%s)", fromPb)},
+			SealedVariantModel{GoType: "*" + variant, FromGo: fromGo("v")},
+		)
+	}
+	return model
+}
+
+// writeWrapperFromGo returns the message of a named map or slice type, the type itself is its only field
+func (c *structConverters) writeWrapperFromGo(sb *strings.Builder, s internal.Struct, pbType string, values map[*internal.Field]adapterValue, skipped map[*internal.Field]error) {
+	field := s.Fields[0]
+	if err, ok := skipped[field]; ok {
+		sb.WriteString(fmt.Sprintf("// %s isn't converted, %s\n", field.Name, err))
+		sb.WriteString(fmt.Sprintf("return &%s{}\n", pbType))
+		return
+	}
+	sb.WriteString(fmt.Sprintf("return &%s{\n%s: %s,\n}\n", pbType, pbFieldName(field), values[field].fromGo("*in")))
+}
+
+// writeWrapperFromPb returns the named map or slice type of a message
+func (c *structConverters) writeWrapperFromPb(sb *strings.Builder, s internal.Struct, goType string, values map[*internal.Field]adapterValue, skipped map[*internal.Field]error) {
+	field := s.Fields[0]
+	if err, ok := skipped[field]; ok {
+		sb.WriteString(fmt.Sprintf("// %s isn't converted, %s\n", field.Name, err))
+		sb.WriteString(fmt.Sprintf("return new(%s)\n", goType))
+		return
+	}
+	sb.WriteString(fmt.Sprintf("out := %s(%s)\nreturn &out\n", goType, values[field].fromPb("msg."+pbFieldName(field))))
+}
+
+// writeLiteral writes the return of a converter building literalType from in (go) or msg (fromPb). Fields
+// promoted from flattened embedded structs can't be set in a go literal so they are assigned afterwards,
+// skipping nil embedded pointers (from go) or allocating them once a field promoted through them is set (fromPb)
+func (c *structConverters) writeLiteral(sb *strings.Builder, s internal.Struct, literalType string, values map[*internal.Field]adapterValue, skipped map[*internal.Field]error, fromPb bool) {
+	// the literal is the go struct when converting from protobuf and the protobuf message otherwise
+	name := pbFieldName
+	convert := func(field *internal.Field) string { return values[field].fromGo("in." + field.Name) }
+	if fromPb {
+		name = func(field *internal.Field) string { return field.Name }
+		convert = func(field *internal.Field) string { return values[field].fromPb("msg." + pbFieldName(field)) }
+	}
+
+	promoted := []*internal.Field{}
+	for _, field := range s.Fields {
+		if _, ok := skipped[field]; !ok && len(field.Promoted) > 0 {
+			promoted = append(promoted, field)
+		}
+	}
+	if len(promoted) == 0 {
+		sb.WriteString(fmt.Sprintf("return &%s{\n", literalType))
+	} else {
+		sb.WriteString(fmt.Sprintf("out := &%s{\n", literalType))
+	}
+	for _, field := range s.Fields {
+		if err, ok := skipped[field]; ok {
+			sb.WriteString(fmt.Sprintf("// %s isn't converted, %s\n", field.Name, err))
+		} else if len(field.Promoted) == 0 {
+			sb.WriteString(fmt.Sprintf("%s: %s,\n", name(field), convert(field)))
+		}
+	}
+	sb.WriteString("}\n")
+	if len(promoted) == 0 {
+		return
+	}
 
-			slice := ""
-			if field.Repeated {
-				slice = "Slice"
+	// the fields promoted through the same nil embedded pointers share their guard
+	guard := ""
+	for _, field := range promoted {
+		path := ""
+		guards := []string{}
+		allocations := []string{}
+		for _, step := range field.Promoted {
+			path += "." + step.Name
+			if !step.Optional {
+				continue
+			}
+			if !fromPb {
+				guards = append(guards, fmt.Sprintf("in%s != nil", path))
+				continue
 			}
+			embedded := *step
+			embedded.Optional = false
+			allocations = append(allocations, fmt.Sprintf("if out%s == nil {\nout%s = &%s{}\n}\n", path, path, c.goType(c.parentNode, &embedded)))
+		}
 
-			if isPodType(field.Type) {
-				sb.WriteString(fmt.Sprintf("         %s: ent.%s%s,\n", field.Name, field.Name, convert))
-			} else {
-				ptr := ""
-				if field.Optional {
-					ptr = "Ptr"
-				}
-				// we stupidly sometimes prepend selector with the dot instead of just
-				// having a field as to whether or not it references another package
-				actualType := field.Type
-				if field.ComputeSelector() != nil {
-					actualType = fmt.Sprintf("converter%s", field.Type)
-				}
-				sb.WriteString(fmt.Sprintf("         %s: %sFromPb%s(ent.%s%s),\n", field.Name, actualType, ptr+slice, field.Name, convert))
+		if fromPb {
+			// an unset field leaves the embedded pointers nil so a nil embedded struct round trips
+			assign := fmt.Sprintf("out%s.%s = %s\n", path, field.Name, convert(field))
+			if len(allocations) == 0 {
+				sb.WriteString(assign)
+				continue
 			}
+			sb.WriteString(fmt.Sprintf("if %s {\n%s%s}\n", isSet("msg."+pbFieldName(field), values[field].pbType), strings.Join(allocations, ""), assign))
+			continue
 		}
-		sb.WriteString("     }\n")
-		sb.WriteString("}\n\n")
-
-		// Write the same function but for ptr
-		// todo: refactor this so it reuses the code above
-		sb.WriteString(fmt.Sprintf("func %sFromPbPtr(ent *pb%s) (*%s) {\n", structImpl.Name, goType, goType))
-		sb.WriteString("     if ent == nil{\n")
-		sb.WriteString("         return nil\n")
-		sb.WriteString("     }\n")
-		sb.WriteString(fmt.Sprintf("     return &%s.%s {\n", structImpl.Package, structImpl.Name))
-		for _, field := range structImpl.Fields {
-			convert := ""
-			if field.Type == "time.Time" {
-				convert = ".AsTime()"
-			} else if field.Type == "interface" { // interfaces are encoded as google.Protobuf.Value
-				convert = ".AsInterface()"
+		if next := strings.Join(guards, " && "); next != guard {
+			if guard != "" {
+				sb.WriteString("}\n")
 			}
-
-			slice := ""
-			if field.Repeated {
-				slice = "Slice"
+			if guard = next; guard != "" {
+				sb.WriteString(fmt.Sprintf("if %s {\n", guard))
 			}
+		}
+		sb.WriteString(fmt.Sprintf("out.%s = %s\n", name(field), convert(field)))
+	}
+	if guard != "" {
+		sb.WriteString("}\n")
+	}
+	sb.WriteString("return out\n")
+}
 
-			if isPodType(field.Type) {
-				sb.WriteString(fmt.Sprintf("         %s: ent.%s%s,\n", field.Name, field.Name, convert))
-			} else {
-				ptr := ""
-				if field.Optional {
-					ptr = "Ptr"
-				}
-				actualType := field.Type
-				if field.ComputeSelector() != nil {
-					actualType = fmt.Sprintf("converter%s", field.Type)
-				}
-				sb.WriteString(fmt.Sprintf("         %s: %sFromPb%s(ent.%s%s),\n", field.Name, actualType, ptr, field.Name+slice, convert))
-			}
+// isSet returns the condition of a message field of type pbType holding more than its zero value
+func isSet(expr string, pbType string) string {
+	switch {
+	case strings.HasPrefix(pbType, "*"):
+		return expr + " != nil"
+	case strings.HasPrefix(pbType, "[]"), strings.HasPrefix(pbType, "map["):
+		return fmt.Sprintf("len(%s) > 0", expr)
+	case pbType == "string":
+		return expr + ` != ""`
+	case pbType == "bool":
+		return expr
+	}
+	// numbers and enums
+	return expr + " != 0"
+}
+
+// field returns the conversion of a field of message, maps are converted by the functions mapConverter writes
+func (c *structConverters) field(message string, field *internal.Field) (adapterValue, error) {
+	switch {
+	case field.IsMap():
+		return c.mapConverter(message, field)
+	case field.Type == "interface":
+		return c.interfaceValue(field)
+	}
+	return c.value(field)
+}
+
+// interfaceValue returns the conversion of an interface{} field to a google.protobuf.Value
+func (c *structConverters) interfaceValue(field *internal.Field) (adapterValue, error) {
+	c.use("structpb", structpbImport)
+	value := adapterValue{goType: c.goType(c.parentNode, field), pbType: "*structpb.Value"}
+	switch {
+	case field.Repeated && field.Optional:
+		return adapterValue{}, fmt.Errorf("a list of *interface{} can't be converted")
+	case field.Repeated:
+		value.pbType = "[]*structpb.Value"
+		value.fromGo = func(expr string) string { return fmt.Sprintf("convertSlice(%s, valueOf)", expr) }
+		value.fromPb = func(expr string) string { return fmt.Sprintf("convertSlice(%s, (*structpb.Value).AsInterface)", expr) }
+	case field.Optional:
+		value.fromGo = func(expr string) string { return fmt.Sprintf("convertOrZero(%s, valueOf)", expr) }
+		value.fromPb = func(expr string) string {
+			return fmt.Sprintf("convertMessage(%s, (*structpb.Value).AsInterface)", expr)
+		}
+	default:
+		value.fromGo = func(expr string) string { return fmt.Sprintf("valueOf(%s)", expr) }
+		value.fromPb = func(expr string) string { return expr + ".AsInterface()" }
+	}
+	return value, nil
+}
+
+// mapConverter writes <Message><Field>FromGo and <Message><Field>FromPb converting a map field of message (or a
+// slice of maps) and the converters of the wrappers it needs, then returns the conversion that calls them
+func (c *structConverters) mapConverter(message string, field *internal.Field) (adapterValue, error) {
+	name := wrapperName(message, field, "")
+	goMap := c.goType(c.parentNode, field)
+
+	sb := &strings.Builder{}
+	var pbMap string
+	if field.Repeated {
+		// a slice of maps, every map is the entries of an item wrapper
+		item := mapWrappers(message, field)[0]
+		entries, err := c.field(item.name, item.field)
+		if err != nil {
+			return adapterValue{}, err
+		}
+		itemType := fmt.Sprintf("*%s.%s", c.pbAlias, item.name)
+		pbMap = "[]" + itemType
+		sb.WriteString(fmt.Sprintf("\n// %sFromGo converts the %s field of %s to its items\n", name, field.Name, message))
+		sb.WriteString(fmt.Sprintf("func %sFromGo(items %s) %s {\n", name, goMap, pbMap))
+		sb.WriteString(fmt.Sprintf("return convertSlice(items, func(v %s) %s { return &%s{Entries: %s} })\n}\n",
+			entries.goType, itemType, itemType[1:], entries.fromGo("v")))
+		sb.WriteString(fmt.Sprintf("\n// %sFromPb converts the items of the %s field of %s\n", name, field.Name, message))
+		sb.WriteString(fmt.Sprintf("func %sFromPb(items %s) %s {\n", name, pbMap, goMap))
+		sb.WriteString(fmt.Sprintf("return convertSlice(items, func(v %s) %s { return %s })\n}\n",
+			itemType, entries.goType, entries.fromPb("v.GetEntries()")))
+	} else {
+		keyType, ok := field.MapKeyProtoType()
+		if !ok {
+			return adapterValue{}, fmt.Errorf("the key of %s can't be a map key", field.Name)
+		}
+		goKey := c.goType(c.parentNode, field.MapKey)
+		keyFromGo, keyFromPb := "k", "k"
+		if goKey != keyType {
+			keyFromGo, keyFromPb = fmt.Sprintf("%s(k)", keyType), fmt.Sprintf("%s(k)", goKey)
 		}
-		sb.WriteString("     }\n")
-		sb.WriteString("}\n\n")
 
-		sb.WriteString(fmt.Sprintf("func %sFromGo(ent %s) (pb%s) {\n", structImpl.Name, goType, goType))
-		sb.WriteString(fmt.Sprintf("     return pb%s {\n", goType))
-		for _, field := range structImpl.Fields {
-			convert := ""
-			// note these timestamps are always pointers when given to us in protobuf
-			if field.Type == "time.Time" {
-				convert = "timestamppb.New"
+		var value adapterValue
+		if wrappers := mapWrappers(message, field); len(wrappers) > 0 {
+			// lists and maps are the only field of a wrapper message
+			wrapper := wrappers[0]
+			inner, err := c.field(wrapper.name, wrapper.field)
+			if err != nil {
+				return adapterValue{}, err
 			}
-
-			slice := ""
-			if field.Repeated {
-				slice = "Slice"
+			wrapperType := fmt.Sprintf("%s.%s", c.pbAlias, wrapper.name)
+			value = adapterValue{
+				goType: inner.goType,
+				pbType: "*" + wrapperType,
+				fromGo: func(expr string) string {
+					return fmt.Sprintf("&%s{%s: %s}", wrapperType, pbFieldName(wrapper.field), inner.fromGo(expr))
+				},
+				fromPb: func(expr string) string {
+					return inner.fromPb(fmt.Sprintf("%s.Get%s()", expr, pbFieldName(wrapper.field)))
+				},
 			}
-
-			if isPodType(field.Type) {
-				if convert != "" {
-					// some weird shit to deref a ptr in case cause this convert func (our only one) returns a ptr
-					sb.WriteString(fmt.Sprintf("         %s: %s(ent.%s),\n", field.Name, convert, field.Name))
-				} else {
-					sb.WriteString(fmt.Sprintf("         %s: ent.%s,\n", field.Name, field.Name))
-				}
-			} else {
-				ptr := ""
-				if field.Optional {
-					ptr = "Ptr"
-				}
-				actualType := field.Type
-				if field.ComputeSelector() != nil {
-					actualType = fmt.Sprintf("converter%s", field.Type)
-				}
-				sb.WriteString(fmt.Sprintf("         %s: %sFromGo%s(ent.%s),\n", field.Name, actualType, ptr+slice, field.Name))
+		} else {
+			var err error
+			if value, err = c.mapValue(field.MapValue); err != nil {
+				return adapterValue{}, err
 			}
 		}
-		sb.WriteString("     }\n")
-		sb.WriteString("}\n\n")
-
-		sb.WriteString(fmt.Sprintf("func %sFromGoPtr(ent *%s) (*pb%s) {\n", structImpl.Name, goType, goType))
-		sb.WriteString("     if ent == nil{\n")
-		sb.WriteString("         return nil\n")
-		sb.WriteString("     }\n")
-		sb.WriteString(fmt.Sprintf("     return &pb%s {\n", goType))
-		for _, field := range structImpl.Fields {
-			convert := ""
-			// note these timestamps are always pointers when given to us in protobuf
-			if field.Type == "time.Time" {
-				convert = "timestamppb.New"
-			}
+		pbMap = fmt.Sprintf("map[%s]%s", keyType, value.pbType)
 
-			slice := ""
-			if field.Repeated {
-				slice = "Slice"
-			}
+		sb.WriteString(fmt.Sprintf("\n// %sFromGo converts the %s field of %s, nil stays nil\n", name, field.Name, message))
+		sb.WriteString(fmt.Sprintf("func %sFromGo(m %s) %s {\nif m == nil {\nreturn nil\n}\n", name, goMap, pbMap))
+		sb.WriteString(fmt.Sprintf("out := make(%s, len(m))\nfor k, v := range m {\nout[%s] = %s\n}\nreturn out\n}\n", pbMap, keyFromGo, value.fromGo("v")))
+		sb.WriteString(fmt.Sprintf("\n// %sFromPb converts the %s field of the %s message, nil stays nil\n", name, field.Name, message))
+		sb.WriteString(fmt.Sprintf("func %sFromPb(m %s) %s {\nif m == nil {\nreturn nil\n}\n", name, pbMap, goMap))
+		sb.WriteString(fmt.Sprintf("out := make(%s, len(m))\nfor k, v := range m {\nout[%s] = %s\n}\nreturn out\n}\n", goMap, keyFromPb, value.fromPb("v")))
+	}
+	c.helpers = append(c.helpers, sb.String())
 
-			if isPodType(field.Type) {
-				if convert != "" {
-					// some weird shit to deref a ptr in case cause this convert func (our only one) returns a ptr
-					sb.WriteString(fmt.Sprintf("         %s: %s(ent.%s),\n", field.Name, convert, field.Name))
-				} else {
-					sb.WriteString(fmt.Sprintf("         %s: ent.%s,\n", field.Name, field.Name))
-				}
-			} else {
-				ptr := ""
-				if field.Optional {
-					ptr = "Ptr"
-				}
-				actualType := field.Type
-				if field.ComputeSelector() != nil {
-					actualType = fmt.Sprintf("converter%s", field.Type)
-				}
-				sb.WriteString(fmt.Sprintf("         %s: %sFromGo%s(ent.%s),\n", field.Name, actualType, ptr+slice, field.Name))
+	return adapterValue{
+		goType: goMap,
+		pbType: pbMap,
+		fromGo: func(expr string) string { return fmt.Sprintf("%sFromGo(%s)", name, expr) },
+		fromPb: func(expr string) string { return fmt.Sprintf("%sFromPb(%s)", name, expr) },
+	}, nil
+}
+
+// mapValue returns the conversion of the values of a map that don't need a wrapper
+func (c *structConverters) mapValue(value *internal.Field) (adapterValue, error) {
+	if value.Type == "interface" {
+		if value.Optional {
+			return adapterValue{}, fmt.Errorf("a map of *interface{} can't be converted")
+		}
+		return c.interfaceValue(value)
+	}
+	return c.listElem(value)
+}
+
+// pbFieldName returns the name protoc-gen-go gives the go field of a proto field e.g. UserId for user_id
+func pbFieldName(field *internal.Field) string {
+	name := goCamelCase(field.ProtoFieldName())
+	// fields named like a method of every message get an underscore appended
+	switch name {
+	case "Reset", "String", "ProtoMessage", "Marshal", "Unmarshal", "ExtensionRangeArray", "ExtensionMap", "Descriptor":
+		return name + "_"
+	}
+	return name
+}
+
+// goCamelCase is how protoc-gen-go turns a proto name into a go name
+func goCamelCase(s string) string {
+	isLower := func(c byte) bool { return 'a' <= c && c <= 'z' }
+	isDigit := func(c byte) bool { return '0' <= c && c <= '9' }
+
+	out := []byte{}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '.' && i+1 < len(s) && isLower(s[i+1]):
+			// skip over the dot, the next letter is upper cased
+		case c == '.':
+			out = append(out, '_')
+		case c == '_' && (i == 0 || s[i-1] == '.'):
+			// a leading underscore would make the name unexported
+			out = append(out, 'X')
+		case c == '_' && i+1 < len(s) && isLower(s[i+1]):
+			// skip over the underscore, the next letter is upper cased
+		case isDigit(c):
+			out = append(out, c)
+		default:
+			if isLower(c) {
+				c -= 'a' - 'A'
+			}
+			out = append(out, c)
+			for ; i+1 < len(s) && isLower(s[i+1]); i++ {
+				out = append(out, s[i+1])
 			}
 		}
-		sb.WriteString("     }\n")
-		sb.WriteString("}\n\n")
-
-		sb.WriteString(fmt.Sprintf("func %sFromPbSlice(ents []pb%s) ([]%s) {\n", structImpl.Name, goType, goType))
-		sb.WriteString(fmt.Sprintf("     var out []%s\n", goType))
-		sb.WriteString("     for _, e := range ents {\n")
-		sb.WriteString(fmt.Sprintf("         out = append(out, %sFromPb(e))\n", structImpl.Name))
-		sb.WriteString("     }\n")
-		sb.WriteString("     return out\n")
-		sb.WriteString("}\n\n")
-
-		sb.WriteString(fmt.Sprintf("func %sFromPbPtrSlice(ents []*pb%s) ([]*%s) {\n", structImpl.Name, goType, goType))
-		sb.WriteString(fmt.Sprintf("     var out []*%s\n", goType))
-		sb.WriteString("     for _, e := range ents {\n")
-		sb.WriteString(fmt.Sprintf("         out = append(out, %sFromPbPtr(e))\n", structImpl.Name))
-		sb.WriteString("     }\n")
-		sb.WriteString("     return out\n")
-		sb.WriteString("}\n\n")
-
-		sb.WriteString(fmt.Sprintf("func %sFromGoSlice(ents []%s) ([]pb%s) {\n", structImpl.Name, goType, goType))
-		sb.WriteString(fmt.Sprintf("     var out []pb%s\n", goType))
-		sb.WriteString("     for _, e := range ents {\n")
-		sb.WriteString(fmt.Sprintf("         out = append(out, %sFromGo(e))\n", structImpl.Name))
-		sb.WriteString("     }\n")
-		sb.WriteString("     return out\n")
-		sb.WriteString("}\n\n")
-
-		sb.WriteString(fmt.Sprintf("func %sFromGoPtrSlice(ents []*%s) ([]*pb%s) {\n", structImpl.Name, goType, goType))
-		sb.WriteString(fmt.Sprintf("     var out []*pb%s\n", goType))
-		sb.WriteString("     for _, e := range ents {\n")
-		sb.WriteString(fmt.Sprintf("         out = append(out, %sFromGoPtr(e))\n", structImpl.Name))
-		sb.WriteString("     }\n")
-		sb.WriteString("     return out\n")
-		sb.WriteString("}\n\n")
-
-	}
-
-	for pkg, sb := range pkgFiles {
-		if _, err := os.Stat(fmt.Sprintf("converters/%s", pkg)); os.IsNotExist(err) {
-			os.Mkdir(fmt.Sprintf("converters/%s", pkg), 0755)
-		}
-		WriteFile(fmt.Sprintf("converters/%s/struct.go", pkg), []byte(sb.String()))
 	}
+	return string(out)
 }
@@ -0,0 +1,122 @@
+package writers
+
+import (
+	"testing"
+
+	"code.justin.tv/safety/go2proto/internal"
+	astt "code.justin.tv/safety/go2proto/internal/ast"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStructConverters(t *testing.T) {
+	path, file := "example.com/models", "example.com/models/models.go"
+	pathObj := internal.Path{Path: &path, FilePath: &file}
+	node := &astt.GoNode{PackageName: "models", Path: pathObj}
+	field := func(f internal.Field) *internal.Field {
+		f.Path, f.Package = pathObj, "models"
+		return &f
+	}
+
+	inner := field(internal.Field{Name: "A", Type: "Inner", Optional: true})
+	structs := []internal.Struct{
+		{Path: pathObj, Package: "models", Name: "Thing", Fields: []*internal.Field{
+			field(internal.Field{Name: "ID", Type: "int"}),
+			field(internal.Field{Name: "Nick", Type: "string", Optional: true}),
+			field(internal.Field{Name: "Inners", Type: "Inner", Repeated: true}),
+			field(internal.Field{Name: "Took", Type: "time.Duration", Selector: true, Optional: true}),
+			field(internal.Field{Name: "Any", Type: "interface"}),
+			field(internal.Field{Name: "Status", Type: "Status"}),
+			field(internal.Field{Name: "ByUser", Type: "map", MapKey: field(internal.Field{Type: "UserID", Underlying: "string"}), MapValue: field(internal.Field{Type: "Inner", Optional: true, Repeated: true})}),
+			field(internal.Field{Name: "Pages", Type: "map", Repeated: true, MapKey: field(internal.Field{Type: "string"}), MapValue: field(internal.Field{Type: "int"})}),
+			// promoted through the embedded *Inner of a flattened struct
+			field(internal.Field{Name: "Name", Type: "string", Promoted: []*internal.Field{inner}}),
+			field(internal.Field{Name: "Missing", Type: "Unknown"}),
+		}},
+		{Path: pathObj, Package: "models", Name: "Inner", Fields: []*internal.Field{field(internal.Field{Name: "Name", Type: "string"})}},
+		{Path: pathObj, Package: "models", Name: "Tags", Wrapper: true, Fields: []*internal.Field{field(internal.Field{Name: "Elements", Type: "string", Repeated: true})}},
+	}
+	enums := []internal.EnumAssignment{{Path: pathObj, Package: "models", Name: "Active", FuncName: "Status"}}
+	cfg := internal.DefaultTranspilerConfig()
+	cfg.GoProjectPath, cfg.PkgPrefixSlash = "example.com", "example.com/gen"
+
+	src, err := StructConverters(node, structs, structs, enums, cfg)
+	assert.NoError(t, err)
+	out := string(src)
+	assert.Contains(t, out, "\tpbmodels \"example.com/gen/models\"\n")
+	// the converters of the package itself aren't imported
+	assert.NotContains(t, out, "converters/models")
+	assert.Contains(t, out, `func ThingFromGoPtr(in *models.Thing) *pbmodels.Thing {
+	if in == nil {
+		return nil
+	}
+	out := &pbmodels.Thing{
+		ID:     int32(in.ID),
+		Nick:   in.Nick,
+		Inners: convertSlice(in.Inners, func(v models.Inner) *pbmodels.Inner { return InnerFromGoPtr(&v) }),
+		Took:   convertOrZero(in.Took, durationpb.New),
+		Any:    valueOf(in.Any),
+		Status: StatusFromGo(in.Status),
+		ByUser: ThingByUserFromGo(in.ByUser),
+		Pages:  ThingPagesFromGo(in.Pages),
+		// Missing isn't converted, Unknown is neither a struct nor an enum
+	}
+	if in.A != nil {
+		out.Name = in.Name
+	}
+	return out
+}`)
+	// a nil embedded pointer stays nil when none of its promoted fields is set
+	assert.Contains(t, out, "\tif msg.Name != \"\" {\n\t\tif out.A == nil {\n\t\t\tout.A = &models.Inner{}\n\t\t}\n\t\tout.A.Name = msg.Name\n\t}\n")
+	assert.Contains(t, out, "\t\tTook:   convertMessage(msg.Took, (*durationpb.Duration).AsDuration),\n")
+	assert.Contains(t, out, "\t\tAny:    msg.Any.AsInterface(),\n")
+	assert.Contains(t, out, "func ThingByUserFromPb(m map[string]*pbmodels.ThingByUserValue) map[models.UserID][]*models.Inner {")
+	assert.Contains(t, out, "\t\tout[models.UserID(k)] = convertSlice(v.GetValues(), func(v *pbmodels.Inner) *models.Inner { return InnerFromPbPtr(v) })\n")
+	assert.Contains(t, out, "return &pbmodels.ThingPagesItem{Entries: ThingPagesItemEntriesFromGo(v)}")
+	assert.Contains(t, out, "\t\tout[k] = int32(v)\n")
+	// a named slice is the only field of its message
+	assert.Contains(t, out, "\treturn &pbmodels.Tags{\n\t\tElements: *in,\n\t}\n")
+	assert.Contains(t, out, "\tout := models.Tags(msg.Elements)\n\treturn &out\n")
+}
+
+func TestSealedConverters(t *testing.T) {
+	path, file := "example.com/models", "example.com/models/models.go"
+	pathObj := internal.Path{Path: &path, FilePath: &file}
+	node := &astt.GoNode{PackageName: "models", Path: pathObj}
+	field := func(f internal.Field) *internal.Field {
+		f.Path, f.Package = pathObj, "models"
+		return &f
+	}
+
+	structs := []internal.Struct{
+		{Path: pathObj, Package: "models", Name: "Shape", Sealed: true, Fields: []*internal.Field{
+			field(internal.Field{Name: "Circle", Type: "Circle", Optional: true}),
+			field(internal.Field{Name: "Square", Type: "Square"}),
+		}},
+		{Path: pathObj, Package: "models", Name: "Circle", Fields: []*internal.Field{field(internal.Field{Name: "Radius", Type: "float64"})}},
+		{Path: pathObj, Package: "models", Name: "Square", Fields: []*internal.Field{field(internal.Field{Name: "Side", Type: "float64"})}},
+		{Path: pathObj, Package: "models", Name: "Drawing", Fields: []*internal.Field{
+			field(internal.Field{Name: "Main", Type: "Shape"}),
+			field(internal.Field{Name: "Shapes", Type: "Shape", Repeated: true}),
+		}},
+	}
+	cfg := internal.DefaultTranspilerConfig()
+	cfg.GoProjectPath, cfg.PkgPrefixSlash = "example.com", "example.com/gen"
+
+	src, err := StructConverters(node, structs, structs, nil, cfg)
+	assert.NoError(t, err)
+	out := string(src)
+	assert.Contains(t, out, `func ShapeFromGo(in models.Shape) *pbmodels.Shape {
+	switch v := in.(type) {
+	case *models.Circle:
+		return &pbmodels.Shape{Value: &pbmodels.Shape_Circle{Circle: CircleFromGoPtr(v)}}
+	case models.Square:
+		return &pbmodels.Shape{Value: &pbmodels.Shape_Square{Square: SquareFromGoPtr(&v)}}
+	case *models.Square:
+		return &pbmodels.Shape{Value: &pbmodels.Shape_Square{Square: SquareFromGoPtr(v)}}
+	}
+	return nil
+}`)
+	assert.Contains(t, out, "\tcase *pbmodels.Shape_Square:\n\t\treturn deref(SquareFromPbPtr(v.Square))\n")
+	assert.Contains(t, out, "\t\tMain:   ShapeFromGo(in.Main),\n")
+	assert.Contains(t, out, "\t\tShapes: convertSlice(msg.Shapes, func(v *pbmodels.Shape) models.Shape { return ShapeFromPb(v) }),\n")
+}
@@ -0,0 +1,84 @@
+package writers
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/template"
+
+	"code.justin.tv/safety/go2proto/internal"
+)
+
+// defaultTemplates render every generated file unless a templates directory has a template of the same name
+//
+//go:embed templates/*.tmpl
+var defaultTemplates embed.FS
+
+// templateFuncs are the functions every template can call besides the builtin ones
+var templateFuncs = template.FuncMap{
+	// comment renders doc as // comment lines with indent, nothing when it is empty
+	"comment": func(indent string, doc string) string {
+		sb := &strings.Builder{}
+		writeComment(sb, doc, indent)
+		return sb.String()
+	},
+	"join":      strings.Join,
+	"lower":     strings.ToLower,
+	"upper":     strings.ToUpper,
+	"snakeCase": internal.SnakeCase,
+	"camelCase": goCamelCase,
+}
+
+var (
+	templatesMu    sync.Mutex
+	templatesByDir = map[string]*template.Template{}
+)
+
+// LoadTemplates returns the default templates with the .tmpl files of dir parsed on top of them, a file replaces
+// the default template with its name and can define templates of its own. Only the defaults are loaded when dir
+// is empty
+func LoadTemplates(dir string) (*template.Template, error) {
+	t, err := template.New("").Funcs(templateFuncs).ParseFS(defaultTemplates, "templates/*.tmpl")
+	if err != nil {
+		return nil, err
+	}
+	if dir == "" {
+		return t, nil
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.tmpl"))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("templates %s: no .tmpl files", dir)
+	}
+	if t, err = t.ParseFiles(files...); err != nil {
+		return nil, fmt.Errorf("templates %s: %w", dir, err)
+	}
+	return t, nil
+}
+
+// render executes the template name of the templates of cfg with model, the templates of a directory are only
+// loaded once
+func render(cfg internal.TranspilerConfig, name string, model interface{}) ([]byte, error) {
+	templatesMu.Lock()
+	t, ok := templatesByDir[cfg.TemplatesDir]
+	if !ok {
+		var err error
+		if t, err = LoadTemplates(cfg.TemplatesDir); err != nil {
+			templatesMu.Unlock()
+			return nil, err
+		}
+		templatesByDir[cfg.TemplatesDir] = t
+	}
+	templatesMu.Unlock()
+
+	out := &bytes.Buffer{}
+	if err := t.ExecuteTemplate(out, name, model); err != nil {
+		return nil, fmt.Errorf("template %s: %w", name, err)
+	}
+	return out.Bytes(), nil
+}
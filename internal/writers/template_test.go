@@ -0,0 +1,46 @@
+package writers
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"code.justin.tv/safety/go2proto/internal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTemplates(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "go_file.tmpl"), []byte(`// Copyright Example Corp.
+
+{{comment "" (printf "Code generated by %s. DO NOT EDIT." .Generator)}}package {{.Package}}
+{{range .StdImports}}
+import {{.Name}} {{printf "%q" .Path}}{{end}}
+{{.Body}}`), 0o644))
+	cfg := internal.DefaultTranspilerConfig()
+	cfg.TemplatesDir = dir
+
+	// an override replaces the default template of its name, the others are still the defaults
+	templates, err := LoadTemplates(dir)
+	assert.NoError(t, err)
+	assert.NotNil(t, templates.Lookup("server.tmpl"))
+	f := newGoFile("server adapter of UserService", "userservice", cfg)
+	f.use("context", "context")
+	src, err := f.source("\nfunc List(ctx context.Context) {}\n")
+	assert.NoError(t, err)
+	assert.Equal(t, "// Copyright Example Corp.\n\n// Code generated by server adapter of UserService. DO NOT EDIT.\npackage userservice\n\nimport \"context\"\n\nfunc List(ctx context.Context) {}\n", string(src))
+
+	// a directory without templates is most likely a typo
+	_, err = LoadTemplates(t.TempDir())
+	assert.Error(t, err)
+
+	// a template rendering invalid go is an error of the generator it renders for
+	broken := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(broken, "go_file.tmpl"), []byte("package {{.Package}}\n\nfunc {\n{{.Body}}"), 0o644))
+	cfg.TemplatesDir = broken
+	_, err = newGoFile("server adapter of UserService", "userservice", cfg).source("\nfunc List() {}\n")
+	var sourceErr *SourceError
+	assert.True(t, errors.As(err, &sourceErr))
+	assert.Equal(t, "server adapter of UserService", sourceErr.Generator)
+}
@@ -2,16 +2,17 @@ package writers
 
 import (
 	"fmt"
-	"go/ast"
 	"io/ioutil"
 	"log"
 	"os"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 
 	"code.justin.tv/safety/go2proto/internal"
 	astt "code.justin.tv/safety/go2proto/internal/ast"
+	"code.justin.tv/safety/go2proto/internal/lock"
 )
 
 func isPodType(t string) bool {
@@ -31,66 +32,123 @@ func WriteFile(filename string, data []byte) error {
 	return nil
 }
 
-func writeProtoHeader(sb *strings.Builder, pkgName string, pkgPrefixSlash string) {
-	sb.WriteString("syntax = \"proto3\";\n")
-	sb.WriteString(fmt.Sprintf("package %s;\n", pkgName))
-	sb.WriteString(fmt.Sprintf("option go_package = \"%s/%s\";\n\n", pkgPrefixSlash, pkgName))
-	sb.WriteString("import \"google/protobuf/timestamp.proto\";\nimport \"google/protobuf/struct.proto\";\nimport \"google/protobuf/duration.proto\";\n\n")
-}
+// protoPackageForPath returns the proto package and go_package of the go package at path
+// with the configured prefixes and package overrides applied
+func protoPackageForPath(p internal.Path, cfg internal.TranspilerConfig) (string, string, error) {
+	pkgName, err := p.ToProtoPackageFilePath(cfg.GoProjectPath)
+	if err != nil {
+		return "", "", err
+	}
 
-func writeProtoHeaderForProtofile(p *ProtoFile, pkgName string, pkgPrefixSlash string) {
-	p.GetSb().WriteString("syntax = \"proto3\";\n")
-	p.GetSb().WriteString(fmt.Sprintf("package %s;\n", pkgName))
-	p.GetSb().WriteString(fmt.Sprintf("option go_package = \"%s/%s\";\n\n", pkgPrefixSlash, pkgName))
-	p.GetSb().WriteString("import \"google/protobuf/timestamp.proto\";\nimport \"google/protobuf/struct.proto\";\nimport \"google/protobuf/duration.proto\";\n\n")
+	protoPkg := cfg.ProtoPackage(pkgName)
+	goPkg := fmt.Sprintf("%s/%s", cfg.PkgPrefixSlash, pkgName)
+	if override, ok := cfg.Packages[*p.Path]; ok {
+		if override.ProtoPackage != "" {
+			protoPkg = override.ProtoPackage
+		}
+		if override.GoPackage != "" {
+			goPkg = override.GoPackage
+		}
+	}
+	return protoPkg, goPkg, nil
 }
 
-func writeDepImports(sb *strings.Builder, deps internal.DependencySet) {
-	sortedDeps := []*internal.Path{}
-	for dep := range deps {
-		sortedDeps = append(sortedDeps, deps[dep])
+// writeComment writes doc as the leading comment of the next declaration, nothing when it's empty
+func writeComment(sb *strings.Builder, doc string, indent string) {
+	if doc == "" {
+		return
 	}
-	sort.Slice(sortedDeps, func(i, j int) bool {
-		return *sortedDeps[i].FilePath < *sortedDeps[j].FilePath
-	})
+	for _, line := range strings.Split(doc, "\n") {
+		if line == "" {
+			sb.WriteString(indent + "//\n")
+		} else {
+			sb.WriteString(indent + "// " + line + "\n")
+		}
+	}
+}
 
-	for _, dep := range sortedDeps {
-		protoFilePath, err := dep.ToProtoFilePath()
+// protoImports returns the sorted paths of the .proto files of the go packages in deps
+func protoImports(deps internal.DependencySet, rootPath string) ([]string, error) {
+	out := []string{}
+	for _, dep := range deps {
+		if dep == nil {
+			continue
+		}
+		protoFilePath, err := dep.ToProtoFilePath(rootPath)
 		if err != nil {
-			panic(err)
+			return nil, err
 		}
-		sb.WriteString(fmt.Sprintf("import \"%s/const.proto\";\n", protoFilePath))
+		out = append(out, protoFilePath+"/const.proto")
 	}
-	if len(sortedDeps) > 0 {
-		sb.WriteString("\n")
+	sort.Strings(out)
+	return out, nil
+}
+
+// protoField returns the model of a field of message and the proto files it depends on, message names the wrappers
+// of map fields and number is the field number unless the field has its own
+func protoField(parentNode *astt.GoNode, field *internal.Field, message string, number int, cfg internal.TranspilerConfig) (FieldModel, internal.DependencySet) {
+	protoType, deps := fieldProtoType(parentNode, field, message, cfg)
+	label := ""
+	if field.Repeated {
+		label = "repeated"
+	} else if field.Optional && !field.IsMap() {
+		label = "optional"
+	}
+	if field.Number > 0 {
+		number = field.Number
+	}
+	return FieldModel{Name: field.ProtoFieldName(), Type: protoType, Label: label, Number: number, Doc: field.Doc, Go: field}, deps
+}
+
+// protoMessage returns the model of a message with fields followed by the wrapper messages its map fields need,
+// the proto files the fields depend on are added to deps
+func protoMessage(parentNode *astt.GoNode, msg MessageModel, fields []*internal.Field, deps internal.DependencySet, cfg internal.TranspilerConfig) []MessageModel {
+	numbers := unlockedFieldNumbers(fields)
+	for idx, field := range fields {
+		model, fieldDeps := protoField(parentNode, field, msg.Name, numbers[idx], cfg)
+		addDependencies(fieldDeps, deps)
+		msg.Fields = append(msg.Fields, model)
 	}
+	return append([]MessageModel{msg}, mapWrapperMessages(parentNode, msg.Name, fields, deps, cfg)...)
 }
 
-// writeField outputs package dependency types as strings
-func writeField(parentNode *astt.GoNode, field *internal.Field, idx int, sb *strings.Builder) internal.DependencySet {
-	opt := ""
-	repeated := ""
+// fieldProtoType returns the proto type of a field (without repeated or optional) and the proto files it depends on
+func fieldProtoType(parentNode *astt.GoNode, field *internal.Field, message string, cfg internal.TranspilerConfig) (string, internal.DependencySet) {
+	if field.IsMap() {
+		return mapProtoType(parentNode, field, message, cfg)
+	}
+
 	deps := internal.DependencySet{}
 	var protoFilePathPtr *string
 
 	// If the field has a selector use the import tree to figure out the converted proto file path
-	if field.ComputeSelector() != nil { // generic way of prepending protobuf package prefix
+	if selector := field.ComputeSelector(); selector != nil { // generic way of prepending protobuf package prefix
 		// TODO: refactor this
 		importAlias := strings.Split(field.Type, ".")[0]
 		if parentNode != nil {
-			// get the imports for the current file
-			imp := astt.FindImport(importAlias, parentNode.ImportsForPath(*field.Path.FilePath))
-			if imp != nil {
+			var importNode *astt.GoNode
+			if selector.ImportPath != "" {
+				// type checked fields know their import path so there is nothing to guess
+				importNode = parentNode.FindPackage(selector.ImportPath)
+			} else if imp := astt.FindImport(importAlias, parentNode.ImportsForPath(*field.Path.FilePath)); imp != nil {
 				// importAlias is either an aliased import or a package name, find that matching import
 				// and then use it
-				protoFilePath, err := imp.GoNode.Path.ToProtoPackageFilePath()
+				importNode = imp.GoNode
+			}
+
+			if importNode != nil {
+				protoFilePath, err := importNode.Path.ToProtoPackageFilePath(cfg.GoProjectPath)
+				if err != nil {
+					panic(err)
+				}
+				deps[protoFilePath] = &importNode.Path
+				protoPkg, _, err := protoPackageForPath(importNode.Path, cfg)
 				if err != nil {
 					panic(err)
 				}
-				deps[protoFilePath] = &imp.GoNode.Path
-				protoFilePathPtr = &protoFilePath
+				protoFilePathPtr = &protoPkg
 				// Override the type with the package path
-				log.Println("overrided import ", importAlias, "with package name", imp.GoNode.PackageName)
+				log.Println("overrided import ", importAlias, "with package name", importNode.PackageName)
 			} else {
 				log.Println("import not found for import alias", importAlias)
 			}
@@ -98,14 +156,7 @@ func writeField(parentNode *astt.GoNode, field *internal.Field, idx int, sb *str
 			deps[importAlias] = nil // non relative go import
 		}
 	}
-
-	if field.Repeated {
-		repeated = "repeated "
-	} else if field.Optional {
-		opt = "optional "
-	}
-	sb.WriteString(fmt.Sprintf("    %s%s%s %s = %d;\n", repeated, opt, field.ProtoType(protoFilePathPtr), field.Name, idx))
-	return deps
+	return field.ProtoType(protoFilePathPtr), deps
 }
 
 func addDependencies(src internal.DependencySet, dst internal.DependencySet) internal.DependencySet {
@@ -116,87 +167,72 @@ func addDependencies(src internal.DependencySet, dst internal.DependencySet) int
 	return dst
 }
 
-func WriteServer(parentNode *astt.GoNode, funcs []internal.Function, rootPkgName, pkgPrefixSlash, outDir string) {
-	var sb strings.Builder
-	writeProtoHeader(&sb, rootPkgName, pkgPrefixSlash)
-
-	// Write all request types
-	deps := internal.DependencySet{}
-	tmpSb := &strings.Builder{}
-
-	// Build deps before in a tmp sb
-	for _, f := range funcs {
-		if len(f.Fields) > 1 {
-			for idx, e := range f.Fields[1:] {
-				addDependencies(writeField(parentNode, e, idx+1, tmpSb), deps)
-			}
+// WriteServices writes the proto file of every service
+func WriteServices(parentNode *astt.GoNode, services []internal.Service, cfg internal.TranspilerConfig) error {
+	for _, svc := range services {
+		src, err := ServiceProto(parentNode, svc, cfg)
+		if err != nil {
+			return err
 		}
-		for idx, e := range f.ReturnTypes {
-			if e.Type != "error" {
-				e.Name = fmt.Sprintf("Field%d", idx+1)
-				addDependencies(writeField(parentNode, e, idx+1, tmpSb), deps)
-			}
+		if err := WriteFile(filepath.Join(cfg.OutDir, svc.File), []byte(src)); err != nil {
+			return err
 		}
 	}
+	return nil
+}
 
-	// Write the deps
-	writeDepImports(&sb, deps)
-
-	// Write all the real messages out for the server
-	for _, f := range funcs {
-		// Write request
-		sb.WriteString(fmt.Sprintf("message %s {\n", f.Name+"Request"))
-		if len(f.Fields) > 1 {
-			for idx, e := range f.Fields[1:] {
-				writeField(parentNode, e, idx+1, &sb)
-			}
-		}
-
-		sb.WriteString("}\n\n")
-		// Write response
-		sb.WriteString(fmt.Sprintf("message %s {\n", f.Name+"Response"))
-		for idx, e := range f.ReturnTypes {
-			if e.Type != "error" {
-				e.Name = fmt.Sprintf("Field%d", idx+1)
-				writeField(parentNode, e, idx+1, &sb)
-			}
-		}
-
-		sb.WriteString("}\n\n")
+// ServiceProto returns the content of the proto file with the request and response messages and the service
+// rendered with proto.tmpl
+func ServiceProto(parentNode *astt.GoNode, svc internal.Service, cfg internal.TranspilerConfig) (string, error) {
+	model := ProtoFileModel{Package: svc.Package, GoPackage: svc.GoPackage}
+	deps := internal.DependencySet{}
+	for _, f := range svc.Funcs {
+		request := MessageModel{Name: f.Name + "Request", Reserved: reservedStatements(f.RequestReserved)}
+		model.Messages = append(model.Messages, protoMessage(parentNode, request, requestFields(f), deps, cfg)...)
+		response := MessageModel{Name: f.Name + "Response", Reserved: reservedStatements(f.ResponseReserved)}
+		model.Messages = append(model.Messages, protoMessage(parentNode, response, responseFields(f), deps, cfg)...)
 	}
+	imports, err := protoImports(deps, cfg.GoProjectPath)
+	if err != nil {
+		return "", err
+	}
+	model.Imports = imports
 
-	sb.WriteString("service Leviathan {\n")
-	for _, f := range funcs {
-		rets := "("
-		for idx, r := range f.ReturnTypes {
-			rets += r.Type
-			if idx != len(f.ReturnTypes)-1 {
-				rets += ","
-			}
-		}
-		rets += ")"
-		sb.WriteString(fmt.Sprintf("     rpc %s(%s) returns (%s);\n", f.Name, f.Name+"Request", f.Name+"Response"))
+	// rpcs are written in the order of their locked numbers so new ones end up last
+	rpcs := make([]internal.Function, len(svc.Funcs))
+	copy(rpcs, svc.Funcs)
+	sort.SliceStable(rpcs, func(i, j int) bool {
+		return rpcs[i].Number < rpcs[j].Number
+	})
+	service := ServiceModel{Name: svc.Name, Doc: svc.Doc, Interface: svc.Interface}
+	for _, f := range rpcs {
+		service.RPCs = append(service.RPCs, RPCModel{
+			Name:         f.Name,
+			Doc:          f.Doc,
+			Request:      f.Name + "Request",
+			Response:     f.Name + "Response",
+			ClientStream: f.ClientStream() != nil,
+			ServerStream: f.ServerStream() != nil,
+		})
 	}
-	sb.WriteString("}\n")
-	WriteFile(fmt.Sprintf("%s/server.proto", outDir), []byte(sb.String()))
-}
+	model.Services = []ServiceModel{service}
 
-func convertEnumsByDecl(assignments []internal.EnumAssignment) [][]internal.EnumAssignment {
-	enumsByDecl := map[*ast.GenDecl][]internal.EnumAssignment{}
-	// Populate enums per decl block
-	for _, enum := range assignments {
-		if _, ok := enumsByDecl[enum.Decl]; !ok {
-			enumsByDecl[enum.Decl] = []internal.EnumAssignment{}
-		}
-		enumsByDecl[enum.Decl] = append(enumsByDecl[enum.Decl], enum)
+	src, err := render(cfg, "proto.tmpl", model)
+	if err != nil {
+		return "", fmt.Errorf("proto file of %s: %w", svc.Name, err)
 	}
+	return string(src), nil
+}
 
+// convertEnumsByType groups the values of every go type into one enum, see internal.GroupEnums
+func convertEnumsByType(assignments []internal.EnumAssignment) [][]internal.EnumAssignment {
 	enumsFlat := []([]internal.EnumAssignment){}
-
-	for _, enums := range enumsByDecl {
-		if len(enums) > 0 {
-			enumsFlat = append(enumsFlat, enums)
+	for _, group := range internal.GroupEnums(assignments) {
+		enums := make([]internal.EnumAssignment, len(group))
+		for idx, value := range group {
+			enums[idx] = assignments[value]
 		}
+		enumsFlat = append(enumsFlat, enums)
 	}
 	sort.Slice(enumsFlat, func(i, j int) bool {
 		return enumsFlat[i][0].Name < enumsFlat[j][0].Name
@@ -204,86 +240,165 @@ func convertEnumsByDecl(assignments []internal.EnumAssignment) [][]internal.Enum
 	return enumsFlat
 }
 
-func ToProtoFiles(parentNode *astt.GoNode, structs []internal.Struct, assignments []internal.EnumAssignment, pkgPrefixSlash string) map[string]*ProtoFile {
-	protoFiles := map[string]*ProtoFile{}
-
-	enumsFlat := convertEnumsByDecl(assignments)
+// enumNumbers returns the proto numbers the values of an enum prefer and the name of the value 0 that has to be
+// added before them, empty when a go constant is that value (e.g. StatusUnspecified). The numbers are the go values
+// shifted so no value is 0, iota offsets and gaps are kept. The go constant that is the value 0 is 0 and the values
+// are numbered by position when a go value isn't known (e.g. of string enums)
+func enumNumbers(enums []internal.EnumAssignment, cfg internal.TranspilerConfig) ([]int, string) {
+	unspecified := internal.UnspecifiedValueName(enums[0].FuncName, cfg.Naming)
+	sentinel, known, min := -1, true, 0
+	for idx, e := range enums {
+		if e.ProtoValueName() == unspecified {
+			sentinel = idx
+		}
+		if e.Value == nil {
+			known = false
+		} else if idx == 0 || *e.Value < min {
+			min = *e.Value
+		}
+	}
 
-	// First figure out all dependencies in that package if we were to write all the messages (structs)
-	// and then when we want to write proto header we can write those imports in as well
-	// Write import table + deps from struct fields
-	writtenDeps := map[string]struct{}{}
-	writtenProtoHeader := map[string]struct{}{}
+	numbers := make([]int, len(enums))
+	shift := 0
+	switch {
+	case known && sentinel >= 0:
+		shift = -*enums[sentinel].Value
+	case known && min < 1:
+		shift = 1 - min
+	}
+	position := 1
+	for idx, e := range enums {
+		switch {
+		case known:
+			numbers[idx] = *e.Value + shift
+		case idx == sentinel:
+			numbers[idx] = 0
+		default:
+			numbers[idx] = position
+			position++
+		}
+	}
+	if sentinel >= 0 {
+		unspecified = ""
+	}
+	return numbers, unspecified
+}
 
-	// Add any missing packages for packages that just contain enums
-	for _, enum := range assignments {
-		if _, ok := protoFiles[enum.Package]; !ok {
-			protoFiles[enum.Package] = NewProtoFile(filepath.Dir(*enum.Path.GlobalFilePath) + "/const.go")
-			// TODO: change this so it calculates the go_option package name
-			protoPkg, err := enum.Path.ToProtoPackageFilePath()
-			if err != nil {
-				panic(err)
-			}
-			if _, ok := writtenProtoHeader[enum.Package]; !ok {
-				writeProtoHeaderForProtofile(protoFiles[enum.Package], protoPkg, pkgPrefixSlash)
+// lockedEnumNumbers returns the proto numbers of the values of an enum, the ones an empty lock file assigns when
+// they were never locked so an enum is numbered the same with and without one
+func lockedEnumNumbers(enums []internal.EnumAssignment, cfg internal.TranspilerConfig) ([]int, string) {
+	entries, unspecified := enumEntries(enums, cfg)
+	for _, enum := range enums {
+		if enum.Number != 0 {
+			numbers := make([]int, len(enums))
+			for idx := range enums {
+				numbers[idx] = enums[idx].Number
 			}
-			writtenProtoHeader[enum.Package] = struct{}{}
+			return numbers, unspecified
 		}
 	}
+	return (&lock.Numbers{}).Assign(entries, 0)[len(entries)-len(enums):], unspecified
+}
+
+// sealedOneof is the oneof of the message of a sealed interface, protoc-gen-go names its go field Value
+const sealedOneof = "value"
+
+const (
+	// OptionsPackage is the proto package of the custom options of the generated protos, it's prefixed like the others
+	OptionsPackage = "dumptruck"
+	// OptionsFile is the path of the file declaring the custom options in the output directory
+	OptionsFile = OptionsPackage + "/options.proto"
+)
 
-	// Write dep imports using a temp sb (pkg name -> deps)
+// ToProtoFiles returns the proto file of every go package with a struct or enum keyed by package name
+// rendered with proto.tmpl, and the options file rendered with options.tmpl keyed by OptionsFile when a string enum
+// refers to it
+func ToProtoFiles(parentNode *astt.GoNode, structs []internal.Struct, assignments []internal.EnumAssignment, cfg internal.TranspilerConfig) (map[string]*ProtoFile, error) {
+	protoFiles := map[string]*ProtoFile{}
+	models := map[string]*ProtoFileModel{}
+	// every struct of a package is written to the same file even when the go package has more than one
+	addFile := func(pkg string, path internal.Path) error {
+		if _, ok := protoFiles[pkg]; ok {
+			return nil
+		}
+		protoPkg, goPkg, err := protoPackageForPath(path, cfg)
+		if err != nil {
+			return err
+		}
+		protoFiles[pkg] = NewProtoFile(*path.Path + "/const.go")
+		models[pkg] = &ProtoFileModel{Package: protoPkg, GoPackage: goPkg, Options: cfg.ProtoPackage(OptionsPackage)}
+		return nil
+	}
+	for _, enum := range assignments {
+		if err := addFile(enum.Package, enum.Path); err != nil {
+			return nil, err
+		}
+	}
 	for _, s := range structs {
-		tmpSb := &strings.Builder{}
-		for idx, f := range s.Fields {
-			fieldDeps := writeField(parentNode, f, idx+1, tmpSb)
-			if _, ok := protoFiles[s.Package]; !ok {
-				// Bugfix: when we see a const.go and a const2.go it'll sometimes write
-				// const.proto and const2.proto unnecessarily so collapse them into const.go
-				// for all structs
-				protoFiles[s.Package] = NewProtoFile(filepath.Dir(*s.Path.GlobalFilePath) + "/const.go")
-			}
-			addDependencies(fieldDeps, protoFiles[s.Package].GetDeps())
+		if err := addFile(s.Package, s.Path); err != nil {
+			return nil, err
 		}
 	}
 
-	for _, s := range structs {
-		if _, ok := writtenDeps[s.Package]; !ok {
-			if _, ok2 := writtenProtoHeader[s.Package]; !ok2 {
-				protoPkg, err := s.Path.ToProtoPackageFilePath()
-				if err != nil {
-					panic(err)
-				}
-				writeProtoHeaderForProtofile(protoFiles[s.Package], protoPkg, pkgPrefixSlash)
+	// all of the enums that are in the same package, the go values of string enums are options of their values
+	options := map[string]bool{} // package -> refers to the options file
+	for _, enums := range convertEnumsByType(assignments) {
+		enum := EnumModel{
+			Name:     enums[0].FuncName, // assumes every single one is the same in the enum which is ok
+			Doc:      enums[0].TypeDoc,
+			Reserved: reservedStatements(enums[0].Reserved),
+			GoType:   enums[0].Package + "." + enums[0].FuncName,
+		}
+		numbers, unspecified := lockedEnumNumbers(enums, cfg)
+		if unspecified != "" {
+			enum.Values = append(enum.Values, EnumValueModel{Name: unspecified, Number: 0})
+		}
+		for idx, value := range enums {
+			model := EnumValueModel{Name: value.ProtoValueName(), GoName: value.Name, Number: numbers[idx], Doc: value.Doc}
+			if value.StringValue != nil {
+				model.GoValue = strconv.Quote(*value.StringValue)
+				options[value.Package] = true
 			}
-			writeDepImports(protoFiles[s.Package].GetSb(), protoFiles[s.Package].GetDeps())
-			writtenDeps[s.Package] = struct{}{}
+			enum.Values = append(enum.Values, model)
 		}
+		sort.SliceStable(enum.Values, func(i, j int) bool {
+			return enum.Values[i].Number < enum.Values[j].Number
+		})
+		models[enums[0].Package].Enums = append(models[enums[0].Package].Enums, enum)
 	}
 
-	// all of the enums that are in the same package
-	for _, enums := range enumsFlat {
-		if len(enums) > 0 {
-			sb := protoFiles[enums[0].Package].GetSb()
-			enumName := enums[0].FuncName
-			sb.WriteString(fmt.Sprintf("enum %s {\n", enumName)) // assumes every single one is the same in the enum which is ok
-			for idx, enum := range enums {
-				sb.WriteString(fmt.Sprintf("     %s = %d;\n", enum.Name, idx))
-			}
-			sb.WriteString(fmt.Sprintf("}\n\n"))
+	for _, s := range structs {
+		msg := MessageModel{Name: s.Name, Doc: s.Doc, Reserved: reservedStatements(s.Reserved), GoType: s.Package + "." + s.Name}
+		if s.Sealed {
+			msg.Oneof = sealedOneof
 		}
+		models[s.Package].Messages = append(models[s.Package].Messages, protoMessage(parentNode, msg, s.Fields, protoFiles[s.Package].GetDeps(), cfg)...)
 	}
 
-	for idx, s := range structs {
-		var sb *strings.Builder = protoFiles[s.Package].GetSb()
-		// Write the messages
-		sb.WriteString(fmt.Sprintf("message %s {\n", s.Name))
-		for idx, f := range s.Fields {
-			writeField(parentNode, f, idx+1, sb)
+	for pkg, protoFile := range protoFiles {
+		imports, err := protoImports(protoFile.GetDeps(), cfg.GoProjectPath)
+		if err != nil {
+			return nil, err
 		}
-		sb.WriteString("}")
-		if idx != len(structs)-1 {
-			sb.WriteString("\n\n")
+		if options[pkg] {
+			imports = append(imports, OptionsFile)
+			sort.Strings(imports)
+		}
+		models[pkg].Imports = imports
+		src, err := render(cfg, "proto.tmpl", models[pkg])
+		if err != nil {
+			return nil, fmt.Errorf("proto file of %s: %w", pkg, err)
+		}
+		protoFile.GetSb().Write(src)
+	}
+
+	if len(options) > 0 {
+		src, err := render(cfg, "options.tmpl", OptionsModel{Package: cfg.ProtoPackage(OptionsPackage), GoPackage: cfg.PkgPrefixSlash + "/" + OptionsPackage})
+		if err != nil {
+			return nil, fmt.Errorf("options file: %w", err)
 		}
+		protoFiles[OptionsFile] = NewProtoFile(cfg.GoProjectPath + "/" + strings.TrimSuffix(OptionsFile, ".proto") + ".go")
+		protoFiles[OptionsFile].GetSb().Write(src)
 	}
-	return protoFiles
+	return protoFiles, nil
 }
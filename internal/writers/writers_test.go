@@ -1,8 +1,10 @@
 package writers
 
 import (
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
 	"testing"
 
 	"code.justin.tv/safety/go2proto/internal"
@@ -11,7 +13,11 @@ import (
 )
 
 func TestProtoWriters(t *testing.T) {
-	transpilerConfig := internal.GetTranspilerConfig()
+	configPath, err := internal.FindConfig(".")
+	assert.NoError(t, err)
+	transpilerConfig, err := internal.LoadConfig(configPath)
+	assert.NoError(t, err)
+
 	goNode, err := ast.ResolveGoTree("code.justin.tv/safety/go2proto/dummy/interface.go", transpilerConfig.GoProjectPath)
 	assert.NotNil(t, goNode)
 	assert.NoError(t, err)
@@ -26,12 +32,106 @@ func TestProtoWriters(t *testing.T) {
 	}
 
 	result := ast.Parse(paths, goSrcDir)
-
-	pkgToProtoFiles := ToProtoFiles(goNode, result.Structs, result.Enums, transpilerConfig.PkgPrefixSlash)
+	pkgToProtoFiles, err := ToProtoFiles(goNode, result.Structs, result.Enums, transpilerConfig)
+	assert.NoError(t, err)
 	assert.NotNil(t, pkgToProtoFiles)
 	pkgNames := []string{}
 	for s := range pkgToProtoFiles {
 		pkgNames = append(pkgNames, s)
 	}
-	assert.Equal(t, []string{"nest", "pkg1", "pkg3", "pkg4", "meta"}, pkgNames)
+	sort.Strings(pkgNames)
+	assert.Equal(t, []string{OptionsFile, "meta", "nest", "pkg1", "pkg3", "pkg4"}, pkgNames)
+
+	// an unset enum field reads back as the added value 0, the values of string enums are numbered from 1
+	// and carry their go value
+	nest := pkgToProtoFiles["nest"].GetSb().String()
+	assert.Contains(t, nest, "enum Country {\n     COUNTRY_UNSPECIFIED = 0;\n     Canada = 1 [(dumptruck.go_value) = \"Canada\"];\n}")
+	assert.Contains(t, nest, "\nimport \"dumptruck/options.proto\";\n")
+	assert.Equal(t, transpilerConfig.GoProjectPath+"/dumptruck", pkgToProtoFiles[OptionsFile].GetPackagePath())
+	assert.Contains(t, pkgToProtoFiles[OptionsFile].GetSb().String(), "package dumptruck;\n")
+
+	// the structs implementing the sealed interface Subject are a oneof, E with the methods of the Audit it embeds
+	pkg4 := pkgToProtoFiles["pkg4"].GetSb().String()
+	assert.Contains(t, pkg4, "message Subject {\n    oneof value {\n        Audit Audit = 1;\n        D D = 2;\n        E E = 3;\n    }\n}")
+	assert.Contains(t, pkg4, "    Subject Main = 1;\n    repeated Subject Subjects = 2;\n")
+
+	// Audit and E implement it with value receivers so they convert from both T and *T, only *D has isSubject
+	pkg4Structs := []internal.Struct{}
+	for _, s := range result.Structs {
+		if s.Package == "pkg4" {
+			pkg4Structs = append(pkg4Structs, s)
+		}
+	}
+	src, err := StructConverters(goNode, pkg4Structs, result.Structs, result.Enums, transpilerConfig)
+	assert.NoError(t, err)
+	converters := string(src)
+	assert.Contains(t, converters, `func SubjectFromGo(in pkg4.Subject) *pbpkg4.Subject {
+	switch v := in.(type) {
+	case pkg4.Audit:
+		return &pbpkg4.Subject{Value: &pbpkg4.Subject_Audit{Audit: AuditFromGoPtr(&v)}}
+	case *pkg4.Audit:
+		return &pbpkg4.Subject{Value: &pbpkg4.Subject_Audit{Audit: AuditFromGoPtr(v)}}
+	case *pkg4.D:
+		return &pbpkg4.Subject{Value: &pbpkg4.Subject_D{D: DFromGoPtr(v)}}
+	case pkg4.E:
+		return &pbpkg4.Subject{Value: &pbpkg4.Subject_E{E: EFromGoPtr(&v)}}
+	case *pkg4.E:
+		return &pbpkg4.Subject{Value: &pbpkg4.Subject_E{E: EFromGoPtr(v)}}
+	}
+	return nil
+}`)
+	assert.Contains(t, converters, `func SubjectFromPb(msg *pbpkg4.Subject) pkg4.Subject {
+	switch v := msg.GetValue().(type) {
+	case *pbpkg4.Subject_Audit:
+		return deref(AuditFromPbPtr(v.Audit))
+	case *pbpkg4.Subject_D:
+		return DFromPbPtr(v.D)
+	case *pbpkg4.Subject_E:
+		return deref(EFromPbPtr(v.E))
+	}
+	return nil
+}`)
+	assert.Contains(t, converters, "\t\tMain:     SubjectFromPb(msg.Main),\n")
+}
+
+func TestEnumNumbersKeepDeclarationOrder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dumptruck")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	cfg := internal.DefaultTranspilerConfig()
+	numbers := func(src string) map[string]int {
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "size.go"), []byte(src), 0644))
+		result := ast.ParsePackages([]ast.Package{{ImportPath: "example.com/api", Dir: dir}})
+		assert.Empty(t, result.Diagnostics)
+		enums := convertEnumsByType(result.Enums)[0]
+		internal.ApplyNaming(nil, enums, cfg.Naming)
+		preferred, _ := enumNumbers(enums, cfg)
+		out := map[string]int{}
+		for idx, e := range enums {
+			out[e.Name] = preferred[idx]
+		}
+		return out
+	}
+
+	assert.Equal(t, map[string]int{"Small": 1, "Large": 2}, numbers(`package api
+
+type Size string
+
+const (
+	Small Size = "s"
+	Large Size = "l"
+)
+`))
+	// a value added after the others keeps their numbers even when its name sorts between them
+	assert.Equal(t, map[string]int{"Small": 1, "Large": 2, "Medium": 3}, numbers(`package api
+
+type Size string
+
+const (
+	Small  Size = "s"
+	Large  Size = "l"
+	Medium Size = "m"
+)
+`))
 }